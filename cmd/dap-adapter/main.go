@@ -11,6 +11,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/stefan/lsp-dap/internal/dap/adapter"
 	daptransport "github.com/stefan/lsp-dap/internal/dap/transport"
@@ -24,6 +25,10 @@ import (
 const runtimeStopWaitTimeout = 3 * time.Second
 const defaultLinkExpression = "]LINK.Create # ."
 const postConfigurationCommandTimeout = 30 * time.Second
+const reconnectInitialBackoff = 100 * time.Millisecond
+const reconnectMaxBackoff = 2 * time.Second
+const runInTerminalTimeout = 10 * time.Second
+const lossReportBuffer = 16
 
 func main() {
 	if err := run(context.Background(), os.Stdin, os.Stdout, os.Stderr); err != nil {
@@ -39,27 +44,26 @@ func run(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Write
 	runtime := newRideRuntime(server, writer)
 	defer runtime.stop()
 
+	requests := make(chan dapRequestMessage)
+	readDone := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		readDone <- readDAPMessages(reader, writer, requests, done)
+	}()
+
 	for {
+		var request dapRequestMessage
 		select {
 		case <-ctx.Done():
 			return nil
-		default:
-		}
-
-		payload, err := readDAPPayload(reader)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return nil
-			}
+		case err := <-readDone:
 			return err
+		case request = <-requests:
 		}
 
-		var request dapRequestMessage
-		if err := json.Unmarshal(payload, &request); err != nil {
-			return err
-		}
-		if request.Type != "request" {
-			continue
+		if request.Command == "initialize" {
+			runtime.setClientCapabilities(request.Arguments)
 		}
 
 		if (request.Command == "launch" || request.Command == "attach") &&
@@ -79,6 +83,47 @@ func run(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Write
 			}
 		}
 
+		if request.Command == "evaluate" {
+			// Evaluates wait on the interpreter, so they are answered off the read loop.
+			// The loop only moves on once the request has joined the repl queue, which
+			// keeps back-to-back evaluates in arrival order.
+			admitted := make(chan struct{})
+			var admitOnce sync.Once
+			admit := func() { admitOnce.Do(func() { close(admitted) }) }
+			go func(request dapRequestMessage) {
+				response, _ := server.HandleRequest(adapter.Request{
+					Seq:       request.Seq,
+					Command:   request.Command,
+					Arguments: request.Arguments,
+					Admitted:  admit,
+				})
+				admit()
+				if err := writer.writeResponse(response); err != nil {
+					_, _ = fmt.Fprintf(stderr, "dap-adapter write response: %v\n", err)
+				}
+			}(request)
+			<-admitted
+			continue
+		}
+
+		if request.Command == "completions" || request.Command == "source" ||
+			request.Command == "dyalog/edit" || request.Command == "dyalog/saveChanges" ||
+			request.Command == "threads" || request.Command == "stackTrace" {
+			// These also wait on interpreter replies; answering them off the read loop
+			// keeps further requests, including cancel, flowing in the meantime.
+			go func(request dapRequestMessage) {
+				response, _ := server.HandleRequest(adapter.Request{
+					Seq:       request.Seq,
+					Command:   request.Command,
+					Arguments: request.Arguments,
+				})
+				if err := writer.writeResponse(response); err != nil {
+					_, _ = fmt.Fprintf(stderr, "dap-adapter write response: %v\n", err)
+				}
+			}(request)
+			continue
+		}
+
 		response, events := server.HandleRequest(adapter.Request{
 			Seq:       request.Seq,
 			Command:   request.Command,
@@ -114,8 +159,8 @@ func run(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Write
 }
 
 type dapRequestMessage struct {
-	Seq       int `json:"seq"`
-	Type      string
+	Seq       int    `json:"seq"`
+	Type      string `json:"type"`
 	Command   string `json:"command"`
 	Arguments any    `json:"arguments,omitempty"`
 }
@@ -137,16 +182,93 @@ type dapEventMessage struct {
 	Body  any    `json:"body,omitempty"`
 }
 
+// runInTerminalArguments is the body of the DAP runInTerminal reverse request.
+type runInTerminalArguments struct {
+	Kind  string            `json:"kind,omitempty"`
+	Title string            `json:"title,omitempty"`
+	Cwd   string            `json:"cwd"`
+	Args  []string          `json:"args"`
+	Env   map[string]string `json:"env,omitempty"`
+}
+
 type dapWriter struct {
 	mu      sync.Mutex
 	nextSeq int
 	out     io.Writer
+	pending map[int]chan dapResponseMessage
+	closed  bool
 }
 
 func newDAPWriter(out io.Writer) *dapWriter {
 	return &dapWriter{
 		nextSeq: 1,
 		out:     out,
+		pending: make(map[int]chan dapResponseMessage),
+	}
+}
+
+// sendRequest issues a reverse request to the client and waits for the matching response.
+func (w *dapWriter) sendRequest(ctx context.Context, command string, arguments any) (dapResponseMessage, error) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return dapResponseMessage{}, fmt.Errorf("%s: DAP client stream is closed", command)
+	}
+	seq := w.nextSeq
+	w.nextSeq++
+	reply := make(chan dapResponseMessage, 1)
+	w.pending[seq] = reply
+	err := writeDAPPayload(w.out, dapRequestMessage{
+		Seq:       seq,
+		Type:      "request",
+		Command:   command,
+		Arguments: arguments,
+	})
+	if err != nil {
+		delete(w.pending, seq)
+	}
+	w.mu.Unlock()
+	if err != nil {
+		return dapResponseMessage{}, err
+	}
+
+	select {
+	case response, ok := <-reply:
+		if !ok {
+			return dapResponseMessage{}, fmt.Errorf("%s: DAP client stream closed before response", command)
+		}
+		if !response.Success {
+			return response, fmt.Errorf("%s failed: %s", command, response.Message)
+		}
+		return response, nil
+	case <-ctx.Done():
+		w.mu.Lock()
+		delete(w.pending, seq)
+		w.mu.Unlock()
+		return dapResponseMessage{}, fmt.Errorf("%s: %w", command, ctx.Err())
+	}
+}
+
+// deliverResponse hands a client response to the reverse request waiting on it, if any.
+func (w *dapWriter) deliverResponse(response dapResponseMessage) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	reply, ok := w.pending[response.RequestSeq]
+	if !ok {
+		return
+	}
+	delete(w.pending, response.RequestSeq)
+	reply <- response
+}
+
+// closeRequests fails outstanding and future reverse requests once the client stream has ended.
+func (w *dapWriter) closeRequests() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	for seq, reply := range w.pending {
+		close(reply)
+		delete(w.pending, seq)
 	}
 }
 
@@ -183,6 +305,48 @@ func (w *dapWriter) writeEvent(event adapter.Event) error {
 	return writeDAPPayload(w.out, message)
 }
 
+// processOutputWriter forwards output of the launched interpreter process as DAP output events.
+// A trailing partial UTF-8 sequence is held back until the rest of it arrives.
+type processOutputWriter struct {
+	mu       sync.Mutex
+	writer   *dapWriter
+	category string
+	pending  []byte
+}
+
+func newProcessOutputWriter(writer *dapWriter, category string) *processOutputWriter {
+	return &processOutputWriter{writer: writer, category: category}
+}
+
+func (w *processOutputWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data := append(w.pending, p...)
+	complete := len(data)
+	for start := complete - 1; start >= 0 && start >= complete-utf8.UTFMax; start-- {
+		if utf8.RuneStart(data[start]) {
+			if !utf8.FullRune(data[start:]) {
+				complete = start
+			}
+			break
+		}
+	}
+	w.pending = append([]byte(nil), data[complete:]...)
+	if complete == 0 {
+		return len(p), nil
+	}
+
+	_ = w.writer.writeEvent(adapter.Event{
+		Event: "output",
+		Body: adapter.OutputEventBody{
+			Category: w.category,
+			Output:   string(data[:complete]),
+		},
+	})
+	return len(p), nil
+}
+
 type rideRuntime struct {
 	mu          sync.Mutex
 	server      *adapter.Server
@@ -198,6 +362,8 @@ type rideRuntime struct {
 	cancel      context.CancelFunc
 	runDone     chan struct{}
 	bridgeDone  chan struct{}
+
+	supportsRunInTerminal bool
 }
 
 func newRideRuntime(server *adapter.Server, writer *dapWriter) *rideRuntime {
@@ -207,6 +373,16 @@ func newRideRuntime(server *adapter.Server, writer *dapWriter) *rideRuntime {
 	}
 }
 
+// setClientCapabilities records client features advertised in the initialize request.
+func (r *rideRuntime) setClientCapabilities(arguments any) {
+	argsMap, _ := arguments.(map[string]any)
+	supported := decode.BoolOrFalse(argsMap["supportsRunInTerminalRequest"])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.supportsRunInTerminal = supported
+}
+
 func (r *rideRuntime) started() bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -229,21 +405,76 @@ func (r *rideRuntime) start(ctx context.Context, requestCommand string, args any
 	linkExpr := runtimeLinkExpressionFrom(requestCommand, args)
 	launchExpr := runtimeLaunchExpressionFrom(args)
 
+	console, err := runtimeConsoleFrom(requestCommand, args)
+	if err != nil {
+		return err
+	}
+	limits, err := runtimeconfig.LimitsFromRequest(args)
+	if err != nil {
+		return err
+	}
+	r.server.SetLimits(adapter.Limits(limits))
+	hoverAllowlist, err := runtimeconfig.HoverAllowlistFromRequest(args)
+	if err != nil {
+		return err
+	}
+	r.server.SetHoverAllowlist(hoverAllowlist)
+	replDisplay, err := runtimeconfig.ReplDisplayFromRequest(args)
+	if err != nil {
+		return err
+	}
+	r.server.SetReplDisplay(replDisplay)
+	dialogPolicy, err := runtimeconfig.DialogPolicyFromRequest(args)
+	if err != nil {
+		return err
+	}
+	r.server.SetDialogPolicy(dialogPolicy)
+	pathMappings, err := runtimeconfig.PathMappingsFromRequest(args)
+	if err != nil {
+		return err
+	}
+	r.server.SetPathMappings(adapterPathMappings(pathMappings))
+	cfg.LaunchStdout = newProcessOutputWriter(r.writer, "stdout")
+	cfg.LaunchStderr = newProcessOutputWriter(r.writer, "stderr")
+	if cfg.Launch != nil {
+		cfg.LaunchRunner = r.terminalLaunchRunner(console)
+	}
 	h := harness.New(cfg)
 	client, err := h.Start(ctx, "dap-adapter")
 	if err != nil {
 		return err
 	}
+	r.server.SetProtocolVersion(h.ProtocolVersion())
+	r.server.SetStartMethod(requestCommand)
+	if cfg.RideAddr == harness.AutoRideAddr {
+		r.writeEvents([]adapter.Event{{
+			Event: "output",
+			Body: adapter.OutputEventBody{
+				Category: "console",
+				Output:   fmt.Sprintf("RIDE endpoint: %s (rideAddr auto)\n", h.RideAddr()),
+				Data:     map[string]any{"rideAddr": h.RideAddr()},
+			},
+		}})
+	}
 
 	dispatcher := sessionstate.NewDispatcher(client, protocol.NewCodec())
+	// Loss reports arrive on the dispatcher's receive loop, so they are handed to the bridge
+	// to write; reports are rate limited, and one that finds the buffer full is dropped.
+	losses := make(chan sessionstate.SubscriberLoss, lossReportBuffer)
+	dispatcher.SetLossHandler(func(loss sessionstate.SubscriberLoss) {
+		select {
+		case losses <- loss:
+		default:
+		}
+	})
 	events, unsubscribe := dispatcher.Subscribe(1024)
 	r.server.SetRideController(dispatcher)
 
 	runCtx, cancel := context.WithCancel(context.Background())
 	runDone := make(chan struct{})
 	go func() {
-		dispatcher.Run(runCtx)
-		close(runDone)
+		defer close(runDone)
+		r.superviseDispatcher(runCtx, h, dispatcher, cfg.ReconnectTimeout)
 	}()
 
 	bridgeDone := make(chan struct{})
@@ -258,6 +489,20 @@ func (r *rideRuntime) start(ctx context.Context, requestCommand string, args any
 				for _, dapEvent := range outbound {
 					_ = r.writer.writeEvent(dapEvent)
 				}
+			case loss := <-losses:
+				r.writeEvents([]adapter.Event{{
+					Event: "output",
+					Body: adapter.OutputEventBody{
+						Category: "console",
+						Output:   "RIDE event loss: " + loss.String() + "\n",
+						Data: map[string]any{
+							"subscriber":   loss.Subscriber,
+							"dropped":      loss.Dropped,
+							"totalDropped": loss.TotalDropped,
+							"commands":     loss.Commands,
+						},
+					},
+				}})
 			}
 		}
 	}()
@@ -311,14 +556,15 @@ func (r *rideRuntime) stop() error {
 	if unsubscribe != nil {
 		unsubscribe()
 	}
+	// Cancel before closing so the dropped connection is not mistaken for one worth redialing.
+	if cancel != nil {
+		cancel()
+	}
 	if h != nil {
 		if err := h.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("close harness: %w", err))
 		}
 	}
-	if cancel != nil {
-		cancel()
-	}
 	if err := waitForDone(runDone, runtimeStopWaitTimeout, "RIDE dispatcher"); err != nil {
 		errs = append(errs, err)
 	}
@@ -332,6 +578,132 @@ func (r *rideRuntime) stop() error {
 	return nil
 }
 
+// terminalLaunchRunner returns a runner that starts the interpreter in a client terminal via
+// runInTerminal, or nil to launch it directly with output forwarded to the Debug Console.
+func (r *rideRuntime) terminalLaunchRunner(console string) func(context.Context, harness.LaunchSpec) (*os.Process, error) {
+	r.mu.Lock()
+	supported := r.supportsRunInTerminal
+	r.mu.Unlock()
+
+	kind := "integrated"
+	switch console {
+	case "internalConsole":
+		return nil
+	case "externalTerminal":
+		kind = "external"
+	}
+	if !supported {
+		if console != "" {
+			r.writeEvents([]adapter.Event{{
+				Event: "output",
+				Body: adapter.OutputEventBody{
+					Category: "console",
+					Output:   "Client does not support runInTerminal; starting the interpreter without a terminal\n",
+				},
+			}})
+		}
+		return nil
+	}
+
+	return func(ctx context.Context, spec harness.LaunchSpec) (*os.Process, error) {
+		cwd := spec.Dir
+		if cwd == "" {
+			cwd, _ = os.Getwd()
+		}
+		requestCtx, cancel := context.WithTimeout(ctx, runInTerminalTimeout)
+		defer cancel()
+		response, err := r.writer.sendRequest(requestCtx, "runInTerminal", runInTerminalArguments{
+			Kind:  kind,
+			Title: "Dyalog APL",
+			Cwd:   cwd,
+			Args:  append([]string{spec.Executable}, spec.Args...),
+			Env:   spec.Env,
+		})
+		if err != nil {
+			return nil, err
+		}
+		body, _ := response.Body.(map[string]any)
+		pid, ok := decode.Int(body["processId"])
+		if !ok || pid <= 0 {
+			// Without a process id the terminal owns the interpreter's lifetime.
+			return nil, nil
+		}
+		return os.FindProcess(pid)
+	}
+}
+
+// superviseDispatcher runs the RIDE receive loop and redials the interpreter when the
+// connection drops, until the runtime is stopped or reconnectTimeout elapses.
+func (r *rideRuntime) superviseDispatcher(
+	ctx context.Context,
+	h *harness.Harness,
+	dispatcher *sessionstate.Dispatcher,
+	reconnectTimeout time.Duration,
+) {
+	for {
+		dispatcher.Run(ctx)
+		if ctx.Err() != nil || r.server.SessionTerminated() {
+			return
+		}
+
+		if reconnectTimeout <= 0 {
+			r.writeEvents(r.server.HandleRideConnectionLost(errors.New("reconnect disabled")))
+			return
+		}
+		r.writeEvents([]adapter.Event{{
+			Event: "output",
+			Body: adapter.OutputEventBody{
+				Category: "console",
+				Output:   "RIDE connection lost; reconnecting\n",
+			},
+		}})
+
+		if err := reconnectWithBackoff(ctx, h, reconnectTimeout); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.writeEvents(r.server.HandleRideConnectionLost(err))
+			return
+		}
+		dispatcher.ResetSession()
+		r.server.SetProtocolVersion(h.ProtocolVersion())
+		r.writeEvents(r.server.HandleRideReconnect())
+	}
+}
+
+func reconnectWithBackoff(ctx context.Context, h *harness.Harness, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := reconnectInitialBackoff
+	for {
+		err := h.Reconnect(ctx)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, harness.ErrNotStarted) {
+			return err
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("gave up reconnecting after %s: %w", timeout, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+}
+
+func (r *rideRuntime) writeEvents(events []adapter.Event) {
+	for _, event := range events {
+		_ = r.writer.writeEvent(event)
+	}
+}
+
 func (r *rideRuntime) executeConfiguredLaunchExpression() error {
 	r.mu.Lock()
 	dispatcher := r.dispatcher
@@ -357,6 +729,17 @@ func (r *rideRuntime) executeConfiguredLaunchExpression() error {
 	}
 	r.mu.Unlock()
 
+	if info, ok := r.server.SessionInfo(); needsLink && ok && !info.Supports(protocol.FeatureLink) {
+		needsLink = false
+		r.writeEvents([]adapter.Event{{
+			Event: "output",
+			Body: adapter.OutputEventBody{
+				Category: "console",
+				Output: fmt.Sprintf("skipping linkExpression: Link needs Dyalog %s or later (interpreter is %s)\n",
+					protocol.MinVersion(protocol.FeatureLink), info.Version),
+			},
+		}})
+	}
 	if needsLink {
 		if err := executeRuntimeCommand(dispatcher, linkExpr, true); err != nil {
 			return fmt.Errorf("failed to execute linkExpression: %w", err)
@@ -395,9 +778,9 @@ func executeRuntimeCommand(dispatcher *sessionstate.Dispatcher, text string, wai
 	if !strings.HasSuffix(trimmed, "\n") {
 		trimmed += "\n"
 	}
-	if err := dispatcher.SendCommand("Execute", map[string]any{
-		"text":  trimmed,
-		"trace": 0,
+	if err := dispatcher.SendCommand("Execute", protocol.ExecuteArgs{
+		Text:  trimmed,
+		Trace: 0,
 	}); err != nil {
 		return err
 	}
@@ -489,6 +872,18 @@ func runtimeConfigFrom(requestCommand string, arguments any) (harness.Config, er
 	return runtimeconfig.FromRequest(requestCommand, arguments)
 }
 
+// adapterPathMappings converts the configured path mappings to the server's own type.
+func adapterPathMappings(mappings []runtimeconfig.PathMapping) []adapter.PathMapping {
+	if mappings == nil {
+		return nil
+	}
+	converted := make([]adapter.PathMapping, 0, len(mappings))
+	for _, mapping := range mappings {
+		converted = append(converted, adapter.PathMapping{LocalRoot: mapping.LocalRoot, RemoteRoot: mapping.RemoteRoot})
+	}
+	return converted
+}
+
 func runtimeLaunchExpressionFrom(arguments any) string {
 	argsMap, ok := arguments.(map[string]any)
 	if !ok {
@@ -498,6 +893,25 @@ func runtimeLaunchExpressionFrom(arguments any) string {
 	return text
 }
 
+// runtimeConsoleFrom reads where a launched interpreter runs: internalConsole, integratedTerminal
+// or externalTerminal. Empty means integratedTerminal when the client supports it.
+func runtimeConsoleFrom(requestCommand string, arguments any) (string, error) {
+	if requestCommand != "launch" {
+		return "", nil
+	}
+	argsMap, ok := arguments.(map[string]any)
+	if !ok {
+		return "", nil
+	}
+	console, _ := decode.NonEmptyTrimmedStringFromMap(argsMap, "console")
+	switch console {
+	case "", "internalConsole", "integratedTerminal", "externalTerminal":
+		return console, nil
+	default:
+		return "", fmt.Errorf("invalid console %q: expected internalConsole, integratedTerminal or externalTerminal", console)
+	}
+}
+
 func runtimeAutoLinkFrom(requestCommand string, arguments any) bool {
 	if requestCommand != "launch" {
 		return false
@@ -528,6 +942,40 @@ func runtimeLinkExpressionFrom(requestCommand string, arguments any) string {
 	return defaultLinkExpression
 }
 
+// readDAPMessages forwards client requests and routes client responses to pending reverse
+// requests, so a request handler can wait on the client without stalling the read loop.
+func readDAPMessages(reader *bufio.Reader, writer *dapWriter, requests chan<- dapRequestMessage, done <-chan struct{}) error {
+	defer writer.closeRequests()
+	for {
+		payload, err := readDAPPayload(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		var request dapRequestMessage
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return err
+		}
+		switch request.Type {
+		case "request":
+			select {
+			case requests <- request:
+			case <-done:
+				return nil
+			}
+		case "response":
+			var response dapResponseMessage
+			if err := json.Unmarshal(payload, &response); err != nil {
+				return err
+			}
+			writer.deliverResponse(response)
+		}
+	}
+}
+
 func readDAPPayload(reader *bufio.Reader) ([]byte, error) {
 	return daptransport.ReadPayload(reader)
 }
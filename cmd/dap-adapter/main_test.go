@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/binary"
 	"encoding/json"
@@ -11,6 +12,9 @@ import (
 	"net"
 	"testing"
 	"time"
+
+	"github.com/stefan/lsp-dap/internal/dap/adapter"
+	runtimeconfig "github.com/stefan/lsp-dap/internal/runtime/config"
 )
 
 func TestRun_InitializeAndDisconnectOverStdio(t *testing.T) {
@@ -146,6 +150,25 @@ func TestRun_LaunchAndControlRoundTripAgainstRide(t *testing.T) {
 			return
 		}
 
+		siPayload, err := rideReadFrame(conn)
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		siCommand, err := rideDecodeCommandName(siPayload)
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		if siCommand != "GetSIStack" {
+			serverErr <- fmt.Errorf("expected GetSIStack for stackTrace, got %q", siCommand)
+			return
+		}
+		if err := rideWriteFrame(conn, `["ReplyGetSIStack",{"stack":[{"description":"demo[4]"}],"tid":7}]`); err != nil {
+			serverErr <- err
+			return
+		}
+
 		nextPayload, err := rideReadFrame(conn)
 		if err != nil {
 			serverErr <- err
@@ -316,6 +339,9 @@ func TestRun_LaunchAndControlRoundTripAgainstRide(t *testing.T) {
 	if len(frames) == 0 {
 		t.Fatalf("expected non-empty stackFrames: %#v", stackResp)
 	}
+	if frame, _ := frames[0].(map[string]any); frame["name"] != "demo[4]" {
+		t.Fatalf("expected top frame named from ReplyGetSIStack, got %#v", frames[0])
+	}
 
 	writeReq(6, "next", nil)
 	if ok, _ := waitForResponse(t, msgs, 6)["success"].(bool); !ok {
@@ -677,6 +703,161 @@ func TestRun_LaunchAutoLinkDisabledExecutesOnlyLaunchExpression(t *testing.T) {
 	}
 }
 
+func TestRun_ReplEvaluatesExecuteInArrivalOrder(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+
+		if err := rideHandshake(conn); err != nil {
+			serverErr <- err
+			return
+		}
+
+		for _, want := range []string{"first", "second"} {
+			payload, err := rideReadFrame(conn)
+			if err != nil {
+				serverErr <- err
+				return
+			}
+			command, err := rideDecodeCommandName(payload)
+			if err != nil {
+				serverErr <- err
+				return
+			}
+			if command != "Execute" {
+				serverErr <- fmt.Errorf("expected Execute, got %q", command)
+				return
+			}
+			text, _, err := rideDecodeExecute(payload)
+			if err != nil {
+				serverErr <- err
+				return
+			}
+			if text != want+"\n" {
+				serverErr <- fmt.Errorf("expected Execute %q, got %q", want+"\n", text)
+				return
+			}
+			for _, reply := range []string{
+				`["SetPromptType",{"type":0}]`,
+				`["AppendSessionOutput",{"result":"` + want + `\n","type":2}]`,
+				`["SetPromptType",{"type":1}]`,
+			} {
+				if err := rideWriteFrame(conn, reply); err != nil {
+					serverErr <- err
+					return
+				}
+			}
+		}
+		serverErr <- nil
+	}()
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- run(context.Background(), inR, outW, io.Discard)
+		_ = outW.Close()
+	}()
+
+	decoderErr := make(chan error, 1)
+	msgs := make(chan map[string]any, 128)
+	go func() {
+		defer close(msgs)
+		decoderErr <- decodeDAPStream(outR, msgs)
+	}()
+
+	writeReq := func(seq int, command string, args map[string]any) {
+		t.Helper()
+		req := map[string]any{
+			"seq":     seq,
+			"type":    "request",
+			"command": command,
+		}
+		if args != nil {
+			req["arguments"] = args
+		}
+		if err := writeDAPFrame(inW, req); err != nil {
+			t.Fatalf("write %s failed: %v", command, err)
+		}
+	}
+
+	writeReq(1, "initialize", map[string]any{"adapterID": "dyalog-dap"})
+	if ok, _ := waitForResponse(t, msgs, 1)["success"].(bool); !ok {
+		t.Fatal("initialize response was not successful")
+	}
+	waitForEvent(t, msgs, "initialized")
+
+	writeReq(2, "attach", map[string]any{
+		"rideAddr":           ln.Addr().String(),
+		"rideTranscriptsDir": t.TempDir(),
+	})
+	if ok, _ := waitForResponse(t, msgs, 2)["success"].(bool); !ok {
+		t.Fatal("attach response was not successful")
+	}
+
+	// Both evaluates are written before either is answered, as when a multi-line
+	// paste reaches the Debug Console.
+	writeReq(3, "evaluate", map[string]any{"expression": "first", "context": "repl"})
+	writeReq(4, "evaluate", map[string]any{"expression": "second", "context": "repl"})
+	results := map[int]string{}
+	deadline := time.After(3 * time.Second)
+	for len(results) < 2 {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				t.Fatal("message stream closed while waiting for evaluate responses")
+			}
+			seq, _ := asInt(msg["request_seq"])
+			if msg["type"] != "response" || (seq != 3 && seq != 4) {
+				continue
+			}
+			if ok, _ := msg["success"].(bool); !ok {
+				t.Fatalf("evaluate %d failed: %v", seq, msg["message"])
+			}
+			body, _ := msg["body"].(map[string]any)
+			results[seq], _ = body["result"].(string)
+		case <-deadline:
+			t.Fatalf("timed out waiting for evaluate responses, got %v", results)
+		}
+	}
+	if results[3] != "first" || results[4] != "second" {
+		t.Fatalf("unexpected evaluate results: %v", results)
+	}
+
+	writeReq(5, "disconnect", nil)
+	if ok, _ := waitForResponse(t, msgs, 5)["success"].(bool); !ok {
+		t.Fatal("disconnect response was not successful")
+	}
+	_ = inW.Close()
+
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Fatalf("run returned error: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for run to stop")
+	}
+	if err := <-decoderErr; err != nil {
+		t.Fatalf("decode stream failed: %v", err)
+	}
+	if err := <-serverErr; err != nil {
+		t.Fatalf("fake RIDE server assertions failed: %v", err)
+	}
+}
+
 func TestRun_LaunchBeforeInitializeDoesNotStartRideRuntime(t *testing.T) {
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -858,6 +1039,258 @@ func TestRun_DisconnectDoesNotHangWhenRideConnectionStaysOpen(t *testing.T) {
 	}
 }
 
+func TestRun_ReconnectsAfterRideConnectionDrops(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	serverErr := make(chan error, 1)
+	serverDone := make(chan struct{})
+	go func() {
+		first, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		if err := rideHandshake(first); err != nil {
+			_ = first.Close()
+			serverErr <- err
+			return
+		}
+		// Simulate an interpreter hiccup by dropping the socket mid-session.
+		_ = first.Close()
+
+		second, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer second.Close()
+		if err := rideHandshake(second); err != nil {
+			serverErr <- fmt.Errorf("reconnect handshake: %w", err)
+			return
+		}
+		payload, err := rideReadFrame(second)
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		command, err := rideDecodeCommandName(payload)
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		if command != "GetWindowLayout" {
+			serverErr <- fmt.Errorf("expected layout resync after reconnect, got %q", command)
+			return
+		}
+
+		<-serverDone
+		serverErr <- nil
+	}()
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- run(context.Background(), inR, outW, io.Discard)
+		_ = outW.Close()
+	}()
+
+	decoderErr := make(chan error, 1)
+	msgs := make(chan map[string]any, 64)
+	go func() {
+		defer close(msgs)
+		decoderErr <- decodeDAPStream(outR, msgs)
+	}()
+
+	writeReq := func(seq int, command string, args map[string]any) {
+		t.Helper()
+		req := map[string]any{
+			"seq":     seq,
+			"type":    "request",
+			"command": command,
+		}
+		if args != nil {
+			req["arguments"] = args
+		}
+		if err := writeDAPFrame(inW, req); err != nil {
+			t.Fatalf("write %s failed: %v", command, err)
+		}
+	}
+
+	writeReq(1, "initialize", map[string]any{"adapterID": "dyalog-dap"})
+	if ok, _ := waitForResponse(t, msgs, 1)["success"].(bool); !ok {
+		t.Fatal("initialize response was not successful")
+	}
+	waitForEvent(t, msgs, "initialized")
+
+	writeReq(2, "attach", map[string]any{
+		"rideAddr":             ln.Addr().String(),
+		"rideTranscriptsDir":   t.TempDir(),
+		"rideReconnectTimeout": "2s",
+	})
+	if ok, _ := waitForResponse(t, msgs, 2)["success"].(bool); !ok {
+		t.Fatal("attach response was not successful")
+	}
+
+	invalidated := waitForEvent(t, msgs, "invalidated")
+	body, _ := invalidated["body"].(map[string]any)
+	if areas, _ := body["areas"].([]any); len(areas) == 0 {
+		t.Fatalf("expected invalidated areas after reconnect, got %#v", invalidated)
+	}
+
+	writeReq(3, "disconnect", nil)
+	if ok, _ := waitForResponse(t, msgs, 3)["success"].(bool); !ok {
+		t.Fatal("disconnect response was not successful")
+	}
+	_ = inW.Close()
+
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Fatalf("run returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for run to stop")
+	}
+
+	close(serverDone)
+	if err := <-serverErr; err != nil {
+		t.Fatalf("fake RIDE server error: %v", err)
+	}
+	if err := <-decoderErr; err != nil {
+		t.Fatalf("decode stream failed: %v", err)
+	}
+}
+
+func TestRun_LaunchStartsInterpreterViaRunInTerminal(t *testing.T) {
+	t.Setenv("DYALOG_RIDE_LAUNCH", "")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	serverErr := make(chan error, 1)
+	serverDone := make(chan struct{})
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		if err := rideHandshake(conn); err != nil {
+			serverErr <- err
+			return
+		}
+		<-serverDone
+		serverErr <- nil
+	}()
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- run(context.Background(), inR, outW, io.Discard)
+		_ = outW.Close()
+	}()
+
+	decoderErr := make(chan error, 1)
+	msgs := make(chan map[string]any, 64)
+	go func() {
+		defer close(msgs)
+		decoderErr <- decodeDAPStream(outR, msgs)
+	}()
+
+	writeMsg := func(msg map[string]any) {
+		t.Helper()
+		if err := writeDAPFrame(inW, msg); err != nil {
+			t.Fatalf("write %v failed: %v", msg["command"], err)
+		}
+	}
+
+	writeMsg(map[string]any{"seq": 1, "type": "request", "command": "initialize", "arguments": map[string]any{
+		"adapterID":                    "dyalog-dap",
+		"supportsRunInTerminalRequest": true,
+	}})
+	if ok, _ := waitForResponse(t, msgs, 1)["success"].(bool); !ok {
+		t.Fatal("initialize response was not successful")
+	}
+
+	writeMsg(map[string]any{"seq": 2, "type": "request", "command": "launch", "arguments": map[string]any{
+		"rideAddr":           ln.Addr().String(),
+		"rideTranscriptsDir": t.TempDir(),
+		"dyalogBin":          "dyalog-under-test",
+		"args":               []any{"DEBUG=1"},
+	}})
+
+	var reverse map[string]any
+	deadline := time.After(3 * time.Second)
+	for reverse == nil {
+		select {
+		case msg := <-msgs:
+			if msg["type"] == "request" && msg["command"] == "runInTerminal" {
+				reverse = msg
+			}
+		case <-deadline:
+			t.Fatal("timed out waiting for runInTerminal reverse request")
+		}
+	}
+	args, _ := reverse["arguments"].(map[string]any)
+	if args["kind"] != "integrated" {
+		t.Fatalf("unexpected terminal kind: %#v", args["kind"])
+	}
+	if got := fmt.Sprint(args["args"]); got != "[dyalog-under-test +s -q DEBUG=1]" {
+		t.Fatalf("unexpected terminal args: %s", got)
+	}
+	env, _ := args["env"].(map[string]any)
+	if env["RIDE_INIT"] != "SERVE:*:"+port {
+		t.Fatalf("unexpected terminal env: %#v", env)
+	}
+
+	reverseSeq, _ := asInt(reverse["seq"])
+	writeMsg(map[string]any{
+		"seq":         3,
+		"type":        "response",
+		"request_seq": reverseSeq,
+		"command":     "runInTerminal",
+		"success":     true,
+		"body":        map[string]any{},
+	})
+	if resp := waitForResponse(t, msgs, 2); resp["success"] != true {
+		t.Fatalf("launch response was not successful: %#v", resp)
+	}
+
+	writeMsg(map[string]any{"seq": 4, "type": "request", "command": "disconnect"})
+	if ok, _ := waitForResponse(t, msgs, 4)["success"].(bool); !ok {
+		t.Fatal("disconnect response was not successful")
+	}
+	_ = inW.Close()
+
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Fatalf("run returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for run to stop")
+	}
+	close(serverDone)
+	if err := <-serverErr; err != nil {
+		t.Fatalf("fake RIDE server error: %v", err)
+	}
+	if err := <-decoderErr; err != nil {
+		t.Fatalf("decode stream failed: %v", err)
+	}
+}
+
 func waitForResponse(t *testing.T, msgs <-chan map[string]any, seq int) map[string]any {
 	t.Helper()
 	deadline := time.After(3 * time.Second)
@@ -1097,3 +1530,50 @@ func TestRuntimeConfigFrom_AttachRejectsExplicitLaunchSettings(t *testing.T) {
 		t.Fatal("expected attach with rideLaunchCommand to fail ownership policy")
 	}
 }
+
+func TestRuntimeConfig_ValuesMatchServerSettings(t *testing.T) {
+	for _, mode := range []string{adapter.ReplDisplayPlain, adapter.ReplDisplayBoxed, adapter.ReplDisplayJSON} {
+		if got, err := runtimeconfig.ReplDisplayFromRequest(map[string]any{"replDisplay": mode}); err != nil || got != mode {
+			t.Fatalf("expected replDisplay %q accepted, got %q (%v)", mode, got, err)
+		}
+	}
+	for _, policy := range []string{adapter.DialogPolicyPrompt, adapter.DialogPolicyCancel, adapter.DialogPolicyDefault} {
+		if got, err := runtimeconfig.DialogPolicyFromRequest(map[string]any{"dialogPolicy": policy}); err != nil || got != policy {
+			t.Fatalf("expected dialogPolicy %q accepted, got %q (%v)", policy, got, err)
+		}
+	}
+	mappings := adapterPathMappings([]runtimeconfig.PathMapping{{LocalRoot: "/home/me/app", RemoteRoot: "/opt/app"}})
+	if len(mappings) != 1 || mappings[0] != (adapter.PathMapping{LocalRoot: "/home/me/app", RemoteRoot: "/opt/app"}) {
+		t.Fatalf("unexpected converted mappings: %#v", mappings)
+	}
+}
+
+func TestProcessOutputWriter_ForwardsOutputEventsWithoutSplittingRunes(t *testing.T) {
+	var out bytes.Buffer
+	w := newProcessOutputWriter(newDAPWriter(&out), "stderr")
+
+	text := []byte("⍝ boot\n")
+	if _, err := w.Write(text[:2]); err != nil {
+		t.Fatalf("first write failed: %v", err)
+	}
+	if _, err := w.Write(text[2:]); err != nil {
+		t.Fatalf("second write failed: %v", err)
+	}
+
+	msgs := make(chan map[string]any, 4)
+	if err := decodeDAPStream(&out, msgs); err != nil {
+		t.Fatalf("decode DAP stream: %v", err)
+	}
+	close(msgs)
+	var got []string
+	for msg := range msgs {
+		body, _ := msg["body"].(map[string]any)
+		if msg["event"] != "output" || body["category"] != "stderr" {
+			t.Fatalf("unexpected message: %#v", msg)
+		}
+		got = append(got, body["output"].(string))
+	}
+	if len(got) != 1 || got[0] != "⍝ boot\n" {
+		t.Fatalf("unexpected output events: %q", got)
+	}
+}
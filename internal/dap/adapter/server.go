@@ -1,16 +1,25 @@
 package adapter
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 	"unicode"
+	"unicode/utf16"
 	"unicode/utf8"
 
 	"github.com/stefan/lsp-dap/internal/ride/protocol"
+	"github.com/stefan/lsp-dap/internal/ride/sessionstate"
 	"github.com/stefan/lsp-dap/internal/support/decode"
 )
 
@@ -19,6 +28,16 @@ type Request struct {
 	Seq       int
 	Command   string
 	Arguments any
+	// Admitted, when set, is called once an evaluate has taken its place in the
+	// repl queue (or registered its reply waiter) and is about to wait; callers
+	// running evaluates concurrently block on it to keep arrival order.
+	Admitted func()
+}
+
+func (r Request) admit() {
+	if r.Admitted != nil {
+		r.Admitted()
+	}
 }
 
 // Response is a minimal DAP response envelope.
@@ -49,10 +68,11 @@ type ThreadsResponseBody struct {
 
 // StackFrame represents one DAP stack frame.
 type StackFrame struct {
-	ID     int    `json:"id"`
-	Name   string `json:"name"`
-	Line   int    `json:"line"`
-	Column int    `json:"column"`
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Source *Source `json:"source,omitempty"`
+	Line   int     `json:"line"`
+	Column int     `json:"column"`
 }
 
 // StackTraceResponseBody is returned by DAP stackTrace requests.
@@ -93,6 +113,19 @@ type EvaluateResponseBody struct {
 	VariablesReference int    `json:"variablesReference"`
 }
 
+// CompletionItem is one proposal returned by DAP completions requests.
+type CompletionItem struct {
+	Label  string `json:"label"`
+	Type   string `json:"type,omitempty"`
+	Start  int    `json:"start,omitempty"`
+	Length int    `json:"length,omitempty"`
+}
+
+// CompletionsResponseBody is returned by DAP completions requests.
+type CompletionsResponseBody struct {
+	Targets []CompletionItem `json:"targets"`
+}
+
 // SourceResponseBody is returned by DAP source requests.
 type SourceResponseBody struct {
 	Content  string `json:"content"`
@@ -116,6 +149,22 @@ type PauseResponseBody struct {
 	InterruptMethod string `json:"interruptMethod"`
 }
 
+// SessionInfoResponseBody is returned by the custom dyalog/sessionInfo request.
+type SessionInfoResponseBody struct {
+	Identified      bool            `json:"identified"`
+	ProtocolVersion int             `json:"protocolVersion,omitempty"`
+	APIVersion      int             `json:"apiVersion,omitempty"`
+	Version         string          `json:"version,omitempty"`
+	Edition         string          `json:"edition,omitempty"`
+	Platform        string          `json:"platform,omitempty"`
+	Architecture    string          `json:"architecture,omitempty"`
+	PID             int             `json:"pid,omitempty"`
+	Workspace       string          `json:"workspace,omitempty"`
+	Machine         string          `json:"machine,omitempty"`
+	User            string          `json:"user,omitempty"`
+	Features        map[string]bool `json:"features,omitempty"`
+}
+
 // Capabilities describes the adapter's currently supported DAP feature set.
 type Capabilities struct {
 	SupportsConfigurationDoneRequest  bool `json:"supportsConfigurationDoneRequest"`
@@ -128,6 +177,8 @@ type Capabilities struct {
 	SupportsSetVariable               bool `json:"supportsSetVariable"`
 	SupportsExceptionInfoRequest      bool `json:"supportsExceptionInfoRequest"`
 	SupportsEvaluateForHovers         bool `json:"supportsEvaluateForHovers"`
+	SupportsCompletionsRequest        bool `json:"supportsCompletionsRequest"`
+	SupportsCancelRequest             bool `json:"supportsCancelRequest"`
 }
 
 type serverState int
@@ -141,11 +192,88 @@ const (
 
 const evaluateTimeout = 2 * time.Second
 const localsFetchTimeout = 150 * time.Millisecond
-const localsFetchPollInterval = 5 * time.Millisecond
 const maxLocalValuePreviewRunes = 80
 const maxLocalValueChildren = 32
 const maxLocalSymbolsPerFrame = 64
 
+// Repl display modes select how repl evaluate results are rendered.
+const (
+	// ReplDisplayPlain returns session output as the interpreter prints it.
+	ReplDisplayPlain = "plain"
+	// ReplDisplayBoxed formats each result with ⎕SE.Dyalog.Utils.disp so nested arrays
+	// print with box drawing, leaving the session's own ]Box setting alone.
+	ReplDisplayBoxed = "boxed"
+	// ReplDisplayJSON serialises results with ⎕JSON and returns an expandable tree.
+	ReplDisplayJSON = "json"
+)
+
+// Dialog policies decide who answers interpreter dialogs (OptionsDialog, StringDialog, TaskDialog).
+const (
+	// DialogPolicyPrompt forwards dialogs to the client as dyalog/dialog events.
+	DialogPolicyPrompt = "prompt"
+	// DialogPolicyCancel cancels every dialog, for unattended runs.
+	DialogPolicyCancel = "cancel"
+	// DialogPolicyDefault picks the first choice, or the initial value of a string dialog.
+	DialogPolicyDefault = "default"
+)
+
+// PathMapping relates a source root on the interpreter's machine to the same tree on the
+// client's, for interpreters running remotely or in a container.
+type PathMapping struct {
+	LocalRoot  string
+	RemoteRoot string
+}
+
+// Limits bounds how long the adapter waits for interpreter replies and how much of a
+// value it renders. Zero fields fall back to the package defaults.
+type Limits struct {
+	EvaluateTimeout           time.Duration
+	LocalsFetchTimeout        time.Duration
+	MaxLocalValuePreviewRunes int
+	MaxLocalValueChildren     int
+	MaxLocalSymbolsPerFrame   int
+}
+
+// DefaultLimits returns the limits a new Server starts with.
+func DefaultLimits() Limits {
+	return Limits{
+		EvaluateTimeout:           evaluateTimeout,
+		LocalsFetchTimeout:        localsFetchTimeout,
+		MaxLocalValuePreviewRunes: maxLocalValuePreviewRunes,
+		MaxLocalValueChildren:     maxLocalValueChildren,
+		MaxLocalSymbolsPerFrame:   maxLocalSymbolsPerFrame,
+	}
+}
+
+func (l Limits) withDefaults() Limits {
+	defaults := DefaultLimits()
+	if l.EvaluateTimeout <= 0 {
+		l.EvaluateTimeout = defaults.EvaluateTimeout
+	}
+	if l.LocalsFetchTimeout <= 0 {
+		l.LocalsFetchTimeout = defaults.LocalsFetchTimeout
+	}
+	if l.MaxLocalValuePreviewRunes <= 0 {
+		l.MaxLocalValuePreviewRunes = defaults.MaxLocalValuePreviewRunes
+	}
+	if l.MaxLocalValueChildren <= 0 {
+		l.MaxLocalValueChildren = defaults.MaxLocalValueChildren
+	}
+	if l.MaxLocalSymbolsPerFrame <= 0 {
+		l.MaxLocalSymbolsPerFrame = defaults.MaxLocalSymbolsPerFrame
+	}
+	return l
+}
+
+// cancelledMessage is the DAP error message for requests ended by a cancel request.
+const cancelledMessage = "cancelled"
+
+// SetPromptType values for which the interpreter is waiting on program input.
+const (
+	promptTypeQuadInput      = 2
+	promptTypeQuoteQuadInput = 4
+)
+
 // Server is the DAP adapter entry point.
 type Server struct {
 	mu                 sync.Mutex
@@ -168,38 +296,62 @@ type Server struct {
 	sourceTextByPath   map[string][]string
 	pendingByPath      map[string][]int
 	pendingBySourceRef map[int][]int
+	appliedBySourceRef map[int][]int
 	nextSourceRef      int
 	frameScopeRef      map[int]int
 	variablesByRef     map[int][]Variable
 	nextVariablesRef   int
-	evaluateWaiters    map[int]chan evaluateResult
+	evaluateRequests   map[int]context.CancelFunc
+	completionWaiters  map[int]chan protocol.ReplyGetAutocompleteArgs
+	windowContent      map[int]protocol.WindowContentArgs
+	editWaiters        []editWaiter
+	savesInFlight      map[int]bool
+	schemaWarned       map[string]bool
+	offsetWarned       map[string]bool
 	nextEvaluateToken  int
-	evaluateTimeout    time.Duration
-	replEvaluate       *pendingReplEvaluate
+	limits             Limits
+	hoverAllowlist     map[string]bool
+	replDisplay        string
+	sessionInfo        protocol.SessionInfo
+	sessionInfoSet     bool
+	startMethod        string
+	dialogPolicy       string
+	pathMappings       []PathMapping
+	pendingDialogs     map[int]DialogEventBody
+	replQueue          []*pendingReplEvaluate
+	nextReplEvaluateID int
 	frameSymbols       map[int]frameSymbolsState
-	pendingSymbolTips  map[int]pendingSymbolTip
 	nextSymbolTipToken int
 	promptType         int
 	promptTypeSeen     bool
+	sessionLineTail    string
+	quoteQuadPrompt    string
+	outputGroup        int
 	syntheticThreadIDs map[string]int
 	nextSyntheticID    int
 	pauseFallback      func() error
 }
 
-// RideCommandSender sends mapped control commands to RIDE.
+// RideCommandSender sends mapped control commands to RIDE. Request sends a command and
+// waits for the reply match accepts, as sessionstate.Dispatcher correlates them.
 type RideCommandSender interface {
 	SendCommand(command string, args any) error
+	Request(ctx context.Context, command string, args any, match sessionstate.ReplyMatcher) (protocol.DecodedPayload, error)
 }
 
 type outboundIntentKind string
 
-const outboundIntentDeferredBreakpoints outboundIntentKind = "deferred-breakpoints-apply"
+const (
+	outboundIntentDeferredBreakpoints outboundIntentKind = "deferred-breakpoints-apply"
+	outboundIntentReplExecute         outboundIntentKind = "repl-execute"
+	outboundIntentDialogReply         outboundIntentKind = "dialog-reply"
+)
 
 type outboundCommandIntent struct {
 	controller RideCommandSender
 	kind       outboundIntentKind
 	command    string
-	args       map[string]any
+	args       any
 	token      int
 	sourceRef  int
 	path       string
@@ -217,6 +369,9 @@ type sourceBinding struct {
 	path        string
 	sourceRef   int
 	displayName string
+	// lineOffset is the file line (zero-based) holding the window's first line; it is
+	// non-zero for a method or function traced inside a Link'd class or namespace script.
+	lineOffset int
 }
 
 type setBreakpointsArguments struct {
@@ -231,6 +386,13 @@ type evaluateArguments struct {
 	context    string
 }
 
+type completionsArguments struct {
+	text    string
+	column  int
+	line    int
+	frameID int
+}
+
 type sourceArguments struct {
 	path            string
 	sourceReference int
@@ -256,11 +418,22 @@ type evaluateResult struct {
 type replEvaluateResult struct {
 	text     string
 	canceled bool
+	failure  string
 }
 
+// pendingReplEvaluate is one queued repl evaluate. Only the queue head is ever sent, so
+// session output up to the next input prompt belongs to it.
 type pendingReplEvaluate struct {
-	waiter  chan replEvaluateResult
-	outputs []string
+	id         int
+	requestSeq int
+	expression string
+	waiter     chan replEvaluateResult
+	outputs    []string
+	// group is the session line group RIDE assigned to the echoed input, 0 until seen.
+	group int
+	sent  bool
+	// silent entries capture their session output instead of forwarding it to the client.
+	silent bool
 }
 
 type frameSymbol struct {
@@ -276,14 +449,10 @@ type frameSymbolsState struct {
 	symbols map[string]frameSymbol
 }
 
-type pendingSymbolTip struct {
-	frameID int
-	name    string
-}
-
 type symbolTipRequest struct {
 	token int
-	args  map[string]any
+	name  string
+	args  protocol.GetValueTipArgs
 }
 
 // StoppedEventBody is emitted for DAP stopped events synthesized from RIDE lifecycle signals.
@@ -296,8 +465,60 @@ type StoppedEventBody struct {
 
 // OutputEventBody is emitted for DAP output events synthesized from RIDE diagnostics.
 type OutputEventBody struct {
-	Category string `json:"category,omitempty"`
-	Output   string `json:"output"`
+	Category string  `json:"category,omitempty"`
+	Output   string  `json:"output"`
+	Group    string  `json:"group,omitempty"`
+	Source   *Source `json:"source,omitempty"`
+	Line     int     `json:"line,omitempty"`
+	Column   int     `json:"column,omitempty"`
+	Data     any     `json:"data,omitempty"`
+}
+
+// Source identifies a file or adapter-served source in DAP bodies.
+type Source struct {
+	Name            string `json:"name,omitempty"`
+	Path            string `json:"path,omitempty"`
+	SourceReference int    `json:"sourceReference,omitempty"`
+}
+
+// EditResponseBody is returned by dyalog/edit with the content of the opened editor window.
+// Path is the window's source path: its file, or a dyalog: path for workspace-only entities.
+type EditResponseBody struct {
+	Win        int    `json:"win"`
+	Name       string `json:"name"`
+	Filename   string `json:"filename,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Content    string `json:"content"`
+	EntityType int    `json:"entityType,omitempty"`
+	ReadOnly   bool   `json:"readOnly,omitempty"`
+}
+
+// DialogEventBody is the dyalog/dialog custom event raised for an interpreter dialog.
+// Kind is "options", "string" or "task"; answer it with a dyalog/replyDialog request.
+type DialogEventBody struct {
+	Kind         string   `json:"kind"`
+	Token        int      `json:"token"`
+	Title        string   `json:"title,omitempty"`
+	Text         string   `json:"text,omitempty"`
+	Subtext      string   `json:"subtext,omitempty"`
+	Footer       string   `json:"footer,omitempty"`
+	Type         int      `json:"type,omitempty"`
+	Options      []string `json:"options,omitempty"`
+	ButtonText   []string `json:"buttonText,omitempty"`
+	InitialValue string   `json:"initialValue,omitempty"`
+	DefaultValue string   `json:"defaultValue,omitempty"`
+}
+
+// ProcessEventBody describes the debugged interpreter process.
+type ProcessEventBody struct {
+	Name            string `json:"name"`
+	SystemProcessID int    `json:"systemProcessId,omitempty"`
+	StartMethod     string `json:"startMethod,omitempty"`
+}
+
+// InvalidatedEventBody tells the client which cached views must be refetched.
+type InvalidatedEventBody struct {
+	Areas []string `json:"areas,omitempty"`
 }
 
 // NewServer creates a DAP server instance.
@@ -315,6 +536,8 @@ func NewServer() *Server {
 			SupportsSetVariable:               false,
 			SupportsExceptionInfoRequest:      false,
 			SupportsEvaluateForHovers:         true,
+			SupportsCompletionsRequest:        true,
+			SupportsCancelRequest:             true,
 		},
 		tracerWindows:      map[int]tracerWindowState{},
 		threadCache:        map[int]Thread{},
@@ -328,15 +551,23 @@ func NewServer() *Server {
 		sourceTextByPath:   map[string][]string{},
 		pendingByPath:      map[string][]int{},
 		pendingBySourceRef: map[int][]int{},
+		appliedBySourceRef: map[int][]int{},
 		nextSourceRef:      1,
 		frameScopeRef:      map[int]int{},
 		variablesByRef:     map[int][]Variable{},
 		nextVariablesRef:   1,
-		evaluateWaiters:    map[int]chan evaluateResult{},
+		evaluateRequests:   map[int]context.CancelFunc{},
+		completionWaiters:  map[int]chan protocol.ReplyGetAutocompleteArgs{},
+		windowContent:      map[int]protocol.WindowContentArgs{},
+		savesInFlight:      map[int]bool{},
+		schemaWarned:       map[string]bool{},
+		offsetWarned:       map[string]bool{},
 		nextEvaluateToken:  1,
-		evaluateTimeout:    evaluateTimeout,
+		limits:             DefaultLimits(),
+		replDisplay:        ReplDisplayPlain,
+		dialogPolicy:       DialogPolicyPrompt,
+		pendingDialogs:     map[int]DialogEventBody{},
 		frameSymbols:       map[int]frameSymbolsState{},
-		pendingSymbolTips:  map[int]pendingSymbolTip{},
 		nextSymbolTipToken: 100000,
 		syntheticThreadIDs: map[string]int{},
 		nextSyntheticID:    1000000,
@@ -349,12 +580,208 @@ func (s *Server) SetRideController(controller RideCommandSender) {
 	defer s.mu.Unlock()
 	s.rideController = controller
 	if controller == nil {
-		s.evaluateWaiters = map[int]chan evaluateResult{}
-		s.pendingSymbolTips = map[int]pendingSymbolTip{}
+		s.evaluateRequests = map[int]context.CancelFunc{}
+		s.completionWaiters = map[int]chan protocol.ReplyGetAutocompleteArgs{}
 		s.cancelPendingReplEvaluateLocked()
 	}
 }
 
+// SetLimits replaces the session's evaluate/locals timeouts and value size limits.
+func (s *Server) SetLimits(limits Limits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = limits.withDefaults()
+}
+
+// SetHoverAllowlist sets extra hover expressions, such as ⎕ names or dotted references,
+// that the side-effect guard lets through.
+func (s *Server) SetHoverAllowlist(expressions []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hoverAllowlist = map[string]bool{}
+	for _, expression := range expressions {
+		if key := hoverAllowlistKey(expression); key != "" {
+			s.hoverAllowlist[key] = true
+		}
+	}
+}
+
+// SetReplDisplay selects the repl result rendering: ReplDisplayPlain, ReplDisplayBoxed or
+// ReplDisplayJSON. Unknown modes fall back to plain.
+func (s *Server) SetReplDisplay(mode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch mode {
+	case ReplDisplayBoxed, ReplDisplayJSON:
+		s.replDisplay = mode
+	default:
+		s.replDisplay = ReplDisplayPlain
+	}
+}
+
+// SetProtocolVersion records the RIDE protocol version negotiated during the handshake.
+func (s *Server) SetProtocolVersion(version int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessionInfo.ProtocolVersion = version
+}
+
+// SetStartMethod records how the session reached the interpreter ("launch" or "attach")
+// for the DAP process event.
+func (s *Server) SetStartMethod(method string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.startMethod = method
+}
+
+// SessionInfo returns the interpreter details from its Identify reply, and whether one has arrived.
+func (s *Server) SessionInfo() (protocol.SessionInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessionInfo, s.sessionInfoSet
+}
+
+// supportsLocked gates a feature on the interpreter version. Before Identify has been
+// answered nothing is known, so features stay enabled rather than being hidden.
+func (s *Server) supportsLocked(feature protocol.Feature) bool {
+	return !s.sessionInfoSet || s.sessionInfo.Supports(feature)
+}
+
+// sessionIdentifiedEventsLocked announces the interpreter once its Identify reply arrives:
+// a console line carrying the session info, the DAP process event, and step-back support.
+func (s *Server) sessionIdentifiedEventsLocked() []Event {
+	info := s.sessionInfo
+	summary := "Connected to Dyalog"
+	if info.Version != "" {
+		summary += " " + info.Version
+	}
+	var details []string
+	for _, detail := range []string{info.Platform, info.Arch} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+	if len(details) > 0 {
+		summary += " (" + strings.Join(details, ", ") + ")"
+	}
+	if info.PID > 0 {
+		summary += fmt.Sprintf(", pid %d", info.PID)
+	}
+	if info.Workspace != "" {
+		summary += ", workspace " + info.Workspace
+	}
+
+	events := []Event{{
+		Event: "output",
+		Body: OutputEventBody{
+			Category: "console",
+			Output:   ensureTrailingNewline(summary),
+			Data:     s.sessionInfoBodyLocked(),
+		},
+	}}
+	name := info.Workspace
+	if name == "" {
+		name = "Dyalog APL"
+	}
+	events = append(events, Event{
+		Event: "process",
+		Body: ProcessEventBody{
+			Name:            name,
+			SystemProcessID: info.PID,
+			StartMethod:     s.startMethod,
+		},
+	})
+	// Step back is only advertised once a parsed version proves TraceBackward; unlike the
+	// other gates, an unknown version does not count as support.
+	_, _, versionKnown := info.VersionNumbers()
+	stepBack := versionKnown && info.Supports(protocol.FeatureTraceBackward)
+	if stepBack != s.capabilities.SupportsStepBack {
+		s.capabilities.SupportsStepBack = stepBack
+		events = append(events, Event{
+			Event: "capabilities",
+			Body:  map[string]any{"capabilities": map[string]any{"supportsStepBack": stepBack}},
+		})
+	}
+	return events
+}
+
+func (s *Server) sessionInfoBodyLocked() SessionInfoResponseBody {
+	if !s.sessionInfoSet {
+		return SessionInfoResponseBody{ProtocolVersion: s.sessionInfo.ProtocolVersion}
+	}
+	info := s.sessionInfo
+	features := map[string]bool{}
+	for _, feature := range protocol.Features() {
+		features[string(feature)] = info.Supports(feature)
+	}
+	return SessionInfoResponseBody{
+		Identified:      true,
+		ProtocolVersion: info.ProtocolVersion,
+		APIVersion:      info.APIVersion,
+		Version:         info.Version,
+		Edition:         info.Edition(),
+		Platform:        info.Platform,
+		Architecture:    info.Arch,
+		PID:             info.PID,
+		Workspace:       info.Workspace,
+		Machine:         info.Machine,
+		User:            info.User,
+		Features:        features,
+	}
+}
+
+// hadErrorDescriptionLocked adds the ⎕DMX message to the error text when the interpreter
+// provides ⎕DMX and the text does not already contain it.
+func (s *Server) hadErrorDescriptionLocked(hadError protocol.HadErrorArgs) string {
+	description := hadError.ErrorText
+	if !s.supportsLocked(protocol.FeatureDMX) {
+		return description
+	}
+	dmx, ok := hadError.DMX.(map[string]any)
+	if !ok {
+		return description
+	}
+	message := strings.TrimSpace(stringFromAny(dmx["Message"]))
+	if message == "" || strings.Contains(description, message) {
+		return description
+	}
+	if description == "" {
+		return message
+	}
+	return description + ": " + message
+}
+
+// SetPathMappings sets the localRoot/remoteRoot pairs used to translate interpreter file
+// paths for the client and back. Sources are keyed internally by interpreter path.
+func (s *Server) SetPathMappings(mappings []PathMapping) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pathMappings = append([]PathMapping{}, mappings...)
+}
+
+// localPathLocked maps an interpreter path to the client's disk.
+func (s *Server) localPathLocked(path string) string {
+	return mapPathRoots(path, s.pathMappings, func(m PathMapping) (string, string) { return m.RemoteRoot, m.LocalRoot })
+}
+
+// remotePathLocked maps a client path to the interpreter's disk.
+func (s *Server) remotePathLocked(path string) string {
+	return mapPathRoots(path, s.pathMappings, func(m PathMapping) (string, string) { return m.LocalRoot, m.RemoteRoot })
+}
+
+// SetDialogPolicy selects how interpreter dialogs are answered: DialogPolicyPrompt,
+// DialogPolicyCancel or DialogPolicyDefault. Unknown policies fall back to prompt.
+func (s *Server) SetDialogPolicy(policy string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch policy {
+	case DialogPolicyCancel, DialogPolicyDefault:
+		s.dialogPolicy = policy
+	default:
+		s.dialogPolicy = DialogPolicyPrompt
+	}
+}
+
 // SetActiveTracerWindow sets the current tracer window id used for step/continue commands.
 func (s *Server) SetActiveTracerWindow(win int) {
 	s.mu.Lock()
@@ -388,13 +815,45 @@ func (s *Server) HandleRideReconnect() []Event {
 
 	s.state = stateAttachedOrLaunched
 	s.resetRuntimeStateForReconnect()
+	s.requeueAppliedBreakpointsLocked()
 	s.requestWindowLayoutSync()
 
 	return []Event{
 		newOutputEvent("console", "RIDE reconnected; rebuilding window layout"),
+		{
+			Event: "invalidated",
+			Body:  InvalidatedEventBody{Areas: []string{"threads", "stacks", "variables"}},
+		},
+	}
+}
+
+// HandleRideConnectionLost terminates the session after the RIDE connection could not be restored.
+func (s *Server) HandleRideConnectionLost(cause error) []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == stateCreated || s.state == stateTerminated {
+		return nil
+	}
+
+	s.terminateSessionFromRide()
+	message := "RIDE connection lost"
+	if cause != nil {
+		message = fmt.Sprintf("RIDE connection lost: %v", cause)
+	}
+	return []Event{
+		newOutputEvent("stderr", message),
+		{Event: "terminated", Body: map[string]any{}},
 	}
 }
 
+// SessionTerminated reports whether the DAP session has ended.
+func (s *Server) SessionTerminated() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state == stateTerminated
+}
+
 // ResolveSourceReferenceForToken returns the DAP source reference bound to a RIDE token.
 func (s *Server) ResolveSourceReferenceForToken(token int) (int, bool) {
 	s.mu.Lock()
@@ -421,10 +880,22 @@ func (s *Server) HandleRequest(req Request) (Response, []Event) {
 		return s.handleEvaluateRequest(req), nil
 	case "source":
 		return s.handleSourceRequest(req), nil
+	case "completions":
+		return s.handleCompletionsRequest(req), nil
+	case "cancel":
+		return s.handleCancelRequest(req), nil
 	case "scopes":
 		return s.handleScopesRequest(req), nil
 	case "setBreakpoints":
 		return s.handleSetBreakpointsRequest(req)
+	case "dyalog/edit":
+		return s.handleEditRequest(req), nil
+	case "dyalog/saveChanges":
+		return s.handleSaveChangesRequest(req), nil
+	case "threads":
+		return s.handleThreadsRequest(req), nil
+	case "stackTrace":
+		return s.handleStackTraceRequest(req), nil
 	}
 
 	s.mu.Lock()
@@ -466,12 +937,14 @@ func (s *Server) HandleRequest(req Request) (Response, []Event) {
 		s.state = stateTerminated
 		return s.success(req), nil
 
-	case "continue", "next", "stepIn", "stepOut", "pause":
+	case "continue", "next", "stepIn", "stepOut", "stepBack", "pause":
 		return s.handleControlCommand(req), nil
-	case "threads":
-		return s.handleThreadsRequest(req), nil
-	case "stackTrace":
-		return s.handleStackTraceRequest(req), nil
+	case "dyalog/sessionInfo":
+		return s.successWithBody(req, s.sessionInfoBodyLocked()), nil
+	case "dyalog/replyDialog":
+		return s.handleReplyDialogRequest(req), nil
+	case "dyalog/closeWindow":
+		return s.handleCloseWindowRequest(req), nil
 	case "variables":
 		return s.handleVariablesRequest(req), nil
 
@@ -497,9 +970,14 @@ func (s *Server) handleControlCommand(req Request) Response {
 		return s.sendWindowCommand(req, "StepInto")
 	case "stepOut":
 		return s.sendWindowCommand(req, "ContinueTrace")
+	case "stepBack":
+		if !s.capabilities.SupportsStepBack {
+			return s.failure(req, fmt.Sprintf("stepBack needs TraceBackward (Dyalog %s or later, as reported by Identify)", protocol.MinVersion(protocol.FeatureTraceBackward)))
+		}
+		return s.sendWindowCommand(req, "TraceBackward")
 	case "pause":
-		if err := s.rideController.SendCommand("WeakInterrupt", map[string]any{}); err != nil {
-			if strongErr := s.rideController.SendCommand("StrongInterrupt", map[string]any{}); strongErr == nil {
+		if err := s.rideController.SendCommand("WeakInterrupt", protocol.EmptyArgs{}); err != nil {
+			if strongErr := s.rideController.SendCommand("StrongInterrupt", protocol.EmptyArgs{}); strongErr == nil {
 				return s.successWithBody(req, PauseResponseBody{InterruptMethod: "strong"})
 			}
 			if s.pauseFallback != nil {
@@ -519,24 +997,56 @@ func (s *Server) sendWindowCommand(req Request, rideCommand string) Response {
 	if !s.activeTracerSet {
 		return s.failure(req, "no active tracer window")
 	}
-	if err := s.rideController.SendCommand(rideCommand, map[string]any{
-		"win": s.activeTracerWindow,
-	}); err != nil {
+	if err := s.rideController.SendCommand(rideCommand, protocol.WindowArgs{Win: s.activeTracerWindow}); err != nil {
 		return s.failure(req, "failed to send mapped RIDE control command")
 	}
 	return s.success(req)
 }
 
+// handleThreadsRequest refreshes the thread list with GetThreads. While the interpreter
+// is busy the command would only be queued, so the cached list is returned and the reply
+// updates it later; a refresh not answered within the locals fetch timeout does the same.
 func (s *Server) handleThreadsRequest(req Request) Response {
+	s.mu.Lock()
+	if s.state == stateTerminated {
+		s.mu.Unlock()
+		return s.failure(req, "session already terminated")
+	}
 	if s.state != stateAttachedOrLaunched {
+		s.mu.Unlock()
 		return s.failure(req, "threads requires launch or attach")
 	}
 	if s.rideController == nil {
+		s.mu.Unlock()
 		return s.failure(req, "no RIDE controller configured")
 	}
-	if err := s.rideController.SendCommand("GetThreads", map[string]any{}); err != nil {
-		return s.failure(req, "failed to request threads from RIDE")
+	controller := s.rideController
+	busy := s.promptTypeSeen && s.promptType == 0
+	timeout := s.limits.LocalsFetchTimeout
+	s.mu.Unlock()
+
+	if busy {
+		if err := controller.SendCommand("GetThreads", protocol.GetThreadsArgs{}); err != nil {
+			return s.failure(req, "failed to request threads from RIDE")
+		}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		reply, err := s.requestReply(ctx, controller, "GetThreads", protocol.GetThreadsArgs{}, sessionstate.MatchCommand("ReplyGetThreads"))
+		cancel()
+		switch {
+		case err == nil:
+			if threads, ok := extractReplyGetThreads(reply.Args); ok {
+				s.mu.Lock()
+				s.updateThreadCache(threads)
+				s.mu.Unlock()
+			}
+		case !errors.Is(err, errRequestTimedOut):
+			return s.failure(req, "failed to request threads from RIDE")
+		}
 	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return Response{
 		RequestSeq: req.Seq,
 		Command:    req.Command,
@@ -547,16 +1057,44 @@ func (s *Server) handleThreadsRequest(req Request) Response {
 	}
 }
 
+// handleStackTraceRequest builds frames from the open tracer windows, named from a fresh
+// GetSIStack when the interpreter answers in time and from the last known SI stack otherwise.
 func (s *Server) handleStackTraceRequest(req Request) Response {
+	s.mu.Lock()
+	if s.state == stateTerminated {
+		s.mu.Unlock()
+		return s.failure(req, "session already terminated")
+	}
 	if s.state != stateAttachedOrLaunched {
+		s.mu.Unlock()
 		return s.failure(req, "stackTrace requires launch or attach")
 	}
 
 	threadID := extractThreadIDArgument(req.Arguments)
 	if threadID <= 0 {
+		s.mu.Unlock()
 		return s.failure(req, "stackTrace requires threadId")
 	}
+	controller := s.rideController
+	busy := s.promptTypeSeen && s.promptType == 0
+	timeout := s.limits.LocalsFetchTimeout
+	s.mu.Unlock()
+
+	if controller != nil && !busy {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		reply, err := s.requestReply(ctx, controller, "GetSIStack", protocol.GetSIStackArgs{}, sessionstate.MatchCommand("ReplyGetSIStack"))
+		cancel()
+		if err == nil {
+			if stack, ok := extractReplyGetSIStack(reply.Args); ok {
+				s.mu.Lock()
+				s.rememberSIStackLocked(stack)
+				s.mu.Unlock()
+			}
+		}
+	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	frames := s.buildStackFramesForThread(threadID)
 	return Response{
 		RequestSeq: req.Seq,
@@ -585,6 +1123,7 @@ func (s *Server) handleSetBreakpointsRequest(req Request) (Response, []Event) {
 		s.mu.Unlock()
 		return s.failure(req, "setBreakpoints requires source and breakpoints"), nil
 	}
+	args.path = s.remotePathLocked(args.path)
 
 	token, mapped := s.resolveTokenForSetBreakpoints(args)
 	controller := s.rideController
@@ -607,14 +1146,15 @@ func (s *Server) handleSetBreakpointsRequest(req Request) (Response, []Event) {
 				newOutputEvent("console", fmt.Sprintf("breakpoints pending (%s): %v", breakpointSourceLabel(args), args.lines)),
 			}
 	}
+	stop := s.windowStopLinesLocked(token, args.lines)
+	responses := s.mappedBreakpointResponsesLocked(token, args.lines)
 	s.mu.Unlock()
 
-	stop := zeroBasedLines(args.lines)
-	if err := controller.SendCommand("SetLineAttributes", map[string]any{
-		"win":     token,
-		"stop":    stop,
-		"monitor": []int{},
-		"trace":   []int{},
+	if err := controller.SendCommand("SetLineAttributes", protocol.SetLineAttributesArgs{
+		Win:     token,
+		Stop:    stop,
+		Monitor: []int{},
+		Trace:   []int{},
 	}); err != nil {
 		return s.failure(req, "failed to send SetLineAttributes"), []Event{
 			newOutputEvent("stderr", fmt.Sprintf("breakpoints apply failed (%s): %v", breakpointSourceLabel(args), err)),
@@ -622,6 +1162,9 @@ func (s *Server) handleSetBreakpointsRequest(req Request) (Response, []Event) {
 	}
 	s.mu.Lock()
 	s.clearDeferredBreakpoints(args)
+	if binding, ok := s.sourceByToken[token]; ok {
+		s.recordAppliedBreakpointsLocked(binding.sourceRef, args.lines)
+	}
 	s.mu.Unlock()
 
 	return Response{
@@ -629,7 +1172,7 @@ func (s *Server) handleSetBreakpointsRequest(req Request) (Response, []Event) {
 			Command:    req.Command,
 			Success:    true,
 			Body: SetBreakpointsResponseBody{
-				Breakpoints: buildBreakpointResponses(args.lines, true, "Active: mapped to current source window."),
+				Breakpoints: responses,
 			},
 		}, []Event{
 			newOutputEvent("console", fmt.Sprintf("breakpoints active (token=%d): %v", token, args.lines)),
@@ -654,21 +1197,10 @@ func (s *Server) handleScopesRequest(req Request) Response {
 	s.refreshFrameSymbolsLocked(frameID)
 	controller := s.rideController
 	requests := s.prepareSymbolTipRequestsLocked(frameID)
+	fetchTimeout := s.limits.LocalsFetchTimeout
 	s.mu.Unlock()
 
-	for _, request := range requests {
-		if controller == nil {
-			break
-		}
-		if err := controller.SendCommand("GetValueTip", request.args); err != nil {
-			s.mu.Lock()
-			delete(s.pendingSymbolTips, request.token)
-			s.mu.Unlock()
-		}
-	}
-	if len(requests) > 0 {
-		s.waitForSymbolTipRequests(frameID, localsFetchTimeout)
-	}
+	s.fetchSymbolTips(controller, frameID, requests, fetchTimeout)
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -739,44 +1271,98 @@ func (s *Server) handleEvaluateRequest(req Request) Response {
 		s.mu.Unlock()
 		return s.failure(req, "interpreter is busy; watch/hover evaluate requires ready prompt")
 	}
-
-	timeout := s.evaluateTimeout
-	if timeout <= 0 {
-		timeout = evaluateTimeout
+	if s.awaitingInputLocked() && context != "repl" {
+		s.mu.Unlock()
+		return s.failure(req, "interpreter is waiting for ⎕/⍞ input; answer it from the Debug Console")
+	}
+	switch context {
+	case "hover":
+		if err := checkHoverExpression(args.expression, s.hoverAllowlist); err != nil {
+			s.mu.Unlock()
+			return s.failure(req, "hover evaluate refused: "+err.Error())
+		}
+	case "watch":
+		if err := checkWatchExpression(args.expression); err != nil {
+			s.mu.Unlock()
+			return s.failure(req, "watch evaluate refused: "+err.Error())
+		}
 	}
+
+	timeout := s.limits.EvaluateTimeout
 	controller := s.rideController
 
-	if context == "repl" {
-		if s.replEvaluate != nil {
+	// GetValueTip only understands a single name; other watch expressions run via Execute.
+	watchViaExecute := context == "watch" && !isSymbolName(strings.TrimSpace(args.expression))
+	if watchViaExecute {
+		if strings.ContainsAny(strings.TrimRight(args.expression, "\n"), "\r\n") {
+			s.mu.Unlock()
+			return s.failure(req, "watch expression must be a single line")
+		}
+		if args.frameID > 0 && s.activeTracerSet && args.frameID != s.activeTracerWindow {
 			s.mu.Unlock()
-			return s.failure(req, "repl evaluate already in progress")
+			return s.failure(req, "watch expressions are evaluated in the top stack frame; select it or watch a single name")
 		}
+	}
 
+	if context == "repl" || watchViaExecute {
+		// Repl evaluates queue up FIFO; each Execute goes out once the previous one has
+		// returned to a prompt, so every request gets its own session output.
 		waiter := make(chan replEvaluateResult, 1)
-		s.replEvaluate = &pendingReplEvaluate{
-			waiter: waiter,
+		pending := &pendingReplEvaluate{
+			id:         s.nextReplEvaluateID,
+			requestSeq: req.Seq,
+			expression: args.expression,
+			waiter:     waiter,
+		}
+		display := ReplDisplayPlain
+		if context == "repl" && !s.awaitingInputLocked() && !isSessionCommand(args.expression) {
+			display = s.replDisplay
+		}
+		if display != ReplDisplayPlain && strings.ContainsAny(strings.TrimRight(args.expression, "\n"), "\r\n") {
+			// Only a single expression can be wrapped for display; pasted blocks run as typed.
+			display = ReplDisplayPlain
+		}
+		if display == ReplDisplayJSON && !s.supportsLocked(protocol.FeatureJSONHighRank) {
+			display = ReplDisplayPlain
 		}
+		switch {
+		case watchViaExecute:
+			pending.expression = watchCaptureExpression(args.expression)
+			pending.silent = true
+		case display == ReplDisplayJSON:
+			pending.expression = replJSONExpression(args.expression)
+			pending.silent = true
+		case display == ReplDisplayBoxed:
+			pending.expression = replBoxedExpression(args.expression)
+			pending.silent = true
+		}
+		s.nextReplEvaluateID++
+		s.replQueue = append(s.replQueue, pending)
+		intent, send := s.nextReplExecuteIntentLocked()
 		s.mu.Unlock()
+		req.admit()
 
-		text := args.expression
-		if !strings.HasSuffix(text, "\n") {
-			text += "\n"
-		}
-		if err := controller.SendCommand("Execute", map[string]any{
-			"text":  text,
-			"trace": 0,
-		}); err != nil {
-			s.mu.Lock()
-			s.clearPendingReplEvaluateLocked()
-			s.mu.Unlock()
-			return s.failure(req, "failed to send Execute")
+		if send {
+			s.executeOutboundIntents([]outboundCommandIntent{intent})
 		}
 
 		select {
 		case result := <-waiter:
+			if result.failure != "" {
+				return s.failure(req, result.failure)
+			}
 			if result.canceled {
 				return s.failure(req, "repl evaluate canceled before interpreter returned to prompt")
 			}
+			if watchViaExecute {
+				return s.watchExecuteResponse(req, result.text)
+			}
+			if display == ReplDisplayJSON {
+				return s.replJSONResponse(req, trimReplNoResult(result.text))
+			}
+			if display == ReplDisplayBoxed {
+				result.text = trimReplNoResult(result.text)
+			}
 			return s.successWithBody(req, EvaluateResponseBody{
 				Result:             strings.TrimRight(result.text, "\n"),
 				Type:               "string",
@@ -784,7 +1370,7 @@ func (s *Server) handleEvaluateRequest(req Request) Response {
 			})
 		case <-time.After(timeout):
 			s.mu.Lock()
-			s.clearPendingReplEvaluateLocked()
+			s.removeReplEvaluateLocked(pending.id)
 			s.mu.Unlock()
 			return s.failure(req, evaluateTimeoutMessage(context))
 		}
@@ -801,92 +1387,694 @@ func (s *Server) handleEvaluateRequest(req Request) Response {
 
 	token := s.nextEvaluateToken
 	s.nextEvaluateToken++
-	waiter := make(chan evaluateResult, 1)
-	s.evaluateWaiters[token] = waiter
 	s.mu.Unlock()
-
-	if err := controller.SendCommand("GetValueTip", map[string]any{
-		"win":       win,
-		"line":      args.expression,
-		"pos":       len([]rune(args.expression)),
-		"maxWidth":  200,
-		"maxHeight": 200,
-		"token":     token,
-	}); err != nil {
-		s.mu.Lock()
-		delete(s.evaluateWaiters, token)
-		s.mu.Unlock()
+	req.admit()
+
+	result, err := s.requestValueTip(req.Seq, controller, protocol.GetValueTipArgs{
+		Win:       win,
+		Line:      args.expression,
+		Pos:       len([]rune(args.expression)),
+		MaxWidth:  200,
+		MaxHeight: 200,
+		Token:     token,
+	}, timeout)
+	switch {
+	case errors.Is(err, errRequestCancelled):
+		return s.failure(req, cancelledMessage)
+	case errors.Is(err, errRequestTimedOut):
+		return s.failure(req, evaluateTimeoutMessage(context))
+	case err != nil:
 		return s.failure(req, "failed to send GetValueTip")
 	}
+	return s.successWithBody(req, evaluateResultToBody(result))
+}
 
-	select {
-	case result := <-waiter:
-		return s.successWithBody(req, evaluateResultToBody(result))
-	case <-time.After(timeout):
+// requestValueTip fetches a watch/hover value with GetValueTip. The request can be
+// cancelled by DAP seq until it is answered.
+func (s *Server) requestValueTip(seq int, controller RideCommandSender, args protocol.GetValueTipArgs, timeout time.Duration) (evaluateResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	s.mu.Lock()
+	s.evaluateRequests[seq] = cancel
+	s.mu.Unlock()
+	defer func() {
 		s.mu.Lock()
-		delete(s.evaluateWaiters, token)
+		delete(s.evaluateRequests, seq)
 		s.mu.Unlock()
-		return s.failure(req, evaluateTimeoutMessage(context))
-	}
-}
+	}()
 
-func normalizeEvaluateContext(context string) string {
-	normalized := strings.TrimSpace(strings.ToLower(context))
-	if normalized == "" {
-		return "repl"
+	reply, err := s.requestReply(ctx, controller, "GetValueTip", args, sessionstate.MatchToken("ValueTip", args.Token))
+	if err != nil {
+		return evaluateResult{}, err
 	}
-	return normalized
+	valueTip, _ := extractValueTip(reply.Args)
+	return evaluateResult{
+		text:  strings.Join(valueTip.tip, "\n"),
+		class: valueTip.class,
+	}, nil
 }
 
-func evaluateResultToBody(result evaluateResult) EvaluateResponseBody {
-	typeName := "string"
-	if result.class != 0 {
-		typeName = fmt.Sprintf("nameclass(%d)", result.class)
-	}
-	return EvaluateResponseBody{
-		Result:             result.text,
-		Type:               typeName,
-		VariablesReference: 0,
+var (
+	errRequestCancelled = errors.New("request cancelled")
+	errRequestTimedOut  = errors.New("request timed out")
+)
+
+// requestReply sends command through the controller and waits, without s.mu held, for
+// the reply match accepts. Cancellation and timeout are reported as errRequestCancelled
+// and errRequestTimedOut.
+func (s *Server) requestReply(ctx context.Context, controller RideCommandSender, command string, args any, match sessionstate.ReplyMatcher) (protocol.DecodedPayload, error) {
+	reply, err := controller.Request(ctx, command, args, match)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return reply, fmt.Errorf("%w: %s", errRequestCancelled, command)
+	case errors.Is(err, context.DeadlineExceeded):
+		return reply, fmt.Errorf("%w: %s", errRequestTimedOut, command)
 	}
+	return reply, err
 }
 
-func evaluateTimeoutMessage(context string) string {
-	switch context {
-	case "watch":
-		return "timed out waiting for ValueTip in watch context; ensure interpreter is paused and expression is in scope"
-	case "hover":
-		return "timed out waiting for ValueTip in hover context; ensure interpreter is paused and symbol is in scope"
-	case "repl":
-		return "timed out waiting for Execute completion in repl context; ensure interpreter returns to prompt"
-	default:
-		return "timed out waiting for ValueTip"
+// handleCancelRequest cancels a pending evaluate by DAP request seq. A running repl
+// evaluate is interrupted with WeakInterrupt; queued repl and watch/hover evaluates are
+// dropped without touching the interpreter. Unknown request ids succeed, since the
+// request may already have completed.
+func (s *Server) handleCancelRequest(req Request) Response {
+	requestID, ok := extractCancelRequestID(req.Arguments)
+	if !ok {
+		return s.failure(req, "cancel requires requestId")
 	}
-}
 
-func (s *Server) handleSourceRequest(req Request) Response {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	var interrupt RideCommandSender
+	for _, pending := range s.replQueue {
+		if pending.requestSeq != requestID {
+			continue
+		}
+		if pending.sent {
+			interrupt = s.rideController
+		}
+		s.failReplEvaluateLocked(pending.id, cancelledMessage)
+		break
+	}
+	if cancel, exists := s.evaluateRequests[requestID]; exists {
+		delete(s.evaluateRequests, requestID)
+		cancel()
+	}
+	s.mu.Unlock()
+
+	if interrupt != nil {
+		// The interpreter returns to a prompt once interrupted, which releases the next queued evaluate.
+		if err := interrupt.SendCommand("WeakInterrupt", protocol.EmptyArgs{}); err != nil {
+			return s.failure(req, "failed to send WeakInterrupt")
+		}
+	}
+	return s.success(req)
+}
+
+// hoverSafeSystemNames are ⎕ names whose value can be shown without side effects.
+var hoverSafeSystemNames = map[string]bool{
+	"⎕A": true, "⎕AI": true, "⎕AN": true, "⎕AV": true, "⎕CT": true, "⎕D": true,
+	"⎕DCT": true, "⎕DIV": true, "⎕DM": true, "⎕DMX": true, "⎕EN": true, "⎕FR": true,
+	"⎕IO": true, "⎕LC": true, "⎕LX": true, "⎕ML": true, "⎕NSI": true, "⎕PATH": true,
+	"⎕PP": true, "⎕PW": true, "⎕RL": true, "⎕RTL": true, "⎕SI": true, "⎕TID": true,
+	"⎕TNUMS": true, "⎕TS": true, "⎕USING": true, "⎕WSID": true, "⎕XSI": true,
+}
+
+// checkHoverExpression reports why a hovered expression could change interpreter state.
+// Hover only ever inspects a single name with GetValueTip: assignments, calls and
+// primitives are refused, as are ⎕ names outside hoverSafeSystemNames, unless allowlisted.
+func checkHoverExpression(expression string, allowlist map[string]bool) error {
+	trimmed := strings.TrimSpace(expression)
+	if allowlist[hoverAllowlistKey(trimmed)] {
+		return nil
+	}
+	switch {
+	case trimmed == "":
+		return errors.New("empty expression")
+	case strings.ContainsRune(trimmed, '←'):
+		return errors.New("assignment may have side effects")
+	case strings.HasPrefix(trimmed, "⎕"):
+		if isSymbolName(trimmed) && hoverSafeSystemNames[strings.ToUpper(trimmed)] {
+			return nil
+		}
+		return fmt.Errorf("%s may have side effects; add it to hoverAllowlist to permit it", trimmed)
+	case isSymbolName(trimmed) && !strings.ContainsRune(trimmed, '⎕'):
+		return nil
+	default:
+		return errors.New("only single names are evaluated on hover; add the expression to hoverAllowlist to permit it")
+	}
+}
+
+// checkWatchExpression reports why a watch expression could change interpreter state.
+// Watches re-run on every stop, so assignments, ⍎, ⎕/⍞ input and ⎕ names outside
+// hoverSafeSystemNames (⎕FX, ⎕NDELETE, ⎕SH, ...) are refused; other expressions, such
+// as +/x or obj.Prop, are evaluated. ⍺, ⍵ and ∇ are refused too, as the Execute wrapper
+// would answer with its own rather than the suspended dfn's. Quoted text and comments
+// are not inspected.
+func checkWatchExpression(expression string) error {
+	if strings.TrimSpace(expression) == "" {
+		return errors.New("empty expression")
+	}
+	code := aplCodeOutsideQuotes(expression)
+	if isSessionCommand(expression) {
+		return errors.New("system and user commands cannot be watched")
+	}
+	if strings.ContainsRune(code, '←') {
+		return errors.New("assignment may have side effects")
+	}
+	if strings.ContainsRune(code, '⍎') {
+		return errors.New("⍎ may have side effects")
+	}
+	if strings.ContainsRune(code, '⍞') {
+		return errors.New("⍞ reads input")
+	}
+	if strings.ContainsAny(code, "⍺⍵∇") {
+		return errors.New("⍺, ⍵ and ∇ cannot be watched as part of an expression; watch the dfn's locals instead")
+	}
+	for _, name := range systemNamesIn(code) {
+		if name == "⎕" {
+			return errors.New("⎕ reads input")
+		}
+		if !hoverSafeSystemNames[name] {
+			return fmt.Errorf("%s may have side effects", name)
+		}
+	}
+	return nil
+}
+
+// aplCodeOutsideQuotes returns expression with quoted strings blanked and any ⍝ comment
+// dropped, so guards only look at code.
+func aplCodeOutsideQuotes(expression string) string {
+	var code strings.Builder
+	quoted := false
+	for _, r := range expression {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+			code.WriteRune(' ')
+		case quoted:
+			code.WriteRune(' ')
+		case r == '⍝':
+			return code.String()
+		default:
+			code.WriteRune(r)
+		}
+	}
+	return code.String()
+}
+
+// systemNamesIn lists the upper-cased ⎕ names in code; a lone ⎕ is listed as "⎕".
+func systemNamesIn(code string) []string {
+	var names []string
+	runes := []rune(code)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '⎕' {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+			end++
+		}
+		names = append(names, strings.ToUpper(string(runes[i:end])))
+		i = end - 1
+	}
+	return names
+}
+
+// hoverAllowlistKey normalises allowlist entries; ⎕ names are case-insensitive in Dyalog.
+func hoverAllowlistKey(expression string) string {
+	trimmed := strings.TrimSpace(expression)
+	if strings.HasPrefix(trimmed, "⎕") {
+		return strings.ToUpper(trimmed)
+	}
+	return trimmed
+}
+
+// isSessionCommand reports whether a repl line is a )system or ]user command, which
+// cannot be wrapped in an expression.
+func isSessionCommand(expression string) bool {
+	trimmed := strings.TrimSpace(expression)
+	return strings.HasPrefix(trimmed, ")") || strings.HasPrefix(trimmed, "]")
+}
+
+// replNoResultMarker is what a wrapped repl expression displays when the expression
+// has no result, such as a call to a niladic procedure.
+const replNoResultMarker = "⍙dapNoResult"
+
+// replDisplayExpression runs a repl expression with 85⌶, which signals 85 instead of
+// VALUE ERROR when there is no result, and formats the result with format. Other
+// errors in the expression suspend as usual.
+func replDisplayExpression(format, expression string) string {
+	quoted := strings.ReplaceAll(strings.TrimSpace(expression), "'", "''")
+	return fmt.Sprintf("{85::'%s' ⋄ r←1(85⌶)⍵ ⋄ %s}'%s'", replNoResultMarker, format, quoted)
+}
+
+// replJSONExpression serialises the result of a repl expression with ⎕JSON; values
+// ⎕JSON cannot represent are displayed as they are.
+func replJSONExpression(expression string) string {
+	return replDisplayExpression("0::r ⋄ 1(⎕JSON⍠'HighRank' 'Split')r", expression)
+}
+
+// replBoxedExpression boxes the result of a repl expression for display.
+func replBoxedExpression(expression string) string {
+	return replDisplayExpression("⎕SE.Dyalog.Utils.disp r", expression)
+}
+
+// trimReplNoResult drops the no-result marker, keeping any output the expression
+// printed itself.
+func trimReplNoResult(text string) string {
+	trimmed := strings.TrimRight(text, "\n")
+	if !strings.HasSuffix(trimmed, replNoResultMarker) {
+		return text
+	}
+	return strings.TrimSuffix(trimmed, replNoResultMarker)
+}
+
+// replJSONResponse builds an expandable variables tree from a ⎕JSON repl result. Output
+// that is not a JSON document, such as an error report, is returned as plain text.
+func (s *Server) replJSONResponse(req Request, text string) Response {
+	text = strings.TrimRight(text, "\n")
+	value, err := decodeOrderedJSON(text)
+	if err != nil {
+		return s.successWithBody(req, EvaluateResponseBody{
+			Result:             text,
+			Type:               "string",
+			VariablesReference: 0,
+		})
+	}
+
+	s.mu.Lock()
+	root := s.jsonVariableLocked("", value)
+	s.mu.Unlock()
+	return s.successWithBody(req, EvaluateResponseBody{
+		Result:             root.Value,
+		Type:               root.Type,
+		VariablesReference: root.VariablesReference,
+	})
+}
+
+// jsonMember is one field of a decoded JSON object; objects keep their field order.
+type jsonMember struct {
+	name  string
+	value any
+}
+
+// decodeOrderedJSON decodes a single JSON document into []jsonMember objects, []any
+// arrays and json.Number/string/bool/nil scalars.
+func decodeOrderedJSON(text string) (any, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	value, err := decodeJSONValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("trailing data after JSON value")
+	}
+	return value, nil
+}
+
+func decodeJSONValue(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+	switch delim {
+	case '{':
+		members := []jsonMember{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, jsonMember{name: fmt.Sprint(key), value: value})
+		}
+		_, err = decoder.Token()
+		return members, err
+	case '[':
+		items := []any{}
+		for decoder.More() {
+			value, err := decodeJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		_, err = decoder.Token()
+		return items, err
+	default:
+		return nil, fmt.Errorf("unexpected JSON delimiter %q", delim)
+	}
+}
+
+// jsonVariableLocked renders a decoded JSON value as a variable, allocating references
+// for object fields and array items up to MaxLocalValueChildren per level.
+func (s *Server) jsonVariableLocked(name string, value any) Variable {
+	variable := Variable{Name: name}
+	var children []Variable
+	switch v := value.(type) {
+	case []jsonMember:
+		variable.Value = fmt.Sprintf("{%d fields}", len(v))
+		variable.Type = "object"
+		for i, member := range v {
+			if i == s.limits.MaxLocalValueChildren {
+				break
+			}
+			children = append(children, s.jsonVariableLocked(member.name, member.value))
+		}
+		children = appendMoreEntriesVariable(children, len(v)-s.limits.MaxLocalValueChildren)
+	case []any:
+		variable.Value = fmt.Sprintf("[%d items]", len(v))
+		variable.Type = "array"
+		for i, item := range v {
+			if i == s.limits.MaxLocalValueChildren {
+				break
+			}
+			children = append(children, s.jsonVariableLocked(fmt.Sprintf("[%d]", i), item))
+		}
+		children = appendMoreEntriesVariable(children, len(v)-s.limits.MaxLocalValueChildren)
+	case string:
+		encoded, _ := json.Marshal(v)
+		variable.Value = truncateRunes(string(encoded), s.limits.MaxLocalValuePreviewRunes)
+		variable.Type = "string"
+	case json.Number:
+		variable.Value = v.String()
+		variable.Type = "number"
+	case bool:
+		variable.Value = fmt.Sprint(v)
+		variable.Type = "boolean"
+	default:
+		variable.Value = "null"
+		variable.Type = "null"
+	}
+	if len(children) > 0 {
+		variable.VariablesReference = s.allocateVariablesReference(children)
+	}
+	return variable
+}
 
+func appendMoreEntriesVariable(children []Variable, more int) []Variable {
+	if more <= 0 {
+		return children
+	}
+	return append(children, Variable{
+		Name:               "[...]",
+		Value:              fmt.Sprintf("%d more entries", more),
+		Type:               "string",
+		VariablesReference: 0,
+	})
+}
+
+// watchErrorMarker prefixes the error text watchCaptureExpression displays when the
+// watched expression fails.
+const watchErrorMarker = "⍙dapWatchError: "
+
+// watchTrappedErrors are the error numbers a failing watch expression reports rather than
+// suspending on: SYNTAX, INDEX, RANK, LENGTH, VALUE, FORMAT, DOMAIN and NONCE ERROR.
+// Interrupts and resource errors such as WS FULL still reach the interpreter.
+const watchTrappedErrors = "2 3 4 5 6 7 11 16"
+
+// watchCaptureExpression wraps a watch expression so it runs in the suspended frame with
+// the usual expression errors trapped: a failing expression displays a marked error line
+// instead of suspending the interpreter again. checkWatchExpression keeps ⍺ and ⍵ out,
+// as they would name the wrapper's own arguments.
+func watchCaptureExpression(expression string) string {
+	quoted := strings.ReplaceAll(strings.TrimSpace(expression), "'", "''")
+	return fmt.Sprintf("{%s::'%s',⊃⎕DM ⋄ ⍎⍵}'%s'", watchTrappedErrors, watchErrorMarker, quoted)
+}
+
+// watchExecuteResponse turns the captured display form of a watch expression into an
+// evaluate result, with multi-line or long values expandable like locals.
+func (s *Server) watchExecuteResponse(req Request, text string) Response {
+	text = strings.TrimRight(text, "\n")
+	if message, failed := strings.CutPrefix(text, watchErrorMarker); failed {
+		return s.failure(req, message)
+	}
+
+	s.mu.Lock()
+	preview, children := buildValuePreviewAndChildren(text, s.limits.MaxLocalValuePreviewRunes, s.limits.MaxLocalValueChildren)
+	childRef := 0
+	if len(children) > 0 {
+		childRef = s.allocateVariablesReference(children)
+	}
+	s.mu.Unlock()
+
+	return s.successWithBody(req, EvaluateResponseBody{
+		Result:             preview,
+		Type:               "string",
+		VariablesReference: childRef,
+	})
+}
+
+func normalizeEvaluateContext(context string) string {
+	normalized := strings.TrimSpace(strings.ToLower(context))
+	if normalized == "" {
+		return "repl"
+	}
+	return normalized
+}
+
+func evaluateResultToBody(result evaluateResult) EvaluateResponseBody {
+	typeName := "string"
+	if result.class != 0 {
+		typeName = fmt.Sprintf("nameclass(%d)", result.class)
+	}
+	return EvaluateResponseBody{
+		Result:             result.text,
+		Type:               typeName,
+		VariablesReference: 0,
+	}
+}
+
+func evaluateTimeoutMessage(context string) string {
+	switch context {
+	case "watch":
+		return "timed out waiting for ValueTip in watch context; ensure interpreter is paused and expression is in scope"
+	case "hover":
+		return "timed out waiting for ValueTip in hover context; ensure interpreter is paused and symbol is in scope"
+	case "repl":
+		return "timed out waiting for Execute completion in repl context; ensure interpreter returns to prompt"
+	default:
+		return "timed out waiting for ValueTip"
+	}
+}
+
+func (s *Server) handleCompletionsRequest(req Request) Response {
+	args, ok := extractCompletionsArguments(req.Arguments)
+	if !ok {
+		return s.failure(req, "completions requires text and column")
+	}
+
+	s.mu.Lock()
 	if s.state == stateTerminated {
+		s.mu.Unlock()
 		return s.failure(req, "session already terminated")
 	}
 	if s.state != stateAttachedOrLaunched {
-		return s.failure(req, "source requires launch or attach")
+		s.mu.Unlock()
+		return s.failure(req, "completions requires launch or attach")
+	}
+	if s.rideController == nil {
+		s.mu.Unlock()
+		return s.failure(req, "no RIDE controller configured")
+	}
+	if s.promptTypeSeen && s.promptType == 0 {
+		s.mu.Unlock()
+		return s.failure(req, "interpreter is busy; completions require ready prompt")
+	}
+
+	// Window 0 is the session; a paused frame completes against its own scope.
+	win := args.frameID
+	if win <= 0 && s.activeTracerSet {
+		win = s.activeTracerWindow
+	}
+	symbols := s.frameSymbols[win]
+	timeout := s.limits.EvaluateTimeout
+	controller := s.rideController
+
+	token := s.nextEvaluateToken
+	s.nextEvaluateToken++
+	waiter := make(chan protocol.ReplyGetAutocompleteArgs, 1)
+	s.completionWaiters[token] = waiter
+	s.mu.Unlock()
+
+	line, pos := completionLineAndPos(args)
+	if err := controller.SendCommand("GetAutocomplete", protocol.GetAutocompleteArgs{
+		Line:  line,
+		Pos:   pos,
+		Token: token,
+		Win:   win,
+	}); err != nil {
+		s.mu.Lock()
+		delete(s.completionWaiters, token)
+		s.mu.Unlock()
+		return s.failure(req, "failed to send GetAutocomplete")
+	}
+
+	select {
+	case reply := <-waiter:
+		return s.successWithBody(req, CompletionsResponseBody{
+			Targets: completionItemsFromReply(reply, []rune(line)[:pos], args.column, symbols),
+		})
+	case <-time.After(timeout):
+		s.mu.Lock()
+		delete(s.completionWaiters, token)
+		s.mu.Unlock()
+		return s.failure(req, "timed out waiting for ReplyGetAutocomplete; ensure interpreter is at a ready prompt")
+	}
+}
+
+// completionLineAndPos selects the requested line and converts the DAP column (1-based UTF-16
+// code units) to the rune position RIDE expects.
+func completionLineAndPos(args completionsArguments) (string, int) {
+	lines := strings.Split(args.text, "\n")
+	index := 0
+	if args.line > 0 && args.line <= len(lines) {
+		index = args.line - 1
+	}
+	runes := []rune(lines[index])
+
+	units := args.column - 1
+	pos := 0
+	for pos < len(runes) && units > 0 {
+		units -= len(utf16.Encode(runes[pos : pos+1]))
+		pos++
+	}
+	return string(runes), pos
+}
+
+// completionItemsFromReply maps autocomplete options to DAP items that replace the typed
+// prefix, adding paused-frame locals the interpreter did not list.
+func completionItemsFromReply(
+	reply protocol.ReplyGetAutocompleteArgs,
+	beforeCursor []rune,
+	column int,
+	symbols frameSymbolsState,
+) []CompletionItem {
+	skip := reply.Skip
+	if skip < 0 || skip > len(beforeCursor) {
+		skip = 0
+	}
+	prefix := string(beforeCursor[len(beforeCursor)-skip:])
+	length := len(utf16.Encode([]rune(prefix)))
+	start := 0
+	if length > 0 {
+		start = column - length
+	}
+
+	items := make([]CompletionItem, 0, len(reply.Options))
+	seen := make(map[string]struct{}, len(reply.Options))
+	for _, option := range reply.Options {
+		if _, dup := seen[option]; dup || option == "" {
+			continue
+		}
+		seen[option] = struct{}{}
+		items = append(items, CompletionItem{
+			Label:  option,
+			Type:   completionItemType(option, symbols),
+			Start:  start,
+			Length: length,
+		})
+	}
+	for _, name := range symbols.order {
+		symbol := symbols.symbols[name]
+		if _, dup := seen[name]; dup || !symbol.isLocal || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		seen[name] = struct{}{}
+		items = append(items, CompletionItem{
+			Label:  name,
+			Type:   completionItemType(name, symbols),
+			Start:  start,
+			Length: length,
+		})
+	}
+	return items
+}
+
+func completionItemType(name string, symbols frameSymbolsState) string {
+	switch {
+	case strings.HasPrefix(name, "⎕"):
+		return "function"
+	case strings.HasPrefix(name, ")"), strings.HasPrefix(name, "]"):
+		return "keyword"
+	}
+	symbol, ok := symbols.symbols[name]
+	if !ok {
+		return "text"
+	}
+	if symbol.hasValue {
+		// Name classes follow ⎕NC: 2 variable, 3 function, 4 operator, 9 namespace.
+		switch symbol.class {
+		case 3, 4:
+			return "function"
+		case 9:
+			return "module"
+		}
+	}
+	return "variable"
+}
+
+func (s *Server) handleSourceRequest(req Request) Response {
+	resp, editName := s.sourceResponse(req)
+	if editName == "" {
+		return resp
+	}
+	// A workspace-only entity with no open window is fetched fresh from the interpreter,
+	// and the window opened to read it is closed again so refreshes do not pile them up.
+	window, opened, err := s.openEditorWindow(editName)
+	if err != nil {
+		return s.failure(req, fmt.Sprintf("source content is unavailable for %s: %v", editName, err))
+	}
+	if opened {
+		s.mu.Lock()
+		controller := s.rideController
+		s.mu.Unlock()
+		if controller != nil {
+			if err := controller.SendCommand("CloseWindow", protocol.WindowArgs{Win: window.Token}); err != nil {
+				return s.failure(req, "failed to send CloseWindow")
+			}
+		}
+	}
+	return s.successWithBody(req, SourceResponseBody{
+		Content:  strings.Join(window.Text, "\n"),
+		MimeType: "text/plain",
+	})
+}
+
+// sourceResponse answers a source request from memory or disk. For a virtual source
+// whose window is closed it instead returns the entity name to open with Edit.
+func (s *Server) sourceResponse(req Request) (Response, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == stateTerminated {
+		return s.failure(req, "session already terminated"), ""
+	}
+	if s.state != stateAttachedOrLaunched {
+		return s.failure(req, "source requires launch or attach"), ""
 	}
 
 	args, ok := extractSourceArguments(req.Arguments)
 	if !ok {
-		return s.failure(req, "source requires source.path or sourceReference")
+		return s.failure(req, "source requires source.path or sourceReference"), ""
 	}
 
-	path := args.path
+	path := s.remotePathLocked(args.path)
 	if args.sourceReference > 0 {
 		if mapped, exists := s.pathBySourceRef[args.sourceReference]; exists {
 			path = mapped
 		}
 	}
 	if path == "" {
-		return s.failure(req, "source requires a mapped sourceReference or path")
+		return s.failure(req, "source requires a mapped sourceReference or path"), ""
 	}
 
 	if s.hasActiveTokenForPath(path) {
@@ -894,24 +2082,277 @@ func (s *Server) handleSourceRequest(req Request) Response {
 			return s.successWithBody(req, SourceResponseBody{
 				Content:  strings.Join(lines, "\n"),
 				MimeType: "text/plain",
-			})
+			}), ""
 		}
-		return s.failure(req, fmt.Sprintf("source mapped to active window but no in-memory text for path: %s", path))
+		return s.failure(req, fmt.Sprintf("source mapped to active window but no in-memory text for path: %s", path)), ""
+	}
+	if name, ok := virtualSourceName(path); ok {
+		return Response{}, name
 	}
 
-	bytes, err := os.ReadFile(path)
+	localPath := s.localPathLocked(path)
+	bytes, err := os.ReadFile(localPath)
 	if err != nil {
-		return s.failure(req, fmt.Sprintf("source content is unavailable for path %s: %v", path, err))
+		return s.failure(req, fmt.Sprintf("source content is unavailable for path %s: %v", localPath, err)), ""
 	}
 	return s.successWithBody(req, SourceResponseBody{
 		Content:  string(bytes),
 		MimeType: "text/plain",
+	}), ""
+}
+
+// handleEditRequest opens an entity in an interpreter editor window with RIDE Edit and
+// returns the window content once OpenWindow (or GotoWindow for an open one) arrives.
+func (s *Server) handleEditRequest(req Request) Response {
+	argsMap, _ := req.Arguments.(map[string]any)
+	name, ok := decode.NonEmptyTrimmedStringFromMap(argsMap, "name")
+	if !ok {
+		return s.failure(req, "dyalog/edit requires name")
+	}
+	window, _, err := s.openEditorWindow(name)
+	if err != nil {
+		return s.failure(req, err.Error())
+	}
+	s.mu.Lock()
+	path := s.localPathLocked(windowSourcePath(window))
+	s.mu.Unlock()
+	return s.successWithBody(req, EditResponseBody{
+		Win:        window.Token,
+		Name:       window.Name,
+		Filename:   window.Filename,
+		Path:       path,
+		Content:    strings.Join(window.Text, "\n"),
+		EntityType: window.EntityType,
+		ReadOnly:   window.ReadOnly,
 	})
 }
 
+// openEditorWindow sends RIDE Edit for name and waits for the window it opens or focuses.
+// opened reports a newly opened window rather than one already open being focused.
+func (s *Server) openEditorWindow(name string) (window protocol.WindowContentArgs, opened bool, err error) {
+	s.mu.Lock()
+	if s.state == stateTerminated {
+		s.mu.Unlock()
+		return protocol.WindowContentArgs{}, false, errors.New("session already terminated")
+	}
+	if s.state != stateAttachedOrLaunched {
+		s.mu.Unlock()
+		return protocol.WindowContentArgs{}, false, errors.New("editing requires launch or attach")
+	}
+	if s.rideController == nil {
+		s.mu.Unlock()
+		return protocol.WindowContentArgs{}, false, errors.New("no RIDE controller configured")
+	}
+	if s.promptTypeSeen && s.promptType == 0 {
+		s.mu.Unlock()
+		return protocol.WindowContentArgs{}, false, errors.New("interpreter is busy; editing requires ready prompt")
+	}
+	timeout := s.limits.EvaluateTimeout
+	controller := s.rideController
+	waiter := make(chan editedWindow, 1)
+	s.editWaiters = append(s.editWaiters, editWaiter{name: name, window: waiter})
+	s.mu.Unlock()
+
+	// Edit names the entity under the cursor, so the cursor goes at the end of the name.
+	if err := controller.SendCommand("Edit", protocol.EditArgs{
+		Win:  0,
+		Text: name,
+		Pos:  len([]rune(name)),
+	}); err != nil {
+		s.dropEditWaiter(waiter)
+		return protocol.WindowContentArgs{}, false, errors.New("failed to send Edit")
+	}
+
+	select {
+	case edited := <-waiter:
+		return edited.window, edited.opened, nil
+	case <-time.After(timeout):
+		s.dropEditWaiter(waiter)
+		return protocol.WindowContentArgs{}, false, fmt.Errorf("timed out waiting for an editor window for %s", name)
+	}
+}
+
+// handleSaveChangesRequest fixes an editor window's new content with RIDE SaveChanges and
+// waits for ReplySaveChanges. With close set, the window is closed once the save succeeds;
+// a rejected save leaves it open so the changes can be corrected.
+func (s *Server) handleSaveChangesRequest(req Request) Response {
+	argsMap, _ := req.Arguments.(map[string]any)
+	win, ok := decode.IntFromMap(argsMap, "win")
+	if !ok || win <= 0 {
+		return s.failure(req, "dyalog/saveChanges requires win")
+	}
+	content, ok := decode.StringFromMap(argsMap, "content")
+	if !ok {
+		return s.failure(req, "dyalog/saveChanges requires content")
+	}
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	closeAfter := decode.BoolOrFalse(argsMap["close"])
+
+	s.mu.Lock()
+	if s.state == stateTerminated {
+		s.mu.Unlock()
+		return s.failure(req, "session already terminated")
+	}
+	if s.rideController == nil {
+		s.mu.Unlock()
+		return s.failure(req, "no RIDE controller configured")
+	}
+	window, open := s.windowContent[win]
+	if !open {
+		s.mu.Unlock()
+		return s.failure(req, fmt.Sprintf("window %d is not open", win))
+	}
+	if window.ReadOnly {
+		s.mu.Unlock()
+		return s.failure(req, fmt.Sprintf("window %d is read-only", win))
+	}
+	if s.savesInFlight[win] {
+		s.mu.Unlock()
+		return s.failure(req, fmt.Sprintf("a save is already pending for window %d", win))
+	}
+	timeout := s.limits.EvaluateTimeout
+	controller := s.rideController
+	saveArgs := protocol.SaveChangesArgs{
+		Win:     win,
+		Text:    lines,
+		Stop:    s.windowStopsLocked(window),
+		Monitor: nonNilInts(window.Monitor),
+		Trace:   nonNilInts(window.Trace),
+	}
+	s.savesInFlight[win] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.savesInFlight, win)
+		s.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	replyPayload, err := s.requestReply(ctx, controller, "SaveChanges", saveArgs, sessionstate.MatchWin("ReplySaveChanges", win))
+	switch {
+	case errors.Is(err, errRequestTimedOut):
+		return s.failure(req, "timed out waiting for ReplySaveChanges")
+	case err != nil:
+		return s.failure(req, "failed to send SaveChanges")
+	}
+	reply, _ := extractReplySaveChanges(replyPayload.Args)
+	if reply.Err != 0 {
+		return s.failure(req, fmt.Sprintf("interpreter rejected the changes to window %d (err=%d)", win, reply.Err))
+	}
+
+	fileLines := s.windowFileLines(window)
+	s.mu.Lock()
+	if current, open := s.windowContent[win]; open {
+		current.Text = lines
+		s.windowContent[win] = current
+		s.bindWindowSourceLocked(current, fileLines)
+	}
+	s.mu.Unlock()
+	if closeAfter {
+		if err := controller.SendCommand("CloseWindow", protocol.WindowArgs{Win: win}); err != nil {
+			return s.failure(req, "failed to send CloseWindow")
+		}
+	}
+	return s.success(req)
+}
+
+// handleCloseWindowRequest closes an editor window. Any SaveChanges still in flight for
+// the window is answered first, as the dispatcher defers CloseWindow behind it.
+func (s *Server) handleCloseWindowRequest(req Request) Response {
+	argsMap, _ := req.Arguments.(map[string]any)
+	win, ok := decode.IntFromMap(argsMap, "win")
+	if !ok || win <= 0 {
+		return s.failure(req, "dyalog/closeWindow requires win")
+	}
+	if s.rideController == nil {
+		return s.failure(req, "no RIDE controller configured")
+	}
+	if err := s.rideController.SendCommand("CloseWindow", protocol.WindowArgs{Win: win}); err != nil {
+		return s.failure(req, "failed to send CloseWindow")
+	}
+	return s.success(req)
+}
+
+func (s *Server) rememberWindowContentLocked(window protocol.WindowContentArgs) {
+	if window.Token <= 0 {
+		return
+	}
+	s.windowContent[window.Token] = window
+	if !window.Debugger {
+		s.deliverEditWindowLocked(window, true)
+	}
+}
+
+// editWaiter is a dyalog/edit or source request waiting for the window its Edit opens.
+type editWaiter struct {
+	name   string
+	window chan editedWindow
+}
+
+// editedWindow is the window delivered to an editWaiter, and whether OpenWindow
+// (rather than GotoWindow) brought it.
+type editedWindow struct {
+	window protocol.WindowContentArgs
+	opened bool
+}
+
+// deliverEditWindowLocked answers the oldest dyalog/edit request still waiting for a
+// window of the same name; windows opened for anything else are left alone.
+func (s *Server) deliverEditWindowLocked(window protocol.WindowContentArgs, opened bool) {
+	for i, pending := range s.editWaiters {
+		if sameEntityName(pending.name, window.Name) {
+			s.editWaiters = append(s.editWaiters[:i], s.editWaiters[i+1:]...)
+			pending.window <- editedWindow{window: window, opened: opened}
+			return
+		}
+	}
+}
+
+func (s *Server) dropEditWaiter(waiter chan editedWindow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, pending := range s.editWaiters {
+		if pending.window == waiter {
+			s.editWaiters = append(s.editWaiters[:i], s.editWaiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// sameEntityName reports whether two entity names refer to the same name in the root
+// namespace, so "Foo" matches "#.Foo".
+func sameEntityName(a, b string) bool {
+	return strings.TrimPrefix(strings.TrimSpace(a), "#.") == strings.TrimPrefix(strings.TrimSpace(b), "#.")
+}
+
+// windowStopsLocked returns the zero-based stop lines to keep when saving a window:
+// breakpoints applied through setBreakpoints, else those the window opened with.
+func (s *Server) windowStopsLocked(window protocol.WindowContentArgs) []int {
+	if binding, ok := s.sourceByToken[window.Token]; ok {
+		if lines, applied := s.appliedBySourceRef[binding.sourceRef]; applied {
+			return s.windowStopLinesLocked(window.Token, lines)
+		}
+	}
+	return nonNilInts(window.Stop)
+}
+
+func nonNilInts(values []int) []int {
+	if values == nil {
+		return []int{}
+	}
+	return values
+}
+
 // HandleRidePayload updates adapter runtime stop state from inbound RIDE events.
 func (s *Server) HandleRidePayload(decoded protocol.DecodedPayload) (events []Event) {
 	var intents []outboundCommandIntent
+	var fileLines []string
+	if decoded.Kind == protocol.KindCommand && (decoded.Command == "OpenWindow" || decoded.Command == "UpdateWindow") {
+		if window, ok := extractWindowContent(decoded.Args); ok {
+			fileLines = s.windowFileLines(window)
+		}
+	}
 	s.mu.Lock()
 	defer func() {
 		s.mu.Unlock()
@@ -929,8 +2370,43 @@ func (s *Server) HandleRidePayload(decoded protocol.DecodedPayload) (events []Ev
 	if decoded.Kind != protocol.KindCommand {
 		return nil
 	}
+	if warning, ok := s.schemaWarningLocked(decoded); ok {
+		defer func() { events = append([]Event{warning}, events...) }()
+	}
 
 	switch decoded.Command {
+	case "Identify":
+		identify, ok := extractIdentify(decoded.Args)
+		if !ok {
+			return nil
+		}
+		s.sessionInfo = protocol.NewSessionInfo(identify, s.sessionInfo.ProtocolVersion)
+		s.sessionInfoSet = true
+		return s.sessionIdentifiedEventsLocked()
+
+	case "OptionsDialog", "StringDialog", "TaskDialog":
+		dialog, ok := extractDialog(decoded.Command, decoded.Args)
+		if !ok {
+			return nil
+		}
+		if s.dialogPolicy == DialogPolicyPrompt {
+			// The interpreter blocks until the dialog is answered via dyalog/replyDialog.
+			s.pendingDialogs[dialog.Token] = dialog
+			return []Event{{Event: "dyalog/dialog", Body: dialog}}
+		}
+		index, value := dialogDefaultAnswer(dialog)
+		command, args := dialogReply(dialog, index, value, s.dialogPolicy == DialogPolicyCancel)
+		intents = append(intents, outboundCommandIntent{
+			controller: s.rideController,
+			kind:       outboundIntentDialogReply,
+			command:    command,
+			args:       args,
+			token:      dialog.Token,
+		})
+		return []Event{newOutputEvent("console", fmt.Sprintf(
+			"%s %q answered automatically (dialogPolicy %s)", decoded.Command, dialogLabel(dialog), s.dialogPolicy,
+		))}
+
 	case "ReplyGetThreads":
 		reply, ok := extractReplyGetThreads(decoded.Args)
 		if !ok {
@@ -944,8 +2420,10 @@ func (s *Server) HandleRidePayload(decoded protocol.DecodedPayload) (events []Ev
 		if !ok {
 			return nil
 		}
-		s.bindTokenToSource(window.Token, window.Filename, window.Name)
-		s.storeSourceText(window.Filename, window.Text)
+		if note := s.bindWindowSourceLocked(window, fileLines); note != "" {
+			defer func() { events = append([]Event{newOutputEvent("console", note)}, events...) }()
+		}
+		s.rememberWindowContentLocked(window)
 		if intent, ok := s.collectDeferredBreakpointIntentLocked(window.Token); ok {
 			intents = append(intents, intent)
 		}
@@ -954,23 +2432,31 @@ func (s *Server) HandleRidePayload(decoded protocol.DecodedPayload) (events []Ev
 		}
 		return nil
 
+	case "GotoWindow":
+		windowArgs, ok := extractWindowArgs(decoded.Args)
+		if !ok {
+			return nil
+		}
+		// Editing an entity that is already open focuses its window instead of reopening it.
+		if window, open := s.windowContent[windowArgs.Win]; open {
+			s.deliverEditWindowLocked(window, false)
+		}
+		return nil
+
 	case "CloseWindow":
 		windowArgs, ok := extractWindowArgs(decoded.Args)
 		if !ok {
 			return nil
 		}
 		s.unbindToken(windowArgs.Win)
+		delete(s.windowContent, windowArgs.Win)
 		return nil
 	case "ReplyGetSIStack":
 		reply, ok := extractReplyGetSIStack(decoded.Args)
 		if !ok {
 			return nil
 		}
-		si := make([]string, 0, len(reply.Stack))
-		for _, frame := range reply.Stack {
-			si = append(si, frame.Description)
-		}
-		s.siDescriptions[reply.Tid] = si
+		s.rememberSIStackLocked(reply)
 		return nil
 
 	case "OpenWindow":
@@ -978,8 +2464,10 @@ func (s *Server) HandleRidePayload(decoded protocol.DecodedPayload) (events []Ev
 		if !ok {
 			return nil
 		}
-		s.bindTokenToSource(window.Token, window.Filename, window.Name)
-		s.storeSourceText(window.Filename, window.Text)
+		if note := s.bindWindowSourceLocked(window, fileLines); note != "" {
+			defer func() { events = append([]Event{newOutputEvent("console", note)}, events...) }()
+		}
+		s.rememberWindowContentLocked(window)
 		if intent, ok := s.collectDeferredBreakpointIntentLocked(window.Token); ok {
 			intents = append(intents, intent)
 		}
@@ -1042,7 +2530,16 @@ func (s *Server) HandleRidePayload(decoded protocol.DecodedPayload) (events []Ev
 		s.promptType = promptType
 		s.promptTypeSeen = true
 		if promptType > 0 {
-			s.completePendingReplEvaluateLocked(false)
+			if intent, ok := s.completePendingReplEvaluateLocked(); ok {
+				intents = append(intents, intent)
+			}
+		}
+		switch promptType {
+		case promptTypeQuadInput:
+			return []Event{newOutputEvent("console", "⎕ input requested; enter an expression in the Debug Console")}
+		case promptTypeQuoteQuadInput:
+			s.quoteQuadPrompt = s.sessionLineTail
+			return []Event{newOutputEvent("console", "⍞ input requested; enter a line of text in the Debug Console")}
 		}
 		return nil
 
@@ -1054,25 +2551,47 @@ func (s *Server) HandleRidePayload(decoded protocol.DecodedPayload) (events []Ev
 		if appendOutput.result == "" {
 			return nil
 		}
-		if appendOutput.outputType == 14 {
+		if appendOutput.outputType == sessionOutputEcho {
+			s.noteReplGroupLocked(appendOutput.group)
+			if s.activeReplEvaluateLocked() != nil {
+				// The client already shows what was entered in the Debug Console.
+				return nil
+			}
+		} else {
+			s.trackSessionLineTailLocked(appendOutput.result)
+			if s.appendPendingReplOutputLocked(appendOutput) {
+				return nil
+			}
+		}
+		return s.sessionOutputEventsLocked(appendOutput)
+
+	case "SetSessionLineGroup":
+		lineGroup, ok := extractSetSessionLineGroup(decoded.Args)
+		if !ok {
 			return nil
 		}
-		s.appendPendingReplOutputLocked(appendOutput)
-		return []Event{newOutputEvent(outputCategoryForSessionOutput(appendOutput.outputType), appendOutput.result)}
+		s.noteReplGroupLocked(lineGroup.Group)
+		if s.outputGroup != 0 && lineGroup.Group != s.outputGroup {
+			return []Event{s.endOutputGroupLocked()}
+		}
+		return nil
 
-	case "ValueTip":
-		valueTip, ok := extractValueTip(decoded.Args)
+	case "ReplyGetAutocomplete":
+		reply, ok := extractReplyGetAutocomplete(decoded.Args)
 		if !ok {
 			return nil
 		}
-		s.dispatchValueTip(valueTip)
+		if waiter, exists := s.completionWaiters[reply.Token]; exists {
+			delete(s.completionWaiters, reply.Token)
+			waiter <- reply
+		}
 		return nil
 
 	case "HadError":
 		hadError, _ := extractHadError(decoded.Args)
 		return []Event{{
 			Event: "stopped",
-			Body:  s.newStoppedEventBody("exception", hadError.ErrorText),
+			Body:  s.newStoppedEventBody("exception", s.hadErrorDescriptionLocked(hadError)),
 		}}
 	case "Disconnect":
 		disconnect, _ := extractDisconnect(decoded.Args)
@@ -1106,6 +2625,14 @@ func (s *Server) HandleRidePayload(decoded protocol.DecodedPayload) (events []Ev
 	}
 }
 
+func (s *Server) rememberSIStackLocked(reply protocol.ReplyGetSIStackArgs) {
+	si := make([]string, 0, len(reply.Stack))
+	for _, frame := range reply.Stack {
+		si = append(si, frame.Description)
+	}
+	s.siDescriptions[reply.Tid] = si
+}
+
 func (s *Server) updateThreadCache(reply protocol.ReplyGetThreadsArgs) {
 	nextCache := make(map[int]Thread, len(reply.Threads))
 	nextOrder := make([]int, 0, len(reply.Threads))
@@ -1165,7 +2692,34 @@ func (s *Server) snapshotThreads() []Thread {
 	return threads
 }
 
-func (s *Server) bindTokenToSource(token int, path, displayName string) {
+// bindWindowSourceLocked binds a window to its source path, correcting for its line offset
+// in the file, and stores the text served for that path. fileLines is the window's file as
+// read by windowFileLines, or nil when it could not be read. It returns a note for the
+// console, once per case, when the window could not be placed in its file unambiguously.
+func (s *Server) bindWindowSourceLocked(window protocol.WindowContentArgs, fileLines []string) string {
+	path := windowSourcePath(window)
+	offset, note := sourceLineOffset(window, fileLines)
+	if note != "" {
+		if s.offsetWarned[note] {
+			note = ""
+		} else {
+			s.offsetWarned[note] = true
+		}
+	}
+	s.bindTokenToSource(window.Token, path, window.Name, offset)
+	switch {
+	case offset == 0:
+		s.storeSourceText(path, window.Text)
+	case fileLines != nil:
+		s.storeSourceText(path, fileLines)
+	default:
+		// Without the file, pad so the window's lines still sit at their file line numbers.
+		s.storeSourceText(path, append(make([]string, offset), window.Text...))
+	}
+	return note
+}
+
+func (s *Server) bindTokenToSource(token int, path, displayName string, lineOffset int) {
 	if token <= 0 || path == "" {
 		return
 	}
@@ -1189,6 +2743,7 @@ func (s *Server) bindTokenToSource(token int, path, displayName string) {
 		path:        path,
 		sourceRef:   sourceRef,
 		displayName: displayName,
+		lineOffset:  lineOffset,
 	}
 
 	if existingToken, exists := s.tokenBySourceRef[sourceRef]; exists && existingToken != token {
@@ -1222,7 +2777,6 @@ func (s *Server) unbindToken(token int) {
 			delete(s.frameScopeRef, token)
 		}
 		delete(s.frameSymbols, token)
-		s.dropPendingSymbolTipsForFrame(token)
 		delete(s.tracerWindows, token)
 		s.removeTracerToken(token)
 		if s.activeTracerSet && s.activeTracerWindow == token {
@@ -1299,12 +2853,18 @@ func (s *Server) buildStackFramesForThread(threadID int) []StackFrame {
 			name = fmt.Sprintf("Frame %d", token)
 		}
 
-		frames = append(frames, StackFrame{
+		frame := StackFrame{
 			ID:     token,
 			Name:   name,
 			Line:   oneBased(window.line),
 			Column: oneBased(window.column),
-		})
+		}
+		if binding, bound := s.sourceByToken[token]; bound {
+			source := s.sourceForBindingLocked(binding)
+			frame.Source = &source
+			frame.Line += binding.lineOffset
+		}
+		frames = append(frames, frame)
 	}
 
 	if names, ok := s.siDescriptions[threadID]; ok {
@@ -1330,15 +2890,22 @@ func (s *Server) newStoppedEventBody(reason, description string) StoppedEventBod
 
 func (s *Server) terminateSessionFromRide() {
 	s.state = stateTerminated
+	s.pendingDialogs = map[int]DialogEventBody{}
 	s.activeTracerSet = false
 	s.activeThreadSet = false
 	s.promptTypeSeen = false
-	s.evaluateWaiters = map[int]chan evaluateResult{}
-	s.pendingSymbolTips = map[int]pendingSymbolTip{}
+	s.sessionLineTail = ""
+	s.quoteQuadPrompt = ""
+	s.outputGroup = 0
+	s.evaluateRequests = map[int]context.CancelFunc{}
+	s.completionWaiters = map[int]chan protocol.ReplyGetAutocompleteArgs{}
+	s.editWaiters = nil
+	s.savesInFlight = map[int]bool{}
 	s.cancelPendingReplEvaluateLocked()
 }
 
 func (s *Server) resetRuntimeStateForReconnect() {
+	s.pendingDialogs = map[int]DialogEventBody{}
 	s.activeTracerSet = false
 	s.activeThreadSet = false
 	s.tracerWindows = map[int]tracerWindowState{}
@@ -1352,42 +2919,161 @@ func (s *Server) resetRuntimeStateForReconnect() {
 	s.frameScopeRef = map[int]int{}
 	s.variablesByRef = map[int][]Variable{}
 	s.nextVariablesRef = 1
-	s.evaluateWaiters = map[int]chan evaluateResult{}
+	s.evaluateRequests = map[int]context.CancelFunc{}
+	s.completionWaiters = map[int]chan protocol.ReplyGetAutocompleteArgs{}
+	s.windowContent = map[int]protocol.WindowContentArgs{}
+	s.editWaiters = nil
+	s.savesInFlight = map[int]bool{}
 	s.frameSymbols = map[int]frameSymbolsState{}
-	s.pendingSymbolTips = map[int]pendingSymbolTip{}
 	s.nextSymbolTipToken = 100000
 	s.promptTypeSeen = false
+	s.sessionLineTail = ""
+	s.quoteQuadPrompt = ""
+	s.outputGroup = 0
 	s.clearPendingReplEvaluateLocked()
 }
 
-func (s *Server) appendPendingReplOutputLocked(output appendSessionOutputArgs) {
-	if s.replEvaluate == nil {
+// awaitingInputLocked reports whether the running program is blocked reading ⎕ or ⍞.
+func (s *Server) awaitingInputLocked() bool {
+	return s.promptTypeSeen && (s.promptType == promptTypeQuadInput || s.promptType == promptTypeQuoteQuadInput)
+}
+
+// trackSessionLineTailLocked keeps the unterminated end of session output, which becomes
+// the ⍞ prompt when the interpreter asks for character input.
+func (s *Server) trackSessionLineTailLocked(result string) {
+	if i := strings.LastIndex(result, "\n"); i >= 0 {
+		s.sessionLineTail = result[i+1:]
 		return
 	}
-	s.replEvaluate.outputs = append(s.replEvaluate.outputs, output.result)
+	s.sessionLineTail += result
 }
 
-func (s *Server) completePendingReplEvaluateLocked(canceled bool) {
-	if s.replEvaluate == nil {
-		return
+// activeReplEvaluateLocked returns the queued repl evaluate whose Execute has been sent.
+func (s *Server) activeReplEvaluateLocked() *pendingReplEvaluate {
+	if len(s.replQueue) == 0 || !s.replQueue[0].sent {
+		return nil
 	}
-	pending := s.replEvaluate
-	s.replEvaluate = nil
-	select {
-	case pending.waiter <- replEvaluateResult{
-		text:     strings.Join(pending.outputs, ""),
-		canceled: canceled,
-	}:
-	default:
+	return s.replQueue[0]
+}
+
+// nextReplExecuteIntentLocked marks the queue head as sent and returns its Execute intent,
+// or false when the head is already running or there is nothing to send.
+func (s *Server) nextReplExecuteIntentLocked() (outboundCommandIntent, bool) {
+	if s.rideController == nil || len(s.replQueue) == 0 || s.replQueue[0].sent {
+		return outboundCommandIntent{}, false
+	}
+	pending := s.replQueue[0]
+	pending.sent = true
+
+	text := pending.expression
+	if s.promptTypeSeen && s.promptType == promptTypeQuoteQuadInput {
+		// ⍞ reads the rest of the prompt line, so the answer is sent after the prompt text
+		// exactly as typed; the interpreter strips the unchanged prompt itself.
+		text = s.quoteQuadPrompt + strings.TrimSuffix(text, "\n")
+		s.quoteQuadPrompt = ""
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return outboundCommandIntent{
+		controller: s.rideController,
+		kind:       outboundIntentReplExecute,
+		command:    "Execute",
+		args: protocol.ExecuteArgs{
+			Text:  text,
+			Trace: 0,
+		},
+		token: pending.id,
+	}, true
+}
+
+// noteReplGroupLocked records the session line group of the running evaluate's input.
+func (s *Server) noteReplGroupLocked(group int) {
+	if active := s.activeReplEvaluateLocked(); active != nil && active.group == 0 && group > 0 {
+		active.group = group
+	}
+}
+
+// appendPendingReplOutputLocked collects session output for the repl evaluate it belongs
+// to, and reports whether that evaluate keeps the output from the client.
+func (s *Server) appendPendingReplOutputLocked(output appendSessionOutputArgs) bool {
+	if output.group > 0 {
+		for _, pending := range s.replQueue {
+			if pending.group == output.group {
+				pending.outputs = append(pending.outputs, output.result)
+				return pending.silent
+			}
+		}
+	}
+	if active := s.activeReplEvaluateLocked(); active != nil {
+		active.outputs = append(active.outputs, output.result)
+		return active.silent
+	}
+	return false
+}
+
+// completePendingReplEvaluateLocked resolves the running repl evaluate and returns the
+// Execute intent for the next queued one, if any.
+func (s *Server) completePendingReplEvaluateLocked() (outboundCommandIntent, bool) {
+	if active := s.activeReplEvaluateLocked(); active != nil {
+		s.replQueue = s.replQueue[1:]
+		deliverReplEvaluateResult(active, replEvaluateResult{text: strings.Join(active.outputs, "")})
+	}
+	return s.nextReplExecuteIntentLocked()
+}
+
+func (s *Server) removeReplEvaluateLocked(id int) *pendingReplEvaluate {
+	for i, pending := range s.replQueue {
+		if pending.id == id {
+			s.replQueue = append(s.replQueue[:i:i], s.replQueue[i+1:]...)
+			return pending
+		}
+	}
+	return nil
+}
+
+func (s *Server) failReplEvaluateLocked(id int, message string) {
+	if pending := s.removeReplEvaluateLocked(id); pending != nil {
+		deliverReplEvaluateResult(pending, replEvaluateResult{failure: message})
 	}
 }
 
 func (s *Server) clearPendingReplEvaluateLocked() {
-	s.replEvaluate = nil
+	s.replQueue = nil
 }
 
 func (s *Server) cancelPendingReplEvaluateLocked() {
-	s.completePendingReplEvaluateLocked(true)
+	for _, pending := range s.replQueue {
+		deliverReplEvaluateResult(pending, replEvaluateResult{
+			text:     strings.Join(pending.outputs, ""),
+			canceled: true,
+		})
+	}
+	s.replQueue = nil
+}
+
+func deliverReplEvaluateResult(pending *pendingReplEvaluate, result replEvaluateResult) {
+	select {
+	case pending.waiter <- result:
+	default:
+	}
+}
+
+// schemaWarningLocked reports the first payload of each command whose arguments break
+// the RIDE schema. The payload is still handled with its leniently decoded arguments.
+func (s *Server) schemaWarningLocked(decoded protocol.DecodedPayload) (Event, bool) {
+	if decoded.Invalid == nil || s.schemaWarned[decoded.Command] {
+		return Event{}, false
+	}
+	s.schemaWarned[decoded.Command] = true
+	return Event{
+		Event: "output",
+		Body: OutputEventBody{
+			Category: "console",
+			Output:   fmt.Sprintf("RIDE schema warning: %v\n", decoded.Invalid),
+			Data:     map[string]any{"command": decoded.Command},
+		},
+	}, true
 }
 
 func newOutputEvent(category, output string) Event {
@@ -1451,25 +3137,182 @@ func formatUnknownCommandMessage(args protocol.UnknownCommandArgs) string {
 	if args.Name == "" {
 		return "RIDE reported unknown command"
 	}
-	return fmt.Sprintf("RIDE reported unknown command: %s", args.Name)
+	return fmt.Sprintf("RIDE reported unknown command: %s", args.Name)
+}
+
+func (s *Server) currentThreadID() int {
+	if s.activeThreadSet {
+		return s.activeThreadID
+	}
+	if s.activeTracerSet {
+		return s.threadForWindow(s.activeTracerWindow)
+	}
+	return 0
+}
+
+func (s *Server) threadForWindow(win int) int {
+	state, ok := s.tracerWindows[win]
+	if !ok {
+		return 0
+	}
+	return state.threadID
+}
+
+// handleReplyDialogRequest answers a pending interpreter dialog. Arguments are token plus
+// index (options/task dialogs), value (string dialogs) or cancel.
+func (s *Server) handleReplyDialogRequest(req Request) Response {
+	argsMap, _ := req.Arguments.(map[string]any)
+	token, ok := decode.IntFromMap(argsMap, "token")
+	if !ok {
+		return s.failure(req, "dyalog/replyDialog requires token")
+	}
+	dialog, ok := s.pendingDialogs[token]
+	if !ok {
+		return s.failure(req, fmt.Sprintf("no pending dialog with token %d", token))
+	}
+	if s.rideController == nil {
+		return s.failure(req, "no RIDE controller configured")
+	}
+
+	cancel := decode.BoolOrFalse(argsMap["cancel"])
+	index, hasIndex := decode.IntFromMap(argsMap, "index")
+	value, hasValue := decode.StringFromMap(argsMap, "value")
+	if !cancel {
+		switch {
+		case dialog.Kind == "string" && !hasValue:
+			return s.failure(req, "string dialog reply requires value or cancel")
+		case dialog.Kind != "string" && !hasIndex:
+			return s.failure(req, "dialog reply requires index or cancel")
+		case dialog.Kind != "string" && !dialogIndexValid(dialog, index):
+			return s.failure(req, fmt.Sprintf("dialog reply index %d out of range", index))
+		}
+	}
+
+	command, args := dialogReply(dialog, index, value, cancel)
+	if err := s.rideController.SendCommand(command, args); err != nil {
+		return s.failure(req, "failed to send "+command)
+	}
+	delete(s.pendingDialogs, token)
+	return s.success(req)
+}
+
+// dialogReply builds the RIDE reply; a cancelled string dialog returns its defaultValue.
+func dialogReply(dialog DialogEventBody, index int, value string, cancel bool) (string, any) {
+	switch dialog.Kind {
+	case "string":
+		if cancel {
+			value = dialog.DefaultValue
+		}
+		return "ReplyStringDialog", protocol.ReplyStringDialogArgs{Value: value, Token: dialog.Token}
+	case "task":
+		if cancel {
+			index = -1
+		}
+		return "ReplyTaskDialog", protocol.ReplyTaskDialogArgs{Index: index, Token: dialog.Token}
+	default:
+		if cancel {
+			index = -1
+		}
+		return "ReplyOptionsDialog", protocol.ReplyOptionsDialogArgs{Index: index, Token: dialog.Token}
+	}
+}
+
+// dialogDefaultAnswer is the first choice: the first task button (index 100), else the
+// first option, or a string dialog's initial value.
+func dialogDefaultAnswer(dialog DialogEventBody) (int, string) {
+	if dialog.Kind == "task" && len(dialog.ButtonText) > 0 {
+		return 100, ""
+	}
+	return 0, dialog.InitialValue
+}
+
+// dialogIndexValid checks a reply index; task dialogs number buttons from 100.
+func dialogIndexValid(dialog DialogEventBody, index int) bool {
+	if dialog.Kind == "task" && index >= 100 {
+		return index-100 < len(dialog.ButtonText)
+	}
+	return index >= 0 && index < len(dialog.Options)
 }
 
-func (s *Server) currentThreadID() int {
-	if s.activeThreadSet {
-		return s.activeThreadID
+func dialogLabel(dialog DialogEventBody) string {
+	if dialog.Title != "" {
+		return dialog.Title
 	}
-	if s.activeTracerSet {
-		return s.threadForWindow(s.activeTracerWindow)
+	return dialog.Text
+}
+
+func extractDialog(command string, args any) (DialogEventBody, bool) {
+	switch v := args.(type) {
+	case protocol.OptionsDialogArgs:
+		return DialogEventBody{Kind: "options", Token: v.Token, Title: v.Title, Text: v.Text, Type: v.Type, Options: v.Options}, true
+	case protocol.StringDialogArgs:
+		return DialogEventBody{
+			Kind:         "string",
+			Token:        v.Token,
+			Title:        v.Title,
+			Text:         v.Text,
+			InitialValue: v.InitialValue,
+			DefaultValue: v.DefaultValue,
+		}, true
+	case protocol.TaskDialogArgs:
+		return DialogEventBody{
+			Kind:       "task",
+			Token:      v.Token,
+			Title:      v.Title,
+			Text:       v.Text,
+			Subtext:    v.Subtext,
+			Footer:     v.Footer,
+			Options:    v.Options,
+			ButtonText: v.ButtonText,
+		}, true
+	case map[string]any:
+		dialog := DialogEventBody{
+			Token:        intFromAny(v["token"]),
+			Title:        stringFromAny(v["title"]),
+			Text:         stringFromAny(v["text"]),
+			Subtext:      stringFromAny(v["subtext"]),
+			Footer:       stringFromAny(v["footer"]),
+			Type:         intFromAny(v["type"]),
+			Options:      stringSliceFromAny(v["options"]),
+			ButtonText:   stringSliceFromAny(v["buttonText"]),
+			InitialValue: stringFromAny(v["initialValue"]),
+			DefaultValue: stringFromAny(v["defaultValue"]),
+		}
+		switch command {
+		case "OptionsDialog":
+			dialog.Kind = "options"
+		case "StringDialog":
+			dialog.Kind = "string"
+		case "TaskDialog":
+			dialog.Kind = "task"
+		default:
+			return DialogEventBody{}, false
+		}
+		return dialog, true
+	default:
+		return DialogEventBody{}, false
 	}
-	return 0
 }
 
-func (s *Server) threadForWindow(win int) int {
-	state, ok := s.tracerWindows[win]
-	if !ok {
-		return 0
+func extractIdentify(args any) (protocol.IdentifyArgs, bool) {
+	switch v := args.(type) {
+	case protocol.IdentifyArgs:
+		return v, true
+	case map[string]any:
+		return protocol.IdentifyArgs{
+			APIVersion: intFromAny(v["apiVersion"]),
+			Identity:   intFromAny(v["identity"]),
+			Version:    stringFromAny(v["version"]),
+			Platform:   stringFromAny(v["platform"]),
+			Arch:       stringFromAny(v["arch"]),
+			PID:        intFromAny(v["pid"]),
+			Project:    stringFromAny(v["Project"]),
+			Machine:    stringFromAny(v["Machine"]),
+			User:       stringFromAny(v["User"]),
+		}, true
+	default:
+		return protocol.IdentifyArgs{}, false
 	}
-	return state.threadID
 }
 
 func extractWindowContent(args any) (protocol.WindowContentArgs, bool) {
@@ -1483,15 +3326,35 @@ func extractWindowContent(args any) (protocol.WindowContentArgs, bool) {
 			Name:          stringFromAny(v["name"]),
 			Text:          stringSliceFromAny(v["text"]),
 			Debugger:      boolFromAny(v["debugger"]),
+			EntityType:    intFromAny(v["entityType"]),
+			Offset:        intFromAny(v["offset"]),
+			ReadOnly:      boolFromAny(v["readOnly"]),
 			Tid:           intFromAny(v["tid"]),
 			CurrentRow:    intFromAny(v["currentRow"]),
 			CurrentColumn: intFromAny(v["currentColumn"]),
+			Stop:          decode.IntSlice(v["stop"]),
+			Monitor:       decode.IntSlice(v["monitor"]),
+			Trace:         decode.IntSlice(v["trace"]),
 		}, true
 	default:
 		return protocol.WindowContentArgs{}, false
 	}
 }
 
+func extractReplySaveChanges(args any) (protocol.ReplySaveChangesArgs, bool) {
+	switch v := args.(type) {
+	case protocol.ReplySaveChangesArgs:
+		return v, true
+	case map[string]any:
+		return protocol.ReplySaveChangesArgs{
+			Win: intFromAny(v["win"]),
+			Err: intFromAny(v["err"]),
+		}, true
+	default:
+		return protocol.ReplySaveChangesArgs{}, false
+	}
+}
+
 func extractWindowArgs(args any) (protocol.WindowArgs, bool) {
 	switch v := args.(type) {
 	case protocol.WindowArgs:
@@ -1716,6 +3579,23 @@ func extractEvaluateArguments(args any) (evaluateArguments, bool) {
 	}, true
 }
 
+func extractCompletionsArguments(args any) (completionsArguments, bool) {
+	typedArgs, ok := args.(map[string]any)
+	if !ok {
+		return completionsArguments{}, false
+	}
+	column := intFromAny(typedArgs["column"])
+	if column <= 0 {
+		return completionsArguments{}, false
+	}
+	return completionsArguments{
+		text:    stringFromAny(typedArgs["text"]),
+		column:  column,
+		line:    intFromAny(typedArgs["line"]),
+		frameID: intFromAny(typedArgs["frameId"]),
+	}, true
+}
+
 func extractSourceArguments(args any) (sourceArguments, bool) {
 	typedArgs, ok := args.(map[string]any)
 	if !ok {
@@ -1725,7 +3605,7 @@ func extractSourceArguments(args any) (sourceArguments, bool) {
 		sourceReference: intFromAny(typedArgs["sourceReference"]),
 	}
 	if source, ok := typedArgs["source"].(map[string]any); ok {
-		parsed.path = stringFromAny(source["path"])
+		parsed.path = canonicalSourcePath(stringFromAny(source["path"]))
 		if parsed.sourceReference <= 0 {
 			parsed.sourceReference = intFromAny(source["sourceReference"])
 		}
@@ -1748,7 +3628,7 @@ func extractSetBreakpointsArguments(args any) (setBreakpointsArguments, bool) {
 	}
 
 	parsed := setBreakpointsArguments{
-		path:            stringFromAny(source["path"]),
+		path:            canonicalSourcePath(stringFromAny(source["path"])),
 		sourceReference: intFromAny(source["sourceReference"]),
 	}
 	if parsed.path == "" && parsed.sourceReference <= 0 {
@@ -1812,9 +3692,35 @@ func (s *Server) deferBreakpoints(args setBreakpointsArguments) {
 	lines := append([]int{}, args.lines...)
 	if args.path != "" {
 		s.pendingByPath[args.path] = lines
+		if sourceRef, ok := s.sourceRefByPath[args.path]; ok {
+			delete(s.appliedBySourceRef, sourceRef)
+		}
 	}
 	if args.sourceReference > 0 {
 		s.pendingBySourceRef[args.sourceReference] = lines
+		delete(s.appliedBySourceRef, args.sourceReference)
+	}
+}
+
+func (s *Server) recordAppliedBreakpointsLocked(sourceRef int, lines []int) {
+	if sourceRef <= 0 {
+		return
+	}
+	if len(lines) == 0 {
+		delete(s.appliedBySourceRef, sourceRef)
+		return
+	}
+	s.appliedBySourceRef[sourceRef] = append([]int{}, lines...)
+}
+
+// requeueAppliedBreakpointsLocked defers previously applied breakpoints so they are
+// re-sent once the reconnected interpreter reopens the matching windows.
+func (s *Server) requeueAppliedBreakpointsLocked() {
+	for sourceRef, lines := range s.appliedBySourceRef {
+		if _, pending := s.pendingBySourceRef[sourceRef]; pending {
+			continue
+		}
+		s.pendingBySourceRef[sourceRef] = append([]int{}, lines...)
 	}
 }
 
@@ -1837,7 +3743,7 @@ func (s *Server) requestWindowLayoutSync() {
 	if s.rideController == nil {
 		return
 	}
-	_ = s.rideController.SendCommand("GetWindowLayout", map[string]any{})
+	_ = s.rideController.SendCommand("GetWindowLayout", protocol.EmptyArgs{})
 }
 
 func (s *Server) collectDeferredBreakpointIntentLocked(token int) (outboundCommandIntent, bool) {
@@ -1862,11 +3768,11 @@ func (s *Server) collectDeferredBreakpointIntentLocked(token int) (outboundComma
 		controller: s.rideController,
 		kind:       outboundIntentDeferredBreakpoints,
 		command:    "SetLineAttributes",
-		args: map[string]any{
-			"win":     token,
-			"stop":    zeroBasedLines(lines),
-			"monitor": []int{},
-			"trace":   []int{},
+		args: protocol.SetLineAttributesArgs{
+			Win:     token,
+			Stop:    s.windowStopLinesLocked(token, lines),
+			Monitor: []int{},
+			Trace:   []int{},
 		},
 		token:     token,
 		sourceRef: binding.sourceRef,
@@ -1877,11 +3783,20 @@ func (s *Server) collectDeferredBreakpointIntentLocked(token int) (outboundComma
 
 func (s *Server) executeOutboundIntents(intents []outboundCommandIntent) []Event {
 	events := make([]Event, 0, len(intents))
-	for _, intent := range intents {
+	for i := 0; i < len(intents); i++ {
+		intent := intents[i]
 		if intent.controller == nil {
 			continue
 		}
 		if err := intent.controller.SendCommand(intent.command, intent.args); err != nil {
+			if intent.kind == outboundIntentReplExecute {
+				s.mu.Lock()
+				s.failReplEvaluateLocked(intent.token, "failed to send Execute")
+				if next, ok := s.nextReplExecuteIntentLocked(); ok {
+					intents = append(intents, next)
+				}
+				s.mu.Unlock()
+			}
 			if intent.kind == outboundIntentDeferredBreakpoints {
 				events = append(events, newOutputEvent("stderr", fmt.Sprintf(
 					"breakpoints deferred apply failed (token=%d path=%s): %v",
@@ -1890,6 +3805,11 @@ func (s *Server) executeOutboundIntents(intents []outboundCommandIntent) []Event
 					err,
 				)))
 			}
+			if intent.kind == outboundIntentDialogReply {
+				events = append(events, newOutputEvent("stderr", fmt.Sprintf(
+					"dialog reply failed (token=%d): %v", intent.token, err,
+				)))
+			}
 			continue
 		}
 
@@ -1898,6 +3818,7 @@ func (s *Server) executeOutboundIntents(intents []outboundCommandIntent) []Event
 			s.mu.Lock()
 			delete(s.pendingBySourceRef, intent.sourceRef)
 			delete(s.pendingByPath, intent.path)
+			s.recordAppliedBreakpointsLocked(intent.sourceRef, intent.lines)
 			s.mu.Unlock()
 			events = append(events, newOutputEvent(
 				"console",
@@ -1930,6 +3851,40 @@ func breakpointSourceLabel(args setBreakpointsArguments) string {
 	return "<unknown-source>"
 }
 
+// windowStopLinesLocked converts one-based file lines to the zero-based window lines RIDE
+// expects, dropping lines outside a window that covers only part of its file.
+func (s *Server) windowStopLinesLocked(token int, lines []int) []int {
+	offset := s.sourceByToken[token].lineOffset
+	if offset == 0 {
+		return zeroBasedLines(lines)
+	}
+	windowLines := len(s.windowContent[token].Text)
+	stops := make([]int, 0, len(lines))
+	for _, line := range lines {
+		stop := line - 1 - offset
+		if stop < 0 || (windowLines > 0 && stop >= windowLines) {
+			continue
+		}
+		stops = append(stops, stop)
+	}
+	return stops
+}
+
+func (s *Server) mappedBreakpointResponsesLocked(token int, lines []int) []Breakpoint {
+	if s.sourceByToken[token].lineOffset == 0 {
+		return buildBreakpointResponses(lines, true, "Active: mapped to current source window.")
+	}
+	breakpoints := make([]Breakpoint, 0, len(lines))
+	for _, line := range lines {
+		if len(s.windowStopLinesLocked(token, []int{line})) == 1 {
+			breakpoints = append(breakpoints, buildBreakpointResponses([]int{line}, true, "Active: mapped to current source window.")...)
+			continue
+		}
+		breakpoints = append(breakpoints, buildBreakpointResponses([]int{line}, false, "Line is outside the function open in the interpreter.")...)
+	}
+	return breakpoints
+}
+
 func zeroBasedLines(lines []int) []int {
 	converted := make([]int, 0, len(lines))
 	for _, line := range lines {
@@ -1972,8 +3927,8 @@ func (s *Server) refreshFrameSymbolsLocked(frameID int) {
 	}
 
 	order, localSet := extractVisibleSymbols(lines)
-	if len(order) > maxLocalSymbolsPerFrame {
-		order = append([]string{}, order[:maxLocalSymbolsPerFrame]...)
+	if maxSymbols := s.limits.MaxLocalSymbolsPerFrame; len(order) > maxSymbols {
+		order = append([]string{}, order[:maxSymbols]...)
 	}
 
 	existing := s.frameSymbols[frameID]
@@ -2035,52 +3990,50 @@ func (s *Server) prepareSymbolTipRequestsLocked(frameID int) []symbolTipRequest
 
 		token := s.nextSymbolTipToken
 		s.nextSymbolTipToken++
-		s.pendingSymbolTips[token] = pendingSymbolTip{
-			frameID: frameID,
-			name:    name,
-		}
 		requests = append(requests, symbolTipRequest{
 			token: token,
-			args: map[string]any{
-				"win":       frameID,
-				"line":      name,
-				"pos":       utf8.RuneCountInString(name),
-				"maxWidth":  maxLocalValuePreviewRunes,
-				"maxHeight": maxLocalValueChildren,
-				"token":     token,
+			name:  name,
+			args: protocol.GetValueTipArgs{
+				Win:       frameID,
+				Line:      name,
+				Pos:       utf8.RuneCountInString(name),
+				MaxWidth:  s.limits.MaxLocalValuePreviewRunes,
+				MaxHeight: s.limits.MaxLocalValueChildren,
+				Token:     token,
 			},
 		})
 	}
 	return requests
 }
 
-func (s *Server) waitForSymbolTipRequests(frameID int, timeout time.Duration) {
-	if timeout <= 0 {
+// fetchSymbolTips asks for every symbol value at once and records the replies that
+// arrive within timeout; symbols left without a value are shown as pending.
+func (s *Server) fetchSymbolTips(controller RideCommandSender, frameID int, requests []symbolTipRequest, timeout time.Duration) {
+	if controller == nil || len(requests) == 0 {
 		return
 	}
-	deadline := time.Now().Add(timeout)
-	for {
-		if time.Now().After(deadline) {
-			s.mu.Lock()
-			s.dropPendingSymbolTipsForFrame(frameID)
-			s.mu.Unlock()
-			return
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-		s.mu.Lock()
-		pending := false
-		for _, request := range s.pendingSymbolTips {
-			if request.frameID == frameID {
-				pending = true
-				break
+	var wg sync.WaitGroup
+	for _, request := range requests {
+		wg.Add(1)
+		go func(request symbolTipRequest) {
+			defer wg.Done()
+			reply, err := s.requestReply(ctx, controller, "GetValueTip", request.args, sessionstate.MatchToken("ValueTip", request.token))
+			if err != nil {
+				return
 			}
-		}
-		s.mu.Unlock()
-		if !pending {
-			return
-		}
-		time.Sleep(localsFetchPollInterval)
+			valueTip, ok := extractValueTip(reply.Args)
+			if !ok {
+				return
+			}
+			s.mu.Lock()
+			s.applySymbolTipLocked(frameID, request.name, valueTip)
+			s.mu.Unlock()
+		}(request)
 	}
+	wg.Wait()
 }
 
 func extractVisibleSymbols(lines []string) ([]string, map[string]bool) {
@@ -2204,62 +4157,486 @@ func extractAppendSessionOutput(args any) (appendSessionOutputArgs, bool) {
 	}
 }
 
-func extractValueTip(args any) (valueTipArgs, bool) {
+func extractCancelRequestID(args any) (int, bool) {
 	v, ok := args.(map[string]any)
 	if !ok {
-		return valueTipArgs{}, false
+		return 0, false
 	}
-	return valueTipArgs{
-		tip:   stringSliceFromAny(v["tip"]),
-		class: intFromAny(v["class"]),
-		token: intFromAny(v["token"]),
-	}, true
+	if _, exists := v["requestId"]; !exists {
+		return 0, false
+	}
+	return intFromAny(v["requestId"]), true
 }
 
-func (s *Server) dispatchValueTip(valueTip valueTipArgs) {
-	waiter, ok := s.evaluateWaiters[valueTip.token]
-	if ok {
-		delete(s.evaluateWaiters, valueTip.token)
-		select {
-		case waiter <- evaluateResult{
-			text:  strings.Join(valueTip.tip, "\n"),
-			class: valueTip.class,
-		}:
-		default:
-		}
-		return
+func extractSetSessionLineGroup(args any) (protocol.SetSessionLineGroupArgs, bool) {
+	switch v := args.(type) {
+	case protocol.SetSessionLineGroupArgs:
+		return v, true
+	case map[string]any:
+		return protocol.SetSessionLineGroupArgs{
+			LineOffset: intFromAny(v["line_offset"]),
+			Group:      intFromAny(v["group"]),
+		}, true
+	default:
+		return protocol.SetSessionLineGroupArgs{}, false
 	}
+}
 
-	pending, exists := s.pendingSymbolTips[valueTip.token]
-	if !exists {
-		return
+func extractReplyGetAutocomplete(args any) (protocol.ReplyGetAutocompleteArgs, bool) {
+	switch v := args.(type) {
+	case protocol.ReplyGetAutocompleteArgs:
+		return v, true
+	case map[string]any:
+		return protocol.ReplyGetAutocompleteArgs{
+			Options: stringSliceFromAny(v["options"]),
+			Skip:    intFromAny(v["skip"]),
+			Token:   intFromAny(v["token"]),
+		}, true
+	default:
+		return protocol.ReplyGetAutocompleteArgs{}, false
+	}
+}
+
+func extractValueTip(args any) (valueTipArgs, bool) {
+	switch v := args.(type) {
+	case protocol.ValueTipArgs:
+		return valueTipArgs{
+			tip:   v.Tip,
+			class: v.Class,
+			token: v.Token,
+		}, true
+	case map[string]any:
+		return valueTipArgs{
+			tip:   stringSliceFromAny(v["tip"]),
+			class: intFromAny(v["class"]),
+			token: intFromAny(v["token"]),
+		}, true
+	default:
+		return valueTipArgs{}, false
 	}
-	delete(s.pendingSymbolTips, valueTip.token)
+}
 
-	state, ok := s.frameSymbols[pending.frameID]
+func (s *Server) applySymbolTipLocked(frameID int, name string, valueTip valueTipArgs) {
+	state, ok := s.frameSymbols[frameID]
 	if !ok {
 		return
 	}
-	symbol, ok := state.symbols[pending.name]
+	symbol, ok := state.symbols[name]
 	if !ok {
 		return
 	}
 	symbol.value = strings.Join(valueTip.tip, "\n")
 	symbol.class = valueTip.class
 	symbol.hasValue = true
-	state.symbols[pending.name] = symbol
-	s.frameSymbols[pending.frameID] = state
+	state.symbols[name] = symbol
+	s.frameSymbols[frameID] = state
+}
+
+// RIDE AppendSessionOutput types the adapter distinguishes.
+const (
+	sessionOutputNormal    = 1
+	sessionOutputResult    = 2
+	sessionOutputError     = 3
+	sessionOutputQuad      = 4
+	sessionOutputErrorInfo = 5
+	sessionOutputQuoteQuad = 6
+	sessionOutputInfo      = 7
+	sessionOutputTrace     = 8
+	sessionOutputSystem    = 11
+	sessionOutputEcho      = 14
+)
+
+// sessionOutputKind is how one RIDE output type is presented in the Debug Console.
+type sessionOutputKind struct {
+	category string
+	kind     string
+}
+
+var sessionOutputKinds = map[int]sessionOutputKind{
+	sessionOutputNormal:    {category: "stdout", kind: "output"},
+	sessionOutputResult:    {category: "stdout", kind: "output"},
+	sessionOutputError:     {category: "stderr", kind: "error"},
+	sessionOutputQuad:      {category: "stdout", kind: "quad"},
+	sessionOutputErrorInfo: {category: "stderr", kind: "error"},
+	sessionOutputQuoteQuad: {category: "stdout", kind: "quoteQuad"},
+	sessionOutputInfo:      {category: "console", kind: "info"},
+	sessionOutputTrace:     {category: "console", kind: "trace"},
+	sessionOutputSystem:    {category: "console", kind: "system"},
+	sessionOutputEcho:      {category: "console", kind: "echo"},
+}
+
+func sessionOutputKindFor(outputType int) sessionOutputKind {
+	if kind, ok := sessionOutputKinds[outputType]; ok {
+		return kind
+	}
+	return sessionOutputKind{category: "stdout", kind: "output"}
 }
 
 func outputCategoryForSessionOutput(outputType int) string {
-	switch outputType {
-	case 3, 5:
-		return "stderr"
-	case 11:
-		return "console"
+	return sessionOutputKindFor(outputType).category
+}
+
+// sessionOutputEventsLocked turns session output into DAP output events. Lines sharing a
+// RIDE group are nested under the group's first line, and error and trace lines that name
+// a function line (Foo[3]) point at its source when that function is open.
+func (s *Server) sessionOutputEventsLocked(output appendSessionOutputArgs) []Event {
+	var events []Event
+	startGroup := false
+	if output.group != s.outputGroup {
+		if s.outputGroup != 0 {
+			events = append(events, s.endOutputGroupLocked())
+		}
+		s.outputGroup = output.group
+		startGroup = output.group != 0
+	}
+
+	kind := sessionOutputKindFor(output.outputType)
+	// Session text is forwarded as-is: a ⍞ prompt has no newline and the answer continues its line.
+	body := OutputEventBody{
+		Category: kind.category,
+		Output:   output.result,
+		Data: map[string]any{
+			"rideOutputType": output.outputType,
+			"kind":           kind.kind,
+		},
+	}
+	if startGroup {
+		body.Group = "start"
+	}
+	if kind.kind == "error" || kind.kind == "trace" {
+		if source, line, ok := s.sessionOutputLocationLocked(output.result); ok {
+			body.Source = &source
+			body.Line = line
+		}
+	}
+	return append(events, Event{Event: "output", Body: body})
+}
+
+func (s *Server) endOutputGroupLocked() Event {
+	s.outputGroup = 0
+	return Event{
+		Event: "output",
+		Body: OutputEventBody{
+			Category: "console",
+			Output:   "",
+			Group:    "end",
+		},
+	}
+}
+
+// sessionFunctionLinePattern matches the Name[line] reference Dyalog prints for the
+// function line an error or trace message belongs to.
+var sessionFunctionLinePattern = regexp.MustCompile(`(?m)^\s*([^\s\[\]]+)\[(\d+)\]`)
+
+// sessionOutputLocationLocked resolves a Name[line] reference against the open source
+// windows. Line [n] is line n+1 of the source, after the header.
+func (s *Server) sessionOutputLocationLocked(text string) (Source, int, bool) {
+	match := sessionFunctionLinePattern.FindStringSubmatch(text)
+	if match == nil {
+		return Source{}, 0, false
+	}
+	name := match[1]
+	line, err := strconv.Atoi(match[2])
+	if err != nil {
+		return Source{}, 0, false
+	}
+	tokens := make([]int, 0, len(s.sourceByToken))
+	for token := range s.sourceByToken {
+		tokens = append(tokens, token)
+	}
+	sort.Ints(tokens)
+	for _, token := range tokens {
+		binding := s.sourceByToken[token]
+		displayName := binding.displayName
+		if displayName != name && !strings.HasSuffix(name, "."+displayName) {
+			continue
+		}
+		return s.sourceForBindingLocked(binding), line + 1 + binding.lineOffset, true
+	}
+	return Source{}, 0, false
+}
+
+// virtualSourceScheme names sources for entities that have no file, such as workspace-only
+// functions: dyalog:/#/Ns/Fn.aplf (with # escaped on the wire), rooted at # or ⎕SE.
+const virtualSourceScheme = "dyalog"
+
+// RIDE entityType values that select a virtual source's Link-style extension.
+const (
+	entityDefinedFunction = 1
+	entityCharArray       = 2
+	entityNumericArray    = 4
+	entityMixedArray      = 8
+	entityNestedArray     = 16
+	entityCharVector      = 128
+	entityNamespace       = 256
+	entityClass           = 512
+	entityInterface       = 1024
+)
+
+// windowSourcePath is the window's file, or a stable virtual path derived from its name.
+func windowSourcePath(window protocol.WindowContentArgs) string {
+	if window.Filename != "" {
+		return window.Filename
+	}
+	return virtualSourcePath(window.Name, window.EntityType)
+}
+
+// windowFileLines reads the file behind a window, mapped to its local path, without holding
+// s.mu so a slow or large file does not stall the RIDE receive loop. It returns nil for a
+// window without a file or when the file cannot be read.
+func (s *Server) windowFileLines(window protocol.WindowContentArgs) []string {
+	if window.Filename == "" {
+		return nil
+	}
+	s.mu.Lock()
+	localPath := s.localPathLocked(window.Filename)
+	s.mu.Unlock()
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+}
+
+// sourceLineOffset finds where a window's text starts in its file's lines.
+// RIDE's offset is used when given. Otherwise, as Link class and namespace scripts hold
+// each traced method part-way down, the file is searched for a line whose header declares
+// the entity's name and from which the window's first lines match. Link itself is not
+// asked (⎕SE.Link.GetFileName gives the file, not the line), so a method that cannot be
+// found, or is found in more than one place, is reported in the returned note.
+func sourceLineOffset(window protocol.WindowContentArgs, fileLines []string) (int, string) {
+	if window.Filename == "" {
+		return 0, ""
+	}
+	if fileLines == nil || window.Offset > 0 {
+		return max(window.Offset, 0), ""
+	}
+	if len(window.Text) == 0 || matchesWindowAt(fileLines, window.Text, 0) {
+		return 0, ""
+	}
+	name := window.Name
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+	if name == "" || !headerDeclares(window.Text[0], name) {
+		return 0, ""
+	}
+	var matches []int
+	for i := range fileLines {
+		if headerDeclares(fileLines[i], name) && matchesWindowAt(fileLines, window.Text, i) {
+			matches = append(matches, i)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Sprintf("%s was not found in %s; its lines are shown from the top of the file", window.Name, window.Filename)
+	case 1:
+		return matches[0], ""
+	default:
+		return matches[0], fmt.Sprintf("%s matches %d places in %s; its lines are mapped to the first, at line %d", window.Name, len(matches), window.Filename, matches[0]+1)
+	}
+}
+
+// headerDeclares reports whether line is the header of a function or operator called
+// name: a dfn assignment such as name←{, or a tradfn header such as r←x name y;t,
+// {r}←(f name g) y or ∇name, optionally after a ∇ and before a ⍝ comment.
+func headerDeclares(line, name string) bool {
+	line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "∇"))
+	if comment := strings.IndexRune(line, '⍝'); comment >= 0 {
+		line = line[:comment]
+	}
+	if target, body, ok := strings.Cut(line, "←"); ok {
+		body = strings.TrimSpace(body)
+		if strings.HasPrefix(body, "{") {
+			// A dfn body runs to the end of the line (or onto later lines); a tradfn
+			// header such as r←{x}Fn y carries on after its optional left argument.
+			if closing := strings.LastIndex(body, "}"); closing < 0 || strings.TrimSpace(body[closing+1:]) == "" {
+				return strings.TrimSpace(target) == name
+			}
+		}
+		line = body
+	}
+	if locals := strings.IndexRune(line, ';'); locals >= 0 {
+		line = line[:locals]
+	}
+	if open := strings.IndexRune(line, '('); open >= 0 {
+		// An operator names itself between its operands: (f name g) or (f name).
+		closing := strings.IndexRune(line[open:], ')')
+		if closing < 0 {
+			return false
+		}
+		names := headerNames(line[open+1 : open+closing])
+		return len(names) >= 2 && names[1] == name
+	}
+	names := headerNames(line)
+	switch len(names) {
+	case 1, 2:
+		return names[0] == name
+	case 3:
+		return names[1] == name
+	default:
+		return false
+	}
+}
+
+// headerNames splits a header into its names, dropping braces and other punctuation.
+func headerNames(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool { return !isSymbolRune(r) })
+}
+
+// matchesWindowAt compares the first few window lines with the file from line start,
+// ignoring indentation and the ∇ that opens a function inside a script.
+func matchesWindowAt(fileLines, windowLines []string, start int) bool {
+	for i := 0; i < len(windowLines) && i < 3; i++ {
+		if start+i >= len(fileLines) || normalizeSourceLine(fileLines[start+i]) != normalizeSourceLine(windowLines[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeSourceLine(line string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "∇"))
+}
+
+// virtualSourcePath maps an entity name such as #.Ns.Fn to dyalog:/#/Ns/Fn.aplf.
+// Unqualified names are rooted at #.
+func virtualSourcePath(name string, entityType int) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ""
+	}
+	parts := strings.Split(name, ".")
+	if parts[0] != "#" && parts[0] != "⎕SE" {
+		parts = append([]string{"#"}, parts...)
+	}
+	uri := url.URL{
+		Scheme:   virtualSourceScheme,
+		Path:     "/" + strings.Join(parts, "/") + virtualSourceExtension(entityType),
+		OmitHost: true,
+	}
+	return uri.String()
+}
+
+func virtualSourceExtension(entityType int) string {
+	switch entityType {
+	case entityDefinedFunction:
+		return ".aplf"
+	case entityNamespace:
+		return ".apln"
+	case entityClass:
+		return ".aplc"
+	case entityInterface:
+		return ".apli"
+	case entityCharArray, entityNumericArray, entityMixedArray, entityNestedArray, entityCharVector:
+		return ".apla"
 	default:
-		return "stdout"
+		return ".apl"
+	}
+}
+
+// virtualSourceName recovers the qualified entity name (#.Ns.Fn) from a virtual path.
+func virtualSourceName(path string) (string, bool) {
+	segments, ok := virtualSourceSegments(path)
+	if !ok {
+		return "", false
+	}
+	last := segments[len(segments)-1]
+	if dot := strings.LastIndex(last, "."); dot > 0 {
+		segments[len(segments)-1] = last[:dot]
+	}
+	return strings.Join(segments, "."), true
+}
+
+// canonicalSourcePath normalizes a virtual path however the client escaped it, so it
+// matches the form used in adapter-sent sources. Other paths are returned unchanged.
+func canonicalSourcePath(path string) string {
+	segments, ok := virtualSourceSegments(path)
+	if !ok {
+		return path
+	}
+	uri := url.URL{Scheme: virtualSourceScheme, Path: "/" + strings.Join(segments, "/"), OmitHost: true}
+	return uri.String()
+}
+
+func virtualSourceSegments(path string) ([]string, bool) {
+	if !strings.HasPrefix(path, virtualSourceScheme+":") {
+		return nil, false
+	}
+	uri, err := url.Parse(path)
+	if err != nil || uri.Scheme != virtualSourceScheme {
+		return nil, false
+	}
+	// An unescaped # starts the URI fragment: dyalog:/#/Ns/Fn.aplf parses as "/" + "/Ns/Fn.aplf".
+	full := uri.Path
+	if uri.Fragment != "" {
+		full += "#" + uri.Fragment
+	}
+	segments := strings.Split(strings.Trim(full, "/"), "/")
+	if len(segments) < 2 || (segments[0] != "#" && segments[0] != "⎕SE") {
+		return nil, false
+	}
+	return segments, true
+}
+
+// sourceForBindingLocked describes a bound window's source with its client path. Virtual
+// sources carry only their dyalog: path, so clients key breakpoints on it and they
+// survive across sessions.
+func (s *Server) sourceForBindingLocked(binding sourceBinding) Source {
+	if _, virtual := virtualSourceName(binding.path); virtual {
+		return Source{Name: binding.displayName, Path: binding.path}
+	}
+	return Source{
+		Name:            binding.displayName,
+		Path:            s.localPathLocked(binding.path),
+		SourceReference: binding.sourceRef,
+	}
+}
+
+// mapPathRoots rewrites path from the longest matching root to its counterpart, as chosen
+// by roots. Windows-style roots (drive letter or UNC) match case-insensitively and either
+// separator; the result uses the target root's separator. Unmatched paths are unchanged.
+func mapPathRoots(path string, mappings []PathMapping, roots func(PathMapping) (string, string)) string {
+	if path == "" {
+		return path
+	}
+	normalized := strings.ReplaceAll(path, "\\", "/")
+	best, bestLen := "", -1
+	for _, mapping := range mappings {
+		from, to := roots(mapping)
+		if from == "" || to == "" {
+			continue
+		}
+		fromRoot := strings.TrimRight(strings.ReplaceAll(from, "\\", "/"), "/")
+		if len(normalized) < len(fromRoot) || len(fromRoot) <= bestLen {
+			continue
+		}
+		prefix := normalized[:len(fromRoot)]
+		if prefix != fromRoot && !(isWindowsPath(from) && strings.EqualFold(prefix, fromRoot)) {
+			continue
+		}
+		rest := normalized[len(fromRoot):]
+		if rest != "" && rest[0] != '/' {
+			continue
+		}
+		toRoot := strings.TrimRight(to, "/\\")
+		if isWindowsPath(to) {
+			rest = strings.ReplaceAll(rest, "/", "\\")
+		}
+		best, bestLen = toRoot+rest, len(fromRoot)
+	}
+	if bestLen < 0 {
+		return path
 	}
+	return best
+}
+
+func isWindowsPath(path string) bool {
+	if strings.HasPrefix(path, "\\\\") {
+		return true
+	}
+	return len(path) >= 2 && path[1] == ':' &&
+		((path[0] >= 'a' && path[0] <= 'z') || (path[0] >= 'A' && path[0] <= 'Z'))
 }
 
 func (s *Server) ensureScopeForFrame(frameID int) (int, bool) {
@@ -2395,7 +4772,7 @@ func (s *Server) buildInspectableSymbolVariable(symbol frameSymbol) Variable {
 		valueType = fmt.Sprintf("nameclass(%d)", symbol.class)
 	}
 
-	preview, children := buildValuePreviewAndChildren(symbol.value)
+	preview, children := buildValuePreviewAndChildren(symbol.value, s.limits.MaxLocalValuePreviewRunes, s.limits.MaxLocalValueChildren)
 	childRef := 0
 	if len(children) > 0 {
 		childRef = s.allocateVariablesReference(children)
@@ -2409,43 +4786,43 @@ func (s *Server) buildInspectableSymbolVariable(symbol frameSymbol) Variable {
 	}
 }
 
-func buildValuePreviewAndChildren(value string) (string, []Variable) {
+func buildValuePreviewAndChildren(value string, previewRunes, maxChildren int) (string, []Variable) {
 	if value == "" {
 		return "", []Variable{}
 	}
 	lines := strings.Split(value, "\n")
 	firstLine := lines[0]
-	preview := truncateRunes(firstLine, maxLocalValuePreviewRunes)
+	preview := truncateRunes(firstLine, previewRunes)
 	if len(lines) > 1 {
-		preview = fmt.Sprintf("%s … (+%d lines)", truncateRunes(firstLine, maxLocalValuePreviewRunes/2), len(lines)-1)
+		preview = fmt.Sprintf("%s … (+%d lines)", truncateRunes(firstLine, previewRunes/2), len(lines)-1)
 	}
 
-	hasLongSingleLine := len(lines) == 1 && utf8.RuneCountInString(firstLine) > maxLocalValuePreviewRunes
+	hasLongSingleLine := len(lines) == 1 && utf8.RuneCountInString(firstLine) > previewRunes
 	if len(lines) == 1 && !hasLongSingleLine {
 		return preview, []Variable{}
 	}
 
-	children := make([]Variable, 0, maxLocalValueChildren+1)
+	children := make([]Variable, 0, maxChildren+1)
 	entries := lines
 	if hasLongSingleLine {
-		entries = chunkByRunes(firstLine, maxLocalValuePreviewRunes)
+		entries = chunkByRunes(firstLine, previewRunes)
 	}
 	limit := len(entries)
-	if limit > maxLocalValueChildren {
-		limit = maxLocalValueChildren
+	if limit > maxChildren {
+		limit = maxChildren
 	}
 	for i := 0; i < limit; i++ {
 		children = append(children, Variable{
 			Name:               fmt.Sprintf("[%d]", i),
-			Value:              truncateRunes(entries[i], maxLocalValuePreviewRunes),
+			Value:              truncateRunes(entries[i], previewRunes),
 			Type:               "string",
 			VariablesReference: 0,
 		})
 	}
-	if len(entries) > maxLocalValueChildren {
+	if len(entries) > maxChildren {
 		children = append(children, Variable{
 			Name:               "[...]",
-			Value:              fmt.Sprintf("%d more entries", len(entries)-maxLocalValueChildren),
+			Value:              fmt.Sprintf("%d more entries", len(entries)-maxChildren),
 			Type:               "string",
 			VariablesReference: 0,
 		})
@@ -2518,14 +4895,6 @@ func (s *Server) dropVariableReference(ref int) {
 	}
 }
 
-func (s *Server) dropPendingSymbolTipsForFrame(frameID int) {
-	for token, pending := range s.pendingSymbolTips {
-		if pending.frameID == frameID {
-			delete(s.pendingSymbolTips, token)
-		}
-	}
-}
-
 func oneBased(value int) int {
 	if value < 0 {
 		return 1
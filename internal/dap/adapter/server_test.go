@@ -1,14 +1,18 @@
 package adapter
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stefan/lsp-dap/internal/ride/protocol"
+	"github.com/stefan/lsp-dap/internal/ride/sessionstate"
 )
 
 func TestHandleRequest_InitializeReturnsCapabilitiesAndInitializedEvent(t *testing.T) {
@@ -259,21 +263,73 @@ type rideCall struct {
 }
 
 type mockRideController struct {
+	mu               sync.Mutex
 	calls            []rideCall
 	sendErr          error
 	sendErrByCommand map[string]error
 	onSend           func(command string, args map[string]any)
+	pending          []*mockRequest
 }
 
-func (m *mockRideController) SendCommand(command string, args any) error {
-	typedArgs := map[string]any{}
-	if args != nil {
-		typedArgs = args.(map[string]any)
+type mockRequest struct {
+	match sessionstate.ReplyMatcher
+	reply chan protocol.DecodedPayload
+}
+
+// Request correlates replies like the session dispatcher: payloads passed to receive
+// answer the oldest pending request that matches them.
+func (m *mockRideController) Request(ctx context.Context, command string, args any, match sessionstate.ReplyMatcher) (protocol.DecodedPayload, error) {
+	pending := &mockRequest{match: match, reply: make(chan protocol.DecodedPayload, 1)}
+	m.mu.Lock()
+	m.pending = append(m.pending, pending)
+	m.mu.Unlock()
+	defer m.dropRequest(pending)
+
+	if err := m.SendCommand(command, args); err != nil {
+		return protocol.DecodedPayload{}, err
+	}
+	select {
+	case reply := <-pending.reply:
+		return reply, nil
+	case <-ctx.Done():
+		return protocol.DecodedPayload{}, ctx.Err()
+	}
+}
+
+// receive passes an inbound payload to a pending Request before the server, in the order
+// the dispatcher and the adapter's receive loop see it.
+func (m *mockRideController) receive(server *Server, decoded protocol.DecodedPayload) []Event {
+	m.mu.Lock()
+	for i, pending := range m.pending {
+		if pending.match(decoded) {
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			pending.reply <- decoded
+			break
+		}
+	}
+	m.mu.Unlock()
+	return server.HandleRidePayload(decoded)
+}
+
+func (m *mockRideController) dropRequest(pending *mockRequest) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, candidate := range m.pending {
+		if candidate == pending {
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			return
+		}
 	}
+}
+
+func (m *mockRideController) SendCommand(command string, args any) error {
+	typedArgs := callArgs(args)
+	m.mu.Lock()
 	m.calls = append(m.calls, rideCall{
 		command: command,
 		args:    typedArgs,
 	})
+	m.mu.Unlock()
 	if m.onSend != nil {
 		m.onSend(command, typedArgs)
 	}
@@ -289,6 +345,28 @@ func (m *mockRideController) SendCommand(command string, args any) error {
 	return nil
 }
 
+// callArgs flattens a typed RIDE argument struct into its JSON field names so calls
+// can be inspected uniformly; field values keep their Go types.
+func callArgs(args any) map[string]any {
+	switch v := args.(type) {
+	case nil:
+		return map[string]any{}
+	case map[string]any:
+		return v
+	}
+	value := reflect.ValueOf(args)
+	fields := map[string]any{}
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = value.Field(i).Interface()
+	}
+	return fields
+}
+
 func (m *mockRideController) lastCall() rideCall {
 	if len(m.calls) == 0 {
 		return rideCall{}
@@ -569,8 +647,8 @@ func TestHandleRideReconnect_RequestsLayoutAndResetsActiveState(t *testing.T) {
 	}
 
 	reconnectEvents := server.HandleRideReconnect()
-	if len(reconnectEvents) != 1 || reconnectEvents[0].Event != "output" {
-		t.Fatalf("expected reconnect output event, got %#v", reconnectEvents)
+	if len(reconnectEvents) != 2 || reconnectEvents[0].Event != "output" || reconnectEvents[1].Event != "invalidated" {
+		t.Fatalf("expected reconnect output and invalidated events, got %#v", reconnectEvents)
 	}
 	if ride.lastCall().command != "GetWindowLayout" {
 		t.Fatalf("expected GetWindowLayout after reconnect, got %q", ride.lastCall().command)
@@ -655,6 +733,81 @@ func TestHandleRideReconnect_RebuildsSourceMappingFromLayoutEvents(t *testing.T)
 	}
 }
 
+func TestHandleRideReconnect_ReappliesActiveBreakpointsWhenWindowReopens(t *testing.T) {
+	ride := &mockRideController{}
+	server := NewServer()
+	server.SetRideController(ride)
+	enterRunningState(t, server)
+
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    711,
+			Filename: "/ws/src/reapply.apl",
+		},
+	})
+	resp, _ := server.HandleRequest(Request{
+		Seq:     50,
+		Command: "setBreakpoints",
+		Arguments: map[string]any{
+			"source": map[string]any{
+				"path": "/ws/src/reapply.apl",
+			},
+			"breakpoints": []any{
+				map[string]any{"line": 2},
+				map[string]any{"line": 5},
+			},
+		},
+	})
+	if !resp.Success {
+		t.Fatalf("expected setBreakpoints success, got %s", resp.Message)
+	}
+
+	_ = server.HandleRideReconnect()
+	ride.calls = nil
+
+	events := server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    712,
+			Filename: "/ws/src/reapply.apl",
+		},
+	})
+	last := ride.lastCall()
+	if last.command != "SetLineAttributes" || last.args["win"] != 712 {
+		t.Fatalf("expected breakpoints re-applied to reopened window, got %#v", ride.calls)
+	}
+	stop := last.args["stop"].([]int)
+	if len(stop) != 2 || stop[0] != 1 || stop[1] != 4 {
+		t.Fatalf("expected stop=[1 4], got %#v", stop)
+	}
+	if len(events) == 0 || events[0].Event != "output" {
+		t.Fatalf("expected deferred apply diagnostic, got %#v", events)
+	}
+}
+
+func TestHandleRideConnectionLost_TerminatesSession(t *testing.T) {
+	server := NewServer()
+	server.SetRideController(&mockRideController{})
+	enterRunningState(t, server)
+
+	events := server.HandleRideConnectionLost(errors.New("connection refused"))
+	if len(events) != 2 || events[0].Event != "output" || events[1].Event != "terminated" {
+		t.Fatalf("expected output and terminated events, got %#v", events)
+	}
+	if !strings.Contains(events[0].Body.(OutputEventBody).Output, "connection refused") {
+		t.Fatalf("expected cause in output, got %#v", events[0])
+	}
+	if !server.SessionTerminated() {
+		t.Fatal("expected session to be terminated")
+	}
+	if again := server.HandleRideConnectionLost(nil); len(again) != 0 {
+		t.Fatalf("expected no events once terminated, got %#v", again)
+	}
+}
+
 func TestHandleRidePayload_OpenWindowNonDebuggerDoesNotEmitStopped(t *testing.T) {
 	server := NewServer()
 	enterRunningState(t, server)
@@ -714,6 +867,79 @@ func TestHandleRequest_ThreadsPollsGetThreadsAndReturnsCachedThreads(t *testing.
 	}
 }
 
+// The session dispatcher correlates replies itself, so the server hands it whole requests.
+var _ RideCommandSender = (*sessionstate.Dispatcher)(nil)
+
+type requestingRideController struct {
+	mockRideController
+	replies  map[string]protocol.DecodedPayload
+	requests []string
+}
+
+func (m *requestingRideController) Request(ctx context.Context, command string, args any, match sessionstate.ReplyMatcher) (protocol.DecodedPayload, error) {
+	m.mu.Lock()
+	m.requests = append(m.requests, command)
+	m.mu.Unlock()
+	reply, ok := m.replies[command]
+	if !ok || !match(reply) {
+		<-ctx.Done()
+		return protocol.DecodedPayload{}, ctx.Err()
+	}
+	return reply, nil
+}
+
+func TestHandleRequest_ThreadsStackTraceAndSaveUseControllerRequests(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+	ride := &requestingRideController{replies: map[string]protocol.DecodedPayload{
+		"GetThreads": {
+			Kind:    protocol.KindCommand,
+			Command: "ReplyGetThreads",
+			Args:    protocol.ReplyGetThreadsArgs{Threads: []protocol.ThreadInfo{{Tid: 3, Description: "Worker"}}},
+		},
+		"GetSIStack": {
+			Kind:    protocol.KindCommand,
+			Command: "ReplyGetSIStack",
+			Args:    protocol.ReplyGetSIStackArgs{Tid: 3, Stack: []protocol.SIStackEntry{{Description: "#.Work[2]"}}},
+		},
+		"SaveChanges": {
+			Kind:    protocol.KindCommand,
+			Command: "ReplySaveChanges",
+			Args:    map[string]any{"win": float64(41), "err": float64(0)},
+		},
+	}}
+	server.SetRideController(ride)
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args:    protocol.WindowContentArgs{Token: 41, Debugger: true, Tid: 3, Name: "Work", Text: []string{"Work", "x←1", "y←2"}},
+	})
+
+	resp, _ := server.HandleRequest(Request{Seq: 10, Command: "threads"})
+	threads := resp.Body.(ThreadsResponseBody).Threads
+	if !resp.Success || len(threads) != 1 || threads[0].ID != 3 || threads[0].Name != "Worker" {
+		t.Fatalf("expected threads from the correlated reply, got %#v", resp)
+	}
+
+	resp, _ = server.HandleRequest(Request{Seq: 11, Command: "stackTrace", Arguments: map[string]any{"threadId": 3}})
+	frames := resp.Body.(StackTraceResponseBody).StackFrames
+	if !resp.Success || len(frames) != 1 || frames[0].Name != "#.Work[2]" {
+		t.Fatalf("expected frame named from the correlated SI stack, got %#v", resp)
+	}
+
+	resp, _ = server.HandleRequest(Request{Seq: 12, Command: "dyalog/saveChanges", Arguments: map[string]any{"win": 41, "content": "Work\nx←1"}})
+	if !resp.Success {
+		t.Fatalf("expected save answered through Request, got %q", resp.Message)
+	}
+
+	if got := strings.Join(ride.requests, ","); got != "GetThreads,GetSIStack,SaveChanges" {
+		t.Fatalf("expected requests to go through the controller, got %q", got)
+	}
+	if len(ride.calls) != 0 {
+		t.Fatalf("expected no fire-and-forget sends, got %#v", ride.calls)
+	}
+}
+
 func TestHandleRidePayload_ReplyGetThreadsMaintainsStableIDsAcrossUpdates(t *testing.T) {
 	ride := &mockRideController{}
 	server := NewServer()
@@ -1191,32 +1417,31 @@ func TestHandleRequest_ScopesAndVariablesExposeLocalsAndGlobalsCategories(t *tes
 	server := NewServer()
 	enterRunningState(t, server)
 
-	ride := &mockRideController{
-		onSend: func(command string, args map[string]any) {
-			if command != "GetValueTip" {
-				return
-			}
-			name := args["line"].(string)
-			token := args["token"]
-			reply := []any{"0"}
-			switch name {
-			case "a":
-				reply = []any{"1"}
-			case "b":
-				reply = []any{"2 3 4"}
-			case "g":
-				reply = []any{"99"}
-			}
-			server.HandleRidePayload(protocol.DecodedPayload{
-				Kind:    protocol.KindCommand,
-				Command: "ValueTip",
-				Args: map[string]any{
-					"tip":   reply,
-					"class": 2,
-					"token": token,
-				},
-			})
-		},
+	ride := &mockRideController{}
+	ride.onSend = func(command string, args map[string]any) {
+		if command != "GetValueTip" {
+			return
+		}
+		name := args["line"].(string)
+		token := args["token"]
+		reply := []any{"0"}
+		switch name {
+		case "a":
+			reply = []any{"1"}
+		case "b":
+			reply = []any{"2 3 4"}
+		case "g":
+			reply = []any{"99"}
+		}
+		ride.receive(server, protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "ValueTip",
+			Args: map[string]any{
+				"tip":   reply,
+				"class": 2,
+				"token": token,
+			},
+		})
 	}
 	server.SetRideController(ride)
 
@@ -1321,6 +1546,149 @@ func TestHandleRequest_ScopesAndVariablesExposeLocalsAndGlobalsCategories(t *tes
 	}
 }
 
+func TestHandleRequest_CompletionsUseGetAutocompleteInSession(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	ride := &mockRideController{}
+	ride.onSend = func(command string, args map[string]any) {
+		if command != "GetAutocomplete" {
+			return
+		}
+		server.HandleRidePayload(protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "ReplyGetAutocomplete",
+			Args: protocol.ReplyGetAutocompleteArgs{
+				Options: []string{"⎕IO", "⎕IO", "⎕IT"},
+				Skip:    2,
+				Token:   args["token"].(int),
+			},
+		})
+	}
+	server.SetRideController(ride)
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:       300,
+		Command:   "completions",
+		Arguments: map[string]any{"text": "x←⎕I", "column": 5},
+	})
+	if !resp.Success {
+		t.Fatalf("expected completions success, got %s", resp.Message)
+	}
+	call := ride.lastCall()
+	if call.command != "GetAutocomplete" || call.args["line"] != "x←⎕I" || call.args["pos"] != 4 || call.args["win"] != 0 {
+		t.Fatalf("unexpected GetAutocomplete call: %#v", call)
+	}
+	targets := resp.Body.(CompletionsResponseBody).Targets
+	if len(targets) != 2 {
+		t.Fatalf("expected de-duplicated targets, got %#v", targets)
+	}
+	if targets[0] != (CompletionItem{Label: "⎕IO", Type: "function", Start: 3, Length: 2}) {
+		t.Fatalf("unexpected first target: %#v", targets[0])
+	}
+}
+
+func TestHandleRequest_CompletionsIncludePausedFrameLocals(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	ride := &mockRideController{}
+	ride.onSend = func(command string, args map[string]any) {
+		if command != "GetAutocomplete" {
+			return
+		}
+		server.HandleRidePayload(protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "ReplyGetAutocomplete",
+			Args: map[string]any{
+				"options": []any{"alpha"},
+				"skip":    2,
+				"token":   args["token"],
+			},
+		})
+	}
+	server.SetRideController(ride)
+
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    512,
+			Debugger: true,
+			Name:     "TopFn",
+			Filename: "/ws/src/top.apl",
+			Text:     []string{"TopFn;alpha;alto;beta", "alpha←1"},
+		},
+	})
+	if resp, _ := server.HandleRequest(Request{Seq: 301, Command: "scopes", Arguments: map[string]any{"frameId": 512}}); !resp.Success {
+		t.Fatalf("expected scopes success, got %s", resp.Message)
+	}
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:       302,
+		Command:   "completions",
+		Arguments: map[string]any{"text": "al", "column": 3},
+	})
+	if !resp.Success {
+		t.Fatalf("expected completions success, got %s", resp.Message)
+	}
+	if got := ride.lastCall().args["win"]; got != 512 {
+		t.Fatalf("expected completions in the paused frame window, got %#v", got)
+	}
+	labels := map[string]string{}
+	for _, target := range resp.Body.(CompletionsResponseBody).Targets {
+		labels[target.Label] = target.Type
+	}
+	if len(labels) != 2 || labels["alpha"] != "variable" || labels["alto"] != "variable" {
+		t.Fatalf("expected interpreter option plus matching local, got %#v", labels)
+	}
+}
+
+func TestSetLimits_AppliesSessionValueLimitsToLocalsFetch(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+	server.SetLimits(Limits{
+		LocalsFetchTimeout:        20 * time.Millisecond,
+		MaxLocalValuePreviewRunes: 10,
+		MaxLocalValueChildren:     4,
+		MaxLocalSymbolsPerFrame:   1,
+	})
+	if got := server.limits.EvaluateTimeout; got != evaluateTimeout {
+		t.Fatalf("expected unset evaluate timeout to keep default, got %s", got)
+	}
+
+	ride := &mockRideController{}
+	server.SetRideController(ride)
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    512,
+			Debugger: true,
+			Name:     "TopFn",
+			Filename: "/ws/src/top.apl",
+			Text:     []string{"TopFn;a;b", "a←1", "b←2"},
+		},
+	})
+	if resp, _ := server.HandleRequest(Request{Seq: 310, Command: "scopes", Arguments: map[string]any{"frameId": 512}}); !resp.Success {
+		t.Fatalf("expected scopes success, got %s", resp.Message)
+	}
+
+	tips := 0
+	for _, call := range ride.calls {
+		if call.command != "GetValueTip" {
+			continue
+		}
+		tips++
+		if call.args["maxWidth"] != 10 || call.args["maxHeight"] != 4 {
+			t.Fatalf("expected session value limits on GetValueTip, got %#v", call.args)
+		}
+	}
+	if tips != 1 {
+		t.Fatalf("expected one symbol fetched with MaxLocalSymbolsPerFrame=1, got %d", tips)
+	}
+}
+
 func TestHandleRequest_LocalVariableLongValueIsExpandableAndStableAcrossRefresh(t *testing.T) {
 	server := NewServer()
 	enterRunningState(t, server)
@@ -1331,24 +1699,23 @@ func TestHandleRequest_LocalVariableLongValueIsExpandableAndStableAcrossRefresh(
 	}
 	longValue := strings.Join(longLines, "\n")
 
-	ride := &mockRideController{
-		onSend: func(command string, args map[string]any) {
-			if command != "GetValueTip" {
-				return
-			}
-			if args["line"] != "a" {
-				return
-			}
-			server.HandleRidePayload(protocol.DecodedPayload{
-				Kind:    protocol.KindCommand,
-				Command: "ValueTip",
-				Args: map[string]any{
-					"tip":   strings.Split(longValue, "\n"),
-					"class": 2,
-					"token": args["token"],
-				},
-			})
-		},
+	ride := &mockRideController{}
+	ride.onSend = func(command string, args map[string]any) {
+		if command != "GetValueTip" {
+			return
+		}
+		if args["line"] != "a" {
+			return
+		}
+		ride.receive(server, protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "ValueTip",
+			Args: map[string]any{
+				"tip":   strings.Split(longValue, "\n"),
+				"class": 2,
+				"token": args["token"],
+			},
+		})
 	}
 	server.SetRideController(ride)
 
@@ -1474,7 +1841,7 @@ func TestHandleRequest_EvaluateWatchUsesValueTipAndReturnsDecodedResult(t *testi
 		if command != "GetValueTip" {
 			return
 		}
-		server.HandleRidePayload(protocol.DecodedPayload{
+		ride.receive(server, protocol.DecodedPayload{
 			Kind:    protocol.KindCommand,
 			Command: "ValueTip",
 			Args: map[string]any{
@@ -1582,7 +1949,7 @@ func TestHandleRequest_EvaluateHoverUsesValueTip(t *testing.T) {
 		if command != "GetValueTip" {
 			return
 		}
-		server.HandleRidePayload(protocol.DecodedPayload{
+		ride.receive(server, protocol.DecodedPayload{
 			Kind:    protocol.KindCommand,
 			Command: "ValueTip",
 			Args: map[string]any{
@@ -1696,34 +2063,957 @@ func TestHandleRequest_EvaluateReplExecutesAndReturnsSessionOutput(t *testing.T)
 	}
 }
 
-func TestHandleRidePayload_AppendSessionOutputEmitsOutputEventAndSkipsEcho(t *testing.T) {
+func TestHandleRequest_EvaluateReplQueuesConcurrentEvaluatesInOrder(t *testing.T) {
 	server := NewServer()
 	enterRunningState(t, server)
 
-	events := server.HandleRidePayload(protocol.DecodedPayload{
-		Kind:    protocol.KindCommand,
-		Command: "AppendSessionOutput",
-		Args: protocol.AppendSessionOutputArgs{
-			Result: "      1+1\n",
-			Type:   14,
-			Group:  0,
-		},
-	})
-	if len(events) != 0 {
-		t.Fatalf("expected echoed input (type=14) to be suppressed, got %#v", events)
+	executed := make(chan string, 4)
+	ride := &mockRideController{}
+	ride.onSend = func(command string, args map[string]any) {
+		if command == "Execute" {
+			executed <- args["text"].(string)
+		}
 	}
+	server.SetRideController(ride)
 
-	events = server.HandleRidePayload(protocol.DecodedPayload{
-		Kind:    protocol.KindCommand,
-		Command: "AppendSessionOutput",
-		Args: protocol.AppendSessionOutputArgs{
-			Result: "2\n",
-			Type:   3,
-			Group:  0,
-		},
-	})
-	if len(events) != 1 || events[0].Event != "output" {
-		t.Fatalf("expected one output event, got %#v", events)
+	evaluate := func(seq int, expression string) <-chan Response {
+		done := make(chan Response, 1)
+		go func() {
+			resp, _ := server.HandleRequest(Request{
+				Seq:       seq,
+				Command:   "evaluate",
+				Arguments: map[string]any{"expression": expression, "context": "repl"},
+			})
+			done <- resp
+		}()
+		return done
+	}
+	appendOutput := func(result string, outputType, group int) {
+		server.HandleRidePayload(protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "AppendSessionOutput",
+			Args:    protocol.AppendSessionOutputArgs{Result: result, Type: outputType, Group: group},
+		})
+	}
+	setPrompt := func(promptType int) {
+		server.HandleRidePayload(protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "SetPromptType",
+			Args:    protocol.SetPromptTypeArgs{Type: promptType},
+		})
+	}
+	nextExecute := func() string {
+		select {
+		case text := <-executed:
+			return text
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for Execute")
+			return ""
+		}
+	}
+
+	first := evaluate(90, "1+1")
+	if got := nextExecute(); got != "1+1\n" {
+		t.Fatalf("expected first Execute, got %q", got)
+	}
+	second := evaluate(91, "2+1")
+	select {
+	case text := <-executed:
+		t.Fatalf("expected second evaluate to wait for the prompt, got Execute %q", text)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	appendOutput("      1+1\n", 14, 7)
+	setPrompt(0)
+	appendOutput("2\n", 3, 0)
+	setPrompt(1)
+	if got := nextExecute(); got != "2+1\n" {
+		t.Fatalf("expected queued Execute after prompt, got %q", got)
+	}
+	appendOutput("      2+1\n", 14, 8)
+	setPrompt(0)
+	appendOutput("3\n", 3, 8)
+	setPrompt(1)
+
+	for _, want := range []struct {
+		done   <-chan Response
+		result string
+	}{{first, "2"}, {second, "3"}} {
+		select {
+		case resp := <-want.done:
+			if !resp.Success {
+				t.Fatalf("expected repl evaluate success, got %s", resp.Message)
+			}
+			if got := resp.Body.(EvaluateResponseBody).Result; got != want.result {
+				t.Fatalf("expected result %q, got %q", want.result, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for result %q", want.result)
+		}
+	}
+}
+
+func TestHandleRequest_CancelInterruptsRunningReplAndDropsQueuedOne(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	sent := make(chan rideCall, 8)
+	ride := &mockRideController{}
+	ride.onSend = func(command string, args map[string]any) {
+		sent <- rideCall{command: command, args: args}
+	}
+	server.SetRideController(ride)
+
+	evaluate := func(seq int, expression string) <-chan Response {
+		done := make(chan Response, 1)
+		go func() {
+			resp, _ := server.HandleRequest(Request{
+				Seq:       seq,
+				Command:   "evaluate",
+				Arguments: map[string]any{"expression": expression, "context": "repl"},
+			})
+			done <- resp
+		}()
+		return done
+	}
+	awaitResponse := func(done <-chan Response) Response {
+		select {
+		case resp := <-done:
+			return resp
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for evaluate response")
+			return Response{}
+		}
+	}
+
+	running := evaluate(95, "Spin 0")
+	if call := <-sent; call.command != "Execute" {
+		t.Fatalf("expected Execute, got %#v", call)
+	}
+	queued := evaluate(96, "1+1")
+	time.Sleep(20 * time.Millisecond)
+
+	if resp, _ := server.HandleRequest(Request{Seq: 97, Command: "cancel", Arguments: map[string]any{"requestId": 96}}); !resp.Success {
+		t.Fatalf("expected cancel success, got %s", resp.Message)
+	}
+	if resp := awaitResponse(queued); resp.Success || resp.Message != "cancelled" {
+		t.Fatalf("expected queued evaluate to be cancelled, got %#v", resp)
+	}
+
+	if resp, _ := server.HandleRequest(Request{Seq: 98, Command: "cancel", Arguments: map[string]any{"requestId": 95}}); !resp.Success {
+		t.Fatalf("expected cancel success, got %s", resp.Message)
+	}
+	if call := <-sent; call.command != "WeakInterrupt" {
+		t.Fatalf("expected WeakInterrupt for running evaluate, got %#v", call)
+	}
+	if resp := awaitResponse(running); resp.Success || resp.Message != "cancelled" {
+		t.Fatalf("expected running evaluate to be cancelled, got %#v", resp)
+	}
+
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "SetPromptType",
+		Args:    protocol.SetPromptTypeArgs{Type: 1},
+	})
+	select {
+	case call := <-sent:
+		t.Fatalf("expected cancelled queued evaluate never to be sent, got %#v", call)
+	default:
+	}
+}
+
+func TestHandleRequest_CancelDropsWatchEvaluateWaiter(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+	ride := &mockRideController{}
+	server.SetRideController(ride)
+	server.SetActiveTracerWindow(1)
+
+	done := make(chan Response, 1)
+	go func() {
+		resp, _ := server.HandleRequest(Request{
+			Seq:       99,
+			Command:   "evaluate",
+			Arguments: map[string]any{"expression": "x", "context": "watch"},
+		})
+		done <- resp
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		server.mu.Lock()
+		_, registered := server.evaluateRequests[99]
+		server.mu.Unlock()
+		if registered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("watch evaluate never registered a waiter")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if resp, _ := server.HandleRequest(Request{Seq: 100, Command: "cancel", Arguments: map[string]any{"requestId": 99}}); !resp.Success {
+		t.Fatalf("expected cancel success, got %s", resp.Message)
+	}
+	select {
+	case resp := <-done:
+		if resp.Success || resp.Message != "cancelled" {
+			t.Fatalf("expected cancelled watch evaluate, got %#v", resp)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("expected cancel to release watch evaluate before its timeout")
+	}
+	ride.mu.Lock()
+	pending := len(ride.pending)
+	ride.mu.Unlock()
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if pending != 0 || len(server.evaluateRequests) != 0 {
+		t.Fatalf("expected evaluate waiter to be dropped, got %d pending requests", pending)
+	}
+}
+
+func TestHandleRequest_EvaluateWatchExpressionRunsViaExecuteWithDrillDown(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	var forwarded []Event
+	replies := map[string][]string{
+		"+/x":   {"1 2\n", "3 4\n"},
+		"⍴data": {"3\n"},
+		"⍴bad":  {watchErrorMarker + "VALUE ERROR\n"},
+	}
+	ride := &mockRideController{}
+	ride.onSend = func(command string, args map[string]any) {
+		if command != "Execute" {
+			return
+		}
+		text := args["text"].(string)
+		for expression, lines := range replies {
+			if text != watchCaptureExpression(expression)+"\n" {
+				continue
+			}
+			server.HandleRidePayload(protocol.DecodedPayload{
+				Kind:    protocol.KindCommand,
+				Command: "SetPromptType",
+				Args:    protocol.SetPromptTypeArgs{Type: 0},
+			})
+			for _, line := range lines {
+				forwarded = append(forwarded, server.HandleRidePayload(protocol.DecodedPayload{
+					Kind:    protocol.KindCommand,
+					Command: "AppendSessionOutput",
+					Args:    protocol.AppendSessionOutputArgs{Result: line, Type: 2},
+				})...)
+			}
+			server.HandleRidePayload(protocol.DecodedPayload{
+				Kind:    protocol.KindCommand,
+				Command: "SetPromptType",
+				Args:    protocol.SetPromptTypeArgs{Type: 1},
+			})
+		}
+	}
+	server.SetRideController(ride)
+	server.SetActiveTracerWindow(512)
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:       120,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": "+/x", "context": "watch", "frameId": 512},
+	})
+	if !resp.Success {
+		t.Fatalf("expected watch evaluate success, got %s", resp.Message)
+	}
+	if call := ride.lastCall(); call.command != "Execute" || call.args["trace"] != 0 {
+		t.Fatalf("expected untraced Execute for watch expression, got %#v", call)
+	}
+	if len(forwarded) != 0 {
+		t.Fatalf("expected watch output to stay out of the Debug Console, got %#v", forwarded)
+	}
+	body := resp.Body.(EvaluateResponseBody)
+	if body.Result != "1 2 … (+1 lines)" || body.VariablesReference <= 0 {
+		t.Fatalf("expected expandable watch result, got %#v", body)
+	}
+	vars, _ := server.HandleRequest(Request{
+		Seq:       121,
+		Command:   "variables",
+		Arguments: map[string]any{"variablesReference": body.VariablesReference},
+	})
+	children := vars.Body.(VariablesResponseBody).Variables
+	if len(children) != 2 || children[1].Value != "3 4" {
+		t.Fatalf("unexpected watch drill-down children: %#v", children)
+	}
+
+	resp, _ = server.HandleRequest(Request{
+		Seq:       122,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": "⍴data", "context": "watch", "frameId": 512},
+	})
+	if !resp.Success || resp.Body.(EvaluateResponseBody).Result != "3" {
+		t.Fatalf("expected ⍴data watch to run via Execute, got %#v", resp)
+	}
+	if call := ride.lastCall(); call.command != "Execute" || call.args["text"] != watchCaptureExpression("⍴data")+"\n" {
+		t.Fatalf("expected ⍴data watch sent as Execute, got %#v", call)
+	}
+
+	resp, _ = server.HandleRequest(Request{
+		Seq:       124,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": "⍴bad", "context": "watch"},
+	})
+	if resp.Success || resp.Message != "VALUE ERROR" {
+		t.Fatalf("expected trapped watch error, got %#v", resp)
+	}
+
+	resp, _ = server.HandleRequest(Request{
+		Seq:       123,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": "+/x", "context": "watch", "frameId": 511},
+	})
+	if resp.Success {
+		t.Fatal("expected watch expression in a lower frame to be rejected")
+	}
+
+	sent := len(ride.calls)
+	for seq, expression := range []string{"⎕NDELETE 'scratch.txt'", "x←0", "⍎'x←0'", "⎕FX 'f' 'f'", "⍵+1", "⍺×2"} {
+		resp, _ = server.HandleRequest(Request{
+			Seq:       130 + seq,
+			Command:   "evaluate",
+			Arguments: map[string]any{"expression": expression, "context": "watch", "frameId": 512},
+		})
+		if resp.Success || !strings.HasPrefix(resp.Message, "watch evaluate refused: ") {
+			t.Fatalf("expected watch %q to be refused, got %#v", expression, resp)
+		}
+	}
+	if len(ride.calls) != sent {
+		t.Fatalf("expected refused watches not to reach the interpreter, got %#v", ride.calls[sent:])
+	}
+}
+
+func TestCheckWatchExpression_RefusesSideEffectsAndDfnArguments(t *testing.T) {
+	cases := []struct {
+		expression string
+		allowed    bool
+	}{
+		{"total", true},
+		{"+/x", true},
+		{"⍴data", true},
+		{"obj.Prop", true},
+		{"⎕io+⍳3", true},
+		{"'a←b',name", true},
+		{"x ⍝ note ⎕SH", true},
+		{"x←1", false},
+		{"data[1]←0", false},
+		{"⍎'x'", false},
+		{"⎕FX 'f' 'f'", false},
+		{"⎕sh 'ls'", false},
+		{"⎕SE.Link.Status", false},
+		{"⎕", false},
+		{"⍞", false},
+		{"⍵", false},
+		{"⍺+⍵", false},
+		{"∇ 3", false},
+		{")CLEAR", false},
+		{"]Box on", false},
+		{" ", false},
+	}
+	for _, tc := range cases {
+		err := checkWatchExpression(tc.expression)
+		if (err == nil) != tc.allowed {
+			t.Fatalf("checkWatchExpression(%q) = %v, want allowed=%v", tc.expression, err, tc.allowed)
+		}
+	}
+}
+
+func TestWatchCaptureExpression_TrapsOnlyExpressionErrors(t *testing.T) {
+	got := watchCaptureExpression(" 'it''s',x ")
+	want := "{2 3 4 5 6 7 11 16::'" + watchErrorMarker + "',⊃⎕DM ⋄ ⍎⍵}'''it''''s'',x'"
+	if got != want {
+		t.Fatalf("watchCaptureExpression = %q, want %q", got, want)
+	}
+}
+
+func TestCheckHoverExpression_RefusesSideEffects(t *testing.T) {
+	allowlist := map[string]bool{"⎕NNUMS": true, "cfg.Name": true}
+	cases := []struct {
+		expression string
+		allowed    bool
+	}{
+		{"total", true},
+		{" ⎕io ", true},
+		{"⎕TS", true},
+		{"⎕nnums", true},
+		{"cfg.Name", true},
+		{"x←1", false},
+		{"⎕SH 'rm -rf /'", false},
+		{"⎕NDELETE", false},
+		{"⎕CMD", false},
+		{"Run 42", false},
+		{"+/x", false},
+		{"cfg.Other", false},
+		{"", false},
+	}
+	for _, tc := range cases {
+		err := checkHoverExpression(tc.expression, allowlist)
+		if (err == nil) != tc.allowed {
+			t.Fatalf("checkHoverExpression(%q) = %v, want allowed=%v", tc.expression, err, tc.allowed)
+		}
+	}
+}
+
+func TestHandleRequest_EvaluateHoverRefusesSideEffectsWithoutContactingRide(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+	ride := &mockRideController{}
+	server.SetRideController(ride)
+	server.SetActiveTracerWindow(1)
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:       130,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": "⎕NDELETE 'data.txt'", "context": "hover", "frameId": 1},
+	})
+	if resp.Success || !strings.HasPrefix(resp.Message, "hover evaluate refused:") {
+		t.Fatalf("expected hover to be refused, got %#v", resp)
+	}
+	if len(ride.calls) != 0 {
+		t.Fatalf("expected no RIDE traffic for refused hover, got %#v", ride.calls)
+	}
+
+	server.SetHoverAllowlist([]string{"⎕nnums"})
+	server.limits.EvaluateTimeout = 5 * time.Millisecond
+	server.HandleRequest(Request{
+		Seq:       131,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": "⎕NNUMS", "context": "hover", "frameId": 1},
+	})
+	if call := ride.lastCall(); call.command != "GetValueTip" || call.args["line"] != "⎕NNUMS" {
+		t.Fatalf("expected allowlisted hover to use GetValueTip, got %#v", call)
+	}
+}
+
+// replyToExecute answers every Execute with the given session output followed by a ready prompt.
+func replyToExecute(server *Server, output func(text string) string) func(command string, args map[string]any) {
+	return func(command string, args map[string]any) {
+		if command != "Execute" {
+			return
+		}
+		server.HandleRidePayload(protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "SetPromptType",
+			Args:    protocol.SetPromptTypeArgs{Type: 0},
+		})
+		if result := output(args["text"].(string)); result != "" {
+			server.HandleRidePayload(protocol.DecodedPayload{
+				Kind:    protocol.KindCommand,
+				Command: "AppendSessionOutput",
+				Args:    protocol.AppendSessionOutputArgs{Result: result, Type: 2},
+			})
+		}
+		server.HandleRidePayload(protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "SetPromptType",
+			Args:    protocol.SetPromptTypeArgs{Type: 1},
+		})
+	}
+}
+
+func TestHandleRequest_EvaluateReplJSONDisplayReturnsVariablesTree(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+	server.SetReplDisplay(ReplDisplayJSON)
+
+	ride := &mockRideController{}
+	ride.onSend = replyToExecute(server, func(text string) string {
+		if text == replJSONExpression("cfg")+"\n" {
+			return `{"name":"demo","sizes":[1,2.5],"ok":true,"parent":null}` + "\n"
+		}
+		if text == replJSONExpression("Tick")+"\n" {
+			return replNoResultMarker + "\n"
+		}
+		return "plain\n"
+	})
+	server.SetRideController(ride)
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:       140,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": "cfg", "context": "repl"},
+	})
+	if !resp.Success {
+		t.Fatalf("expected repl evaluate success, got %s", resp.Message)
+	}
+	body := resp.Body.(EvaluateResponseBody)
+	if body.Result != "{4 fields}" || body.Type != "object" || body.VariablesReference <= 0 {
+		t.Fatalf("unexpected JSON repl result: %#v", body)
+	}
+
+	vars, _ := server.HandleRequest(Request{
+		Seq:       141,
+		Command:   "variables",
+		Arguments: map[string]any{"variablesReference": body.VariablesReference},
+	})
+	fields := vars.Body.(VariablesResponseBody).Variables
+	want := []Variable{
+		{Name: "name", Value: `"demo"`, Type: "string"},
+		{Name: "sizes", Value: "[2 items]", Type: "array", VariablesReference: fields[1].VariablesReference},
+		{Name: "ok", Value: "true", Type: "boolean"},
+		{Name: "parent", Value: "null", Type: "null"},
+	}
+	if len(fields) != len(want) {
+		t.Fatalf("unexpected JSON fields: %#v", fields)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Fatalf("field %d = %#v, want %#v", i, fields[i], want[i])
+		}
+	}
+	items, _ := server.HandleRequest(Request{
+		Seq:       142,
+		Command:   "variables",
+		Arguments: map[string]any{"variablesReference": fields[1].VariablesReference},
+	})
+	if got := items.Body.(VariablesResponseBody).Variables; len(got) != 2 || got[1].Value != "2.5" || got[1].Type != "number" {
+		t.Fatalf("unexpected JSON array items: %#v", got)
+	}
+
+	resp, _ = server.HandleRequest(Request{
+		Seq:       143,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": "Tick", "context": "repl"},
+	})
+	if body := resp.Body.(EvaluateResponseBody); !resp.Success || body.Result != "" || body.VariablesReference != 0 {
+		t.Fatalf("expected no result for a niladic procedure, got %#v", resp)
+	}
+
+	resp, _ = server.HandleRequest(Request{
+		Seq:       144,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": ")wsid", "context": "repl"},
+	})
+	if call := ride.lastCall(); call.args["text"] != ")wsid\n" {
+		t.Fatalf("expected system command to run unwrapped, got %#v", call.args)
+	}
+	if body := resp.Body.(EvaluateResponseBody); body.Result != "plain" || body.VariablesReference != 0 {
+		t.Fatalf("expected non-JSON output as plain text, got %#v", body)
+	}
+}
+
+func TestHandleRidePayload_ReportsSchemaViolationOncePerCommand(t *testing.T) {
+	server := NewServer()
+	server.SetRideController(&mockRideController{})
+	enterRunningState(t, server)
+
+	codec := protocol.NewCodec()
+	decoded, err := codec.DecodePayload(`["AppendSessionOutput",{"result":7,"type":2}]`)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if decoded.Invalid == nil {
+		t.Fatal("expected the payload to break the schema")
+	}
+
+	events := server.HandleRidePayload(decoded)
+	if len(events) != 1 {
+		t.Fatalf("expected one schema warning, got %#v", events)
+	}
+	body := events[0].Body.(OutputEventBody)
+	if body.Category != "console" || !strings.Contains(body.Output, "AppendSessionOutput.result must be string") {
+		t.Fatalf("unexpected schema warning: %#v", body)
+	}
+	if events := server.HandleRidePayload(decoded); len(events) != 0 {
+		t.Fatalf("expected a repeated violation to stay quiet, got %#v", events)
+	}
+}
+
+func TestHandleRidePayload_IdentifyRecordsSessionInfoAndGatesJSONDisplay(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+	server.SetReplDisplay(ReplDisplayJSON)
+	server.SetProtocolVersion(2)
+
+	if _, ok := server.SessionInfo(); ok {
+		t.Fatal("expected no session info before Identify")
+	}
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "Identify",
+		Args: protocol.IdentifyArgs{
+			APIVersion: 1,
+			Version:    "17.1.40404",
+			Platform:   "Linux-64",
+			Arch:       "Unicode/64",
+			PID:        4321,
+			Project:    "CLEAR WS",
+		},
+	})
+	info, ok := server.SessionInfo()
+	if !ok {
+		t.Fatal("expected session info after Identify")
+	}
+	want := protocol.SessionInfo{
+		ProtocolVersion: 2,
+		APIVersion:      1,
+		Version:         "17.1.40404",
+		Platform:        "Linux-64",
+		Arch:            "Unicode/64",
+		PID:             4321,
+		Workspace:       "CLEAR WS",
+	}
+	if info != want {
+		t.Fatalf("unexpected session info: %#v", info)
+	}
+
+	var executed []string
+	ride := &mockRideController{}
+	ride.onSend = replyToExecute(server, func(text string) string {
+		executed = append(executed, text)
+		return "1 2 3\n"
+	})
+	server.SetRideController(ride)
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:       150,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": "⍳3", "context": "repl"},
+	})
+	if !resp.Success {
+		t.Fatalf("expected repl evaluate success, got %s", resp.Message)
+	}
+	if len(executed) != 1 || executed[0] != "⍳3\n" {
+		t.Fatalf("expected plain Execute on a pre-18.0 interpreter, got %q", executed)
+	}
+}
+
+func TestHandleRidePayload_IdentifyAnnouncesSessionAndEnablesStepBack(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+	server.SetProtocolVersion(2)
+	server.SetStartMethod("attach")
+	ride := &mockRideController{}
+	server.SetRideController(ride)
+	server.SetActiveTracerWindow(7)
+
+	events := server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "Identify",
+		Args: protocol.IdentifyArgs{
+			APIVersion: 1,
+			Version:    "19.0.48745",
+			Platform:   "Linux-64",
+			Arch:       "Unicode/64",
+			PID:        812,
+			Project:    "CLEAR WS",
+		},
+	})
+	if len(events) != 3 {
+		t.Fatalf("expected output, process and capabilities events, got %#v", events)
+	}
+	output := events[0].Body.(OutputEventBody)
+	if events[0].Event != "output" || output.Output != "Connected to Dyalog 19.0.48745 (Linux-64, Unicode/64), pid 812, workspace CLEAR WS\n" {
+		t.Fatalf("unexpected session output event: %#v", events[0])
+	}
+	if info, ok := output.Data.(SessionInfoResponseBody); !ok || info.PID != 812 || info.Edition != "Unicode" {
+		t.Fatalf("expected session info in output data, got %#v", output.Data)
+	}
+	process := events[1].Body.(ProcessEventBody)
+	if events[1].Event != "process" || process != (ProcessEventBody{Name: "CLEAR WS", SystemProcessID: 812, StartMethod: "attach"}) {
+		t.Fatalf("unexpected process event: %#v", events[1])
+	}
+	if events[2].Event != "capabilities" {
+		t.Fatalf("expected capabilities event enabling stepBack, got %#v", events[2])
+	}
+
+	resp, _ := server.HandleRequest(Request{Seq: 10, Command: "dyalog/sessionInfo"})
+	if !resp.Success {
+		t.Fatalf("expected sessionInfo success, got %s", resp.Message)
+	}
+	body := resp.Body.(SessionInfoResponseBody)
+	if !body.Identified || body.ProtocolVersion != 2 || body.Version != "19.0.48745" || body.Workspace != "CLEAR WS" {
+		t.Fatalf("unexpected sessionInfo body: %#v", body)
+	}
+	if !body.Features["traceBackward"] || !body.Features["link"] {
+		t.Fatalf("expected 19.0 features enabled, got %#v", body.Features)
+	}
+
+	resp, _ = server.HandleRequest(Request{Seq: 11, Command: "stepBack", Arguments: map[string]any{"threadId": 1}})
+	if !resp.Success {
+		t.Fatalf("expected stepBack success, got %s", resp.Message)
+	}
+	if len(ride.calls) != 1 || ride.calls[0].command != "TraceBackward" || ride.calls[0].args["win"] != 7 {
+		t.Fatalf("expected TraceBackward on the tracer window, got %#v", ride.calls)
+	}
+}
+
+func TestHandleRequest_StepBackNeedsAVersionProvingTraceBackward(t *testing.T) {
+	server := NewServer()
+	resp, _ := server.HandleRequest(Request{Seq: 1, Command: "initialize"})
+	if resp.Body.(Capabilities).SupportsStepBack {
+		t.Fatal("expected stepBack not to be advertised before Identify")
+	}
+	resp, _ = server.HandleRequest(Request{Seq: 2, Command: "launch"})
+	if !resp.Success {
+		t.Fatalf("launch failed: %s", resp.Message)
+	}
+	ride := &mockRideController{}
+	server.SetRideController(ride)
+	server.SetActiveTracerWindow(7)
+
+	resp, _ = server.HandleRequest(Request{Seq: 3, Command: "stepBack", Arguments: map[string]any{"threadId": 1}})
+	if resp.Success {
+		t.Fatal("expected stepBack refused before Identify")
+	}
+
+	events := server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "Identify",
+		Args:    protocol.IdentifyArgs{Version: "development"},
+	})
+	for _, event := range events {
+		if event.Event == "capabilities" {
+			t.Fatalf("did not expect stepBack for an unparseable version: %#v", events)
+		}
+	}
+	resp, _ = server.HandleRequest(Request{Seq: 4, Command: "stepBack", Arguments: map[string]any{"threadId": 1}})
+	if resp.Success || len(ride.calls) != 0 {
+		t.Fatalf("expected stepBack refused for an unparseable version, got %#v (calls %#v)", resp, ride.calls)
+	}
+
+	events = server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "Identify",
+		Args:    protocol.IdentifyArgs{Version: "18.2.45405"},
+	})
+	if last := events[len(events)-1]; last.Event != "capabilities" {
+		t.Fatalf("expected capabilities event enabling stepBack on 18.2, got %#v", events)
+	}
+	resp, _ = server.HandleRequest(Request{Seq: 5, Command: "stepBack", Arguments: map[string]any{"threadId": 1}})
+	if !resp.Success || ride.lastCall().command != "TraceBackward" {
+		t.Fatalf("expected TraceBackward on 18.2, got %#v (calls %#v)", resp, ride.calls)
+	}
+
+	// A reconnect to an older interpreter withdraws it again.
+	events = server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "Identify",
+		Args:    protocol.IdentifyArgs{Version: "17.1.40404"},
+	})
+	last := events[len(events)-1]
+	if last.Event != "capabilities" || last.Body.(map[string]any)["capabilities"].(map[string]any)["supportsStepBack"] != false {
+		t.Fatalf("expected capabilities event disabling stepBack on 17.1, got %#v", events)
+	}
+}
+
+func TestHandleRidePayload_OlderInterpreterGatesStepBackAndKeepsDMXMessage(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+	ride := &mockRideController{}
+	server.SetRideController(ride)
+	server.SetActiveTracerWindow(7)
+
+	resp, _ := server.HandleRequest(Request{Seq: 10, Command: "dyalog/sessionInfo"})
+	if body := resp.Body.(SessionInfoResponseBody); !resp.Success || body.Identified {
+		t.Fatalf("expected unidentified session info before Identify, got %#v", resp)
+	}
+
+	events := server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "Identify",
+		Args:    protocol.IdentifyArgs{Version: "17.1.40404", Arch: "Classic/32"},
+	})
+	for _, event := range events {
+		if event.Event == "capabilities" {
+			t.Fatalf("did not expect stepBack to be enabled on 17.1: %#v", events)
+		}
+	}
+
+	resp, _ = server.HandleRequest(Request{Seq: 11, Command: "stepBack", Arguments: map[string]any{"threadId": 1}})
+	if resp.Success || !strings.Contains(resp.Message, "Dyalog 18.0") {
+		t.Fatalf("expected stepBack refusal on 17.1, got %#v", resp)
+	}
+	if len(ride.calls) != 0 {
+		t.Fatalf("expected no RIDE commands, got %#v", ride.calls)
+	}
+
+	events = server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "HadError",
+		Args: protocol.HadErrorArgs{
+			Error:     11,
+			ErrorText: "DOMAIN ERROR",
+			DMX:       map[string]any{"Message": "Divide by zero"},
+		},
+	})
+	if len(events) != 1 || events[0].Body.(StoppedEventBody).Description != "DOMAIN ERROR: Divide by zero" {
+		t.Fatalf("expected ⎕DMX message in stopped description, got %#v", events)
+	}
+}
+
+func TestHandleRequest_EvaluateReplBoxedDisplayBoxesEachResult(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+	server.SetReplDisplay(ReplDisplayBoxed)
+
+	ride := &mockRideController{}
+	ride.onSend = replyToExecute(server, func(text string) string {
+		if text == replBoxedExpression("Tick")+"\n" {
+			return "ticked\n" + replNoResultMarker + "\n"
+		}
+		return "┌→──┐\n│1 2│\n└~──┘\n"
+	})
+	server.SetRideController(ride)
+
+	for seq := 150; seq < 152; seq++ {
+		resp, _ := server.HandleRequest(Request{
+			Seq:       seq,
+			Command:   "evaluate",
+			Arguments: map[string]any{"expression": "1 2", "context": "repl"},
+		})
+		if !resp.Success || !strings.HasPrefix(resp.Body.(EvaluateResponseBody).Result, "┌→──┐") {
+			t.Fatalf("expected boxed result, got %#v", resp)
+		}
+	}
+	for _, call := range ride.calls {
+		if call.args["text"] != replBoxedExpression("1 2")+"\n" {
+			t.Fatalf("expected every result to be boxed on its own without ]Box, got %#v", call.args)
+		}
+	}
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:       152,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": "Tick", "context": "repl"},
+	})
+	if !resp.Success || resp.Body.(EvaluateResponseBody).Result != "ticked" {
+		t.Fatalf("expected output of a procedure without result, got %#v", resp)
+	}
+}
+
+func TestHandleRequest_EvaluateReplAnswersQuoteQuadInputPrompt(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	ride := &mockRideController{}
+	ride.onSend = func(command string, args map[string]any) {
+		if command != "Execute" {
+			return
+		}
+		server.HandleRidePayload(protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "SetPromptType",
+			Args:    protocol.SetPromptTypeArgs{Type: 1},
+		})
+	}
+	server.SetRideController(ride)
+
+	events := server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "AppendSessionOutput",
+		Args:    protocol.AppendSessionOutputArgs{Result: "Name: ", Type: 2},
+	})
+	if len(events) != 1 || events[0].Body.(OutputEventBody).Output != "Name: " {
+		t.Fatalf("expected ⍞ prompt text without an added newline, got %#v", events)
+	}
+	events = server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "SetPromptType",
+		Args:    protocol.SetPromptTypeArgs{Type: 4},
+	})
+	if len(events) != 1 || !strings.Contains(events[0].Body.(OutputEventBody).Output, "⍞ input requested") {
+		t.Fatalf("expected ⍞ input indicator, got %#v", events)
+	}
+
+	hover, _ := server.HandleRequest(Request{
+		Seq:       90,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": "x", "context": "hover", "frameId": 1},
+	})
+	if hover.Success || !strings.Contains(hover.Message, "waiting for ⎕/⍞ input") {
+		t.Fatalf("expected hover to be rejected while awaiting input, got %#v", hover)
+	}
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:       91,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": "  Bob", "context": "repl"},
+	})
+	if !resp.Success {
+		t.Fatalf("expected ⍞ answer to succeed, got %s", resp.Message)
+	}
+	if len(ride.calls) != 1 || ride.calls[0].command != "Execute" {
+		t.Fatalf("expected one Execute command, got %#v", ride.calls)
+	}
+	if got := ride.calls[0].args["text"]; got != "Name:   Bob\n" {
+		t.Fatalf("expected ⍞ answer to follow the prompt text, got %#v", got)
+	}
+}
+
+func TestHandleRequest_EvaluateReplAnswersQuadInputPrompt(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	ride := &mockRideController{}
+	ride.onSend = func(command string, args map[string]any) {
+		server.HandleRidePayload(protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "SetPromptType",
+			Args:    protocol.SetPromptTypeArgs{Type: 1},
+		})
+	}
+	server.SetRideController(ride)
+
+	events := server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "SetPromptType",
+		Args:    protocol.SetPromptTypeArgs{Type: 2},
+	})
+	if len(events) != 1 || !strings.Contains(events[0].Body.(OutputEventBody).Output, "⎕ input requested") {
+		t.Fatalf("expected ⎕ input indicator, got %#v", events)
+	}
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:       92,
+		Command:   "evaluate",
+		Arguments: map[string]any{"expression": "2 3⍴⍳6", "context": "repl"},
+	})
+	if !resp.Success {
+		t.Fatalf("expected ⎕ answer to succeed, got %s", resp.Message)
+	}
+	if got := ride.lastCall().args["text"]; got != "2 3⍴⍳6\n" {
+		t.Fatalf("unexpected ⎕ answer text: %#v", got)
+	}
+}
+
+func TestHandleRidePayload_AppendSessionOutputEmitsOutputEventAndCategorizesEcho(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	events := server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "AppendSessionOutput",
+		Args: protocol.AppendSessionOutputArgs{
+			Result: "      1+1\n",
+			Type:   14,
+			Group:  0,
+		},
+	})
+	if len(events) != 1 {
+		t.Fatalf("expected input typed in the interpreter session (type=14) to be echoed, got %#v", events)
+	}
+	if echo := events[0].Body.(OutputEventBody); echo.Category != "console" || echo.Data.(map[string]any)["kind"] != "echo" {
+		t.Fatalf("expected console echo output, got %#v", echo)
+	}
+
+	events = server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "AppendSessionOutput",
+		Args: protocol.AppendSessionOutputArgs{
+			Result: "2\n",
+			Type:   3,
+			Group:  0,
+		},
+	})
+	if len(events) != 1 || events[0].Event != "output" {
+		t.Fatalf("expected one output event, got %#v", events)
 	}
 	body, ok := events[0].Body.(OutputEventBody)
 	if !ok {
@@ -1737,10 +3027,68 @@ func TestHandleRidePayload_AppendSessionOutputEmitsOutputEventAndSkipsEcho(t *te
 	}
 }
 
+func TestHandleRidePayload_SessionOutputGroupsAndSourceLocations(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    7,
+			Debugger: true,
+			Name:     "Divide",
+			Filename: "/ws/src/Divide.aplf",
+			Text:     []string{"r←Divide x", "r←1÷x"},
+		},
+	})
+	appendOutput := func(result string, outputType, group int) []Event {
+		return server.HandleRidePayload(protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "AppendSessionOutput",
+			Args:    protocol.AppendSessionOutputArgs{Result: result, Type: outputType, Group: group},
+		})
+	}
+
+	events := appendOutput("DOMAIN ERROR: Divide by zero\n", 3, 4)
+	if len(events) != 1 {
+		t.Fatalf("expected one output event, got %#v", events)
+	}
+	if body := events[0].Body.(OutputEventBody); body.Category != "stderr" || body.Group != "start" {
+		t.Fatalf("expected error line to open a stderr group, got %#v", body)
+	}
+
+	events = appendOutput("Divide[1] r←1÷x\n", 5, 4)
+	body := events[0].Body.(OutputEventBody)
+	if len(events) != 1 || body.Group != "" {
+		t.Fatalf("expected grouped continuation line, got %#v", events)
+	}
+	if body.Source == nil || body.Source.Path != "/ws/src/Divide.aplf" || body.Line != 2 {
+		t.Fatalf("expected Divide[1] to point at line 2 of its source, got %#v", body)
+	}
+
+	events = appendOutput("Divide[1]\n", 8, 0)
+	if len(events) != 2 || events[0].Body.(OutputEventBody).Group != "end" {
+		t.Fatalf("expected group end before ungrouped output, got %#v", events)
+	}
+	if trace := events[1].Body.(OutputEventBody); trace.Category != "console" || trace.Data.(map[string]any)["kind"] != "trace" || trace.Line != 2 {
+		t.Fatalf("expected trace line with source location, got %#v", trace)
+	}
+
+	appendOutput("1\n", 2, 9)
+	events = server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "SetSessionLineGroup",
+		Args:    protocol.SetSessionLineGroupArgs{LineOffset: 0, Group: 0},
+	})
+	if len(events) != 1 || events[0].Body.(OutputEventBody).Group != "end" {
+		t.Fatalf("expected SetSessionLineGroup to close the open group, got %#v", events)
+	}
+}
+
 func TestHandleRequest_EvaluateWatchTimeoutReturnsActionableError(t *testing.T) {
 	server := NewServer()
 	enterRunningState(t, server)
-	server.evaluateTimeout = 5 * time.Millisecond
+	server.limits.EvaluateTimeout = 5 * time.Millisecond
 	ride := &mockRideController{}
 	server.SetRideController(ride)
 
@@ -1755,23 +3103,276 @@ func TestHandleRequest_EvaluateWatchTimeoutReturnsActionableError(t *testing.T)
 	})
 
 	resp, _ := server.HandleRequest(Request{
-		Seq:     84,
-		Command: "evaluate",
+		Seq:     84,
+		Command: "evaluate",
+		Arguments: map[string]any{
+			"expression": "foo",
+			"context":    "watch",
+			"frameId":    805,
+		},
+	})
+	if resp.Success {
+		t.Fatal("expected watch evaluate timeout to fail")
+	}
+	if !strings.Contains(strings.ToLower(resp.Message), "watch context") {
+		t.Fatalf("expected actionable watch timeout message, got %q", resp.Message)
+	}
+}
+
+func TestHandleRequest_SourceReturnsMappedWindowText(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    901,
+			Filename: "/ws/src/source.apl",
+			Text:     []string{"[fn-header]", "r<-x+1", "[fn-end]"},
+		},
+	})
+	sourceRef, ok := server.ResolveSourceReferenceForToken(901)
+	if !ok {
+		t.Fatal("expected source reference mapping for token")
+	}
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:     82,
+		Command: "source",
+		Arguments: map[string]any{
+			"sourceReference": sourceRef,
+		},
+	})
+	if !resp.Success {
+		t.Fatalf("expected source success, got %s", resp.Message)
+	}
+	body, ok := resp.Body.(SourceResponseBody)
+	if !ok {
+		t.Fatalf("expected SourceResponseBody, got %T", resp.Body)
+	}
+	if body.Content != "[fn-header]\nr<-x+1\n[fn-end]" {
+		t.Fatalf("unexpected source content: %#v", body)
+	}
+}
+
+func TestHandleRequest_SourcePrefersActiveWindowTextOverDisk(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	sourcePath := filepath.Join(t.TempDir(), "active.apl")
+	if err := os.WriteFile(sourcePath, []byte("disk-version"), 0o600); err != nil {
+		t.Fatalf("write disk source: %v", err)
+	}
+
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    902,
+			Filename: sourcePath,
+			Text:     []string{"window-version"},
+		},
+	})
+	sourceRef, ok := server.ResolveSourceReferenceForToken(902)
+	if !ok {
+		t.Fatal("expected source reference mapping for token")
+	}
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:     85,
+		Command: "source",
+		Arguments: map[string]any{
+			"sourceReference": sourceRef,
+		},
+	})
+	if !resp.Success {
+		t.Fatalf("expected source success, got %s", resp.Message)
+	}
+	body := resp.Body.(SourceResponseBody)
+	if body.Content != "window-version" {
+		t.Fatalf("expected active window text precedence, got %#v", body)
+	}
+}
+
+func TestHandleRequest_SourceFallsBackToDiskAfterCloseWindow(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	sourcePath := filepath.Join(t.TempDir(), "closed.apl")
+	if err := os.WriteFile(sourcePath, []byte("disk-after-close"), 0o600); err != nil {
+		t.Fatalf("write disk source: %v", err)
+	}
+
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    903,
+			Filename: sourcePath,
+			Text:     []string{"window-before-close"},
+		},
+	})
+	sourceRef, ok := server.ResolveSourceReferenceForToken(903)
+	if !ok {
+		t.Fatal("expected source reference for token")
+	}
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "CloseWindow",
+		Args: protocol.WindowArgs{
+			Win: 903,
+		},
+	})
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:     86,
+		Command: "source",
+		Arguments: map[string]any{
+			"sourceReference": sourceRef,
+		},
+	})
+	if !resp.Success {
+		t.Fatalf("expected source success from disk fallback, got %s", resp.Message)
+	}
+	body := resp.Body.(SourceResponseBody)
+	if body.Content != "disk-after-close" {
+		t.Fatalf("expected disk content after close invalidation, got %#v", body)
+	}
+}
+
+func TestHandleRequest_SourceMappingChurnDoesNotCrossBindOldReferenceContent(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	tempDir := t.TempDir()
+	oldPath := filepath.Join(tempDir, "old.apl")
+	newPath := filepath.Join(tempDir, "new.apl")
+	if err := os.WriteFile(oldPath, []byte("old-disk"), 0o600); err != nil {
+		t.Fatalf("write old source: %v", err)
+	}
+	if err := os.WriteFile(newPath, []byte("new-disk"), 0o600); err != nil {
+		t.Fatalf("write new source: %v", err)
+	}
+
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    904,
+			Filename: oldPath,
+			Text:     []string{"old-window"},
+		},
+	})
+	oldRef, ok := server.ResolveSourceReferenceForToken(904)
+	if !ok {
+		t.Fatal("expected old source ref")
+	}
+
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "UpdateWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    904,
+			Filename: newPath,
+			Text:     []string{"new-window"},
+		},
+	})
+	newRef, ok := server.ResolveSourceReferenceForToken(904)
+	if !ok {
+		t.Fatal("expected new source ref after update")
+	}
+	if newRef == oldRef {
+		t.Fatalf("expected different source refs after path churn: %d", newRef)
+	}
+
+	newResp, _ := server.HandleRequest(Request{
+		Seq:     87,
+		Command: "source",
+		Arguments: map[string]any{
+			"sourceReference": newRef,
+		},
+	})
+	if !newResp.Success {
+		t.Fatalf("expected source success for new ref, got %s", newResp.Message)
+	}
+	if body := newResp.Body.(SourceResponseBody); body.Content != "new-window" {
+		t.Fatalf("expected new ref to return new window text, got %#v", body)
+	}
+
+	oldResp, _ := server.HandleRequest(Request{
+		Seq:     88,
+		Command: "source",
+		Arguments: map[string]any{
+			"sourceReference": oldRef,
+		},
+	})
+	if !oldResp.Success {
+		t.Fatalf("expected old source ref to resolve from disk, got %s", oldResp.Message)
+	}
+	if body := oldResp.Body.(SourceResponseBody); body.Content != "old-disk" {
+		t.Fatalf("expected old ref to avoid cross-bound text, got %#v", body)
+	}
+}
+
+func TestHandleRequest_SourceWithoutMappingFails(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:     83,
+		Command: "source",
+		Arguments: map[string]any{
+			"sourceReference": 9999,
+		},
+	})
+	if resp.Success {
+		t.Fatal("expected missing source mapping to fail")
+	}
+}
+
+func TestHandleRequest_SourceFailureIncludesPathDiagnostic(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	sourcePath := filepath.Join(t.TempDir(), "missing.apl")
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    906,
+			Filename: sourcePath,
+			Text:     []string{"transient"},
+		},
+	})
+	sourceRef, ok := server.ResolveSourceReferenceForToken(906)
+	if !ok {
+		t.Fatal("expected source reference")
+	}
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "CloseWindow",
+		Args: protocol.WindowArgs{
+			Win: 906,
+		},
+	})
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:     89,
+		Command: "source",
 		Arguments: map[string]any{
-			"expression": "foo",
-			"context":    "watch",
-			"frameId":    805,
+			"sourceReference": sourceRef,
 		},
 	})
 	if resp.Success {
-		t.Fatal("expected watch evaluate timeout to fail")
+		t.Fatal("expected missing disk source to fail after close")
 	}
-	if !strings.Contains(strings.ToLower(resp.Message), "watch context") {
-		t.Fatalf("expected actionable watch timeout message, got %q", resp.Message)
+	if !strings.Contains(resp.Message, sourcePath) {
+		t.Fatalf("expected source failure message to include path, got %q", resp.Message)
 	}
 }
 
-func TestHandleRequest_SourceReturnsMappedWindowText(t *testing.T) {
+func TestHandleRidePayload_OpenWindowRegistersSourceReferenceAndToken(t *testing.T) {
 	server := NewServer()
 	enterRunningState(t, server)
 
@@ -1779,144 +3380,114 @@ func TestHandleRequest_SourceReturnsMappedWindowText(t *testing.T) {
 		Kind:    protocol.KindCommand,
 		Command: "OpenWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    901,
-			Filename: "/ws/src/source.apl",
-			Text:     []string{"[fn-header]", "r<-x+1", "[fn-end]"},
+			Token:    301,
+			Filename: "/ws/src/foo.apl",
+			Name:     "foo",
 		},
 	})
-	sourceRef, ok := server.ResolveSourceReferenceForToken(901)
-	if !ok {
-		t.Fatal("expected source reference mapping for token")
-	}
 
-	resp, _ := server.HandleRequest(Request{
-		Seq:     82,
-		Command: "source",
-		Arguments: map[string]any{
-			"sourceReference": sourceRef,
-		},
-	})
-	if !resp.Success {
-		t.Fatalf("expected source success, got %s", resp.Message)
-	}
-	body, ok := resp.Body.(SourceResponseBody)
+	sourceRef, ok := server.ResolveSourceReferenceForToken(301)
 	if !ok {
-		t.Fatalf("expected SourceResponseBody, got %T", resp.Body)
+		t.Fatal("expected source reference for token 301")
 	}
-	if body.Content != "[fn-header]\nr<-x+1\n[fn-end]" {
-		t.Fatalf("unexpected source content: %#v", body)
+	if sourceRef <= 0 {
+		t.Fatalf("expected positive sourceRef, got %d", sourceRef)
+	}
+
+	token, ok := server.ResolveTokenForSourceReference(sourceRef)
+	if !ok || token != 301 {
+		t.Fatalf("expected sourceRef %d to resolve to token 301, got %d (ok=%v)", sourceRef, token, ok)
 	}
 }
 
-func TestHandleRequest_SourcePrefersActiveWindowTextOverDisk(t *testing.T) {
+func TestHandleRidePayload_CloseWindowRemovesTokenMapping(t *testing.T) {
 	server := NewServer()
 	enterRunningState(t, server)
 
-	sourcePath := filepath.Join(t.TempDir(), "active.apl")
-	if err := os.WriteFile(sourcePath, []byte("disk-version"), 0o600); err != nil {
-		t.Fatalf("write disk source: %v", err)
-	}
-
 	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "OpenWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    902,
-			Filename: sourcePath,
-			Text:     []string{"window-version"},
+			Token:    302,
+			Filename: "/ws/src/bar.apl",
 		},
 	})
-	sourceRef, ok := server.ResolveSourceReferenceForToken(902)
+	sourceRef, ok := server.ResolveSourceReferenceForToken(302)
 	if !ok {
-		t.Fatal("expected source reference mapping for token")
+		t.Fatal("expected source ref for open window")
 	}
 
-	resp, _ := server.HandleRequest(Request{
-		Seq:     85,
-		Command: "source",
-		Arguments: map[string]any{
-			"sourceReference": sourceRef,
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "CloseWindow",
+		Args: protocol.WindowArgs{
+			Win: 302,
 		},
 	})
-	if !resp.Success {
-		t.Fatalf("expected source success, got %s", resp.Message)
+
+	if _, ok := server.ResolveSourceReferenceForToken(302); ok {
+		t.Fatal("expected token mapping removed after close")
 	}
-	body := resp.Body.(SourceResponseBody)
-	if body.Content != "window-version" {
-		t.Fatalf("expected active window text precedence, got %#v", body)
+	if _, ok := server.ResolveTokenForSourceReference(sourceRef); ok {
+		t.Fatal("expected sourceRef token mapping removed after close")
 	}
 }
 
-func TestHandleRequest_SourceFallsBackToDiskAfterCloseWindow(t *testing.T) {
+func TestHandleRidePayload_ReopenSameSourceReusesSourceReference(t *testing.T) {
 	server := NewServer()
 	enterRunningState(t, server)
 
-	sourcePath := filepath.Join(t.TempDir(), "closed.apl")
-	if err := os.WriteFile(sourcePath, []byte("disk-after-close"), 0o600); err != nil {
-		t.Fatalf("write disk source: %v", err)
-	}
-
 	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "OpenWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    903,
-			Filename: sourcePath,
-			Text:     []string{"window-before-close"},
+			Token:    303,
+			Filename: "/ws/src/baz.apl",
 		},
 	})
-	sourceRef, ok := server.ResolveSourceReferenceForToken(903)
+	firstRef, ok := server.ResolveSourceReferenceForToken(303)
 	if !ok {
-		t.Fatal("expected source reference for token")
+		t.Fatal("expected first source ref")
 	}
+
 	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "CloseWindow",
 		Args: protocol.WindowArgs{
-			Win: 903,
+			Win: 303,
 		},
 	})
-
-	resp, _ := server.HandleRequest(Request{
-		Seq:     86,
-		Command: "source",
-		Arguments: map[string]any{
-			"sourceReference": sourceRef,
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    304,
+			Filename: "/ws/src/baz.apl",
 		},
 	})
-	if !resp.Success {
-		t.Fatalf("expected source success from disk fallback, got %s", resp.Message)
+
+	secondRef, ok := server.ResolveSourceReferenceForToken(304)
+	if !ok {
+		t.Fatal("expected second source ref")
 	}
-	body := resp.Body.(SourceResponseBody)
-	if body.Content != "disk-after-close" {
-		t.Fatalf("expected disk content after close invalidation, got %#v", body)
+	if firstRef != secondRef {
+		t.Fatalf("expected source ref reuse across reopen, got %d then %d", firstRef, secondRef)
 	}
 }
 
-func TestHandleRequest_SourceMappingChurnDoesNotCrossBindOldReferenceContent(t *testing.T) {
+func TestHandleRidePayload_UpdateWindowRebindsTokenToNewSource(t *testing.T) {
 	server := NewServer()
 	enterRunningState(t, server)
 
-	tempDir := t.TempDir()
-	oldPath := filepath.Join(tempDir, "old.apl")
-	newPath := filepath.Join(tempDir, "new.apl")
-	if err := os.WriteFile(oldPath, []byte("old-disk"), 0o600); err != nil {
-		t.Fatalf("write old source: %v", err)
-	}
-	if err := os.WriteFile(newPath, []byte("new-disk"), 0o600); err != nil {
-		t.Fatalf("write new source: %v", err)
-	}
-
 	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "OpenWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    904,
-			Filename: oldPath,
-			Text:     []string{"old-window"},
+			Token:    305,
+			Filename: "/ws/src/old.apl",
 		},
 	})
-	oldRef, ok := server.ResolveSourceReferenceForToken(904)
+	oldRef, ok := server.ResolveSourceReferenceForToken(305)
 	if !ok {
 		t.Fatal("expected old source ref")
 	}
@@ -1925,666 +3496,1045 @@ func TestHandleRequest_SourceMappingChurnDoesNotCrossBindOldReferenceContent(t *
 		Kind:    protocol.KindCommand,
 		Command: "UpdateWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    904,
-			Filename: newPath,
-			Text:     []string{"new-window"},
+			Token:    305,
+			Filename: "/ws/src/new.apl",
 		},
 	})
-	newRef, ok := server.ResolveSourceReferenceForToken(904)
+
+	newRef, ok := server.ResolveSourceReferenceForToken(305)
 	if !ok {
-		t.Fatal("expected new source ref after update")
+		t.Fatal("expected updated source ref")
 	}
 	if newRef == oldRef {
-		t.Fatalf("expected different source refs after path churn: %d", newRef)
+		t.Fatal("expected updated source ref to differ after path change")
+	}
+	if _, ok := server.ResolveTokenForSourceReference(oldRef); ok {
+		t.Fatal("expected old source ref to be unbound from token")
+	}
+	token, ok := server.ResolveTokenForSourceReference(newRef)
+	if !ok || token != 305 {
+		t.Fatalf("expected new sourceRef to map to token 305, got %d (ok=%v)", token, ok)
 	}
+}
 
-	newResp, _ := server.HandleRequest(Request{
-		Seq:     87,
-		Command: "source",
-		Arguments: map[string]any{
-			"sourceReference": newRef,
+func TestHandleRidePayload_RebindingPathToNewTokenUnbindsOldToken(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    306,
+			Filename: "/ws/src/shared.apl",
 		},
 	})
-	if !newResp.Success {
-		t.Fatalf("expected source success for new ref, got %s", newResp.Message)
+	ref, ok := server.ResolveSourceReferenceForToken(306)
+	if !ok {
+		t.Fatal("expected source ref for first token")
 	}
-	if body := newResp.Body.(SourceResponseBody); body.Content != "new-window" {
-		t.Fatalf("expected new ref to return new window text, got %#v", body)
+
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    307,
+			Filename: "/ws/src/shared.apl",
+		},
+	})
+
+	if _, ok := server.ResolveSourceReferenceForToken(306); ok {
+		t.Fatal("expected first token to be unbound after rebind")
+	}
+	token, ok := server.ResolveTokenForSourceReference(ref)
+	if !ok || token != 307 {
+		t.Fatalf("expected sourceRef to map to token 307, got %d (ok=%v)", token, ok)
 	}
+}
 
-	oldResp, _ := server.HandleRequest(Request{
-		Seq:     88,
-		Command: "source",
+func TestHandleRequest_SetBreakpointsTranslatesLinesAndSendsSetLineAttributes(t *testing.T) {
+	ride := &mockRideController{}
+	server := NewServer()
+	server.SetRideController(ride)
+	enterRunningState(t, server)
+
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    401,
+			Filename: "/ws/src/break.apl",
+		},
+	})
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:     70,
+		Command: "setBreakpoints",
 		Arguments: map[string]any{
-			"sourceReference": oldRef,
+			"source": map[string]any{
+				"path": "/ws/src/break.apl",
+			},
+			"breakpoints": []any{
+				map[string]any{"line": 2},
+				map[string]any{"line": 5},
+			},
 		},
 	})
-	if !oldResp.Success {
-		t.Fatalf("expected old source ref to resolve from disk, got %s", oldResp.Message)
+	if !resp.Success {
+		t.Fatalf("expected setBreakpoints success, got %s", resp.Message)
 	}
-	if body := oldResp.Body.(SourceResponseBody); body.Content != "old-disk" {
-		t.Fatalf("expected old ref to avoid cross-bound text, got %#v", body)
+
+	call := ride.lastCall()
+	if call.command != "SetLineAttributes" {
+		t.Fatalf("expected SetLineAttributes, got %q", call.command)
+	}
+	if call.args["win"] != 401 {
+		t.Fatalf("expected win=401, got %#v", call.args["win"])
+	}
+	stop, ok := call.args["stop"].([]int)
+	if !ok {
+		t.Fatalf("expected []int stop array, got %T", call.args["stop"])
+	}
+	if len(stop) != 2 || stop[0] != 1 || stop[1] != 4 {
+		t.Fatalf("expected stop=[1 4], got %#v", stop)
 	}
-}
-
-func TestHandleRequest_SourceWithoutMappingFails(t *testing.T) {
-	server := NewServer()
-	enterRunningState(t, server)
 
-	resp, _ := server.HandleRequest(Request{
-		Seq:     83,
-		Command: "source",
-		Arguments: map[string]any{
-			"sourceReference": 9999,
-		},
-	})
-	if resp.Success {
-		t.Fatal("expected missing source mapping to fail")
+	body, ok := resp.Body.(SetBreakpointsResponseBody)
+	if !ok {
+		t.Fatalf("expected SetBreakpointsResponseBody, got %T", resp.Body)
+	}
+	if len(body.Breakpoints) != 2 {
+		t.Fatalf("expected 2 breakpoint responses, got %d", len(body.Breakpoints))
+	}
+	if !body.Breakpoints[0].Verified || body.Breakpoints[0].Line != 2 {
+		t.Fatalf("unexpected first breakpoint response: %#v", body.Breakpoints[0])
+	}
+	if !strings.Contains(strings.ToLower(body.Breakpoints[0].Message), "active") {
+		t.Fatalf("expected active breakpoint message, got %#v", body.Breakpoints[0])
 	}
 }
 
-func TestHandleRequest_SourceFailureIncludesPathDiagnostic(t *testing.T) {
+func TestHandleRequest_SetBreakpointsSupportsSourceReferenceLookup(t *testing.T) {
+	ride := &mockRideController{}
 	server := NewServer()
+	server.SetRideController(ride)
 	enterRunningState(t, server)
 
-	sourcePath := filepath.Join(t.TempDir(), "missing.apl")
 	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "OpenWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    906,
-			Filename: sourcePath,
-			Text:     []string{"transient"},
+			Token:    402,
+			Filename: "/ws/src/ref.apl",
 		},
 	})
-	sourceRef, ok := server.ResolveSourceReferenceForToken(906)
+	sourceRef, ok := server.ResolveSourceReferenceForToken(402)
 	if !ok {
-		t.Fatal("expected source reference")
+		t.Fatal("expected sourceRef for token")
 	}
-	server.HandleRidePayload(protocol.DecodedPayload{
-		Kind:    protocol.KindCommand,
-		Command: "CloseWindow",
-		Args: protocol.WindowArgs{
-			Win: 906,
-		},
-	})
 
 	resp, _ := server.HandleRequest(Request{
-		Seq:     89,
-		Command: "source",
+		Seq:     71,
+		Command: "setBreakpoints",
 		Arguments: map[string]any{
-			"sourceReference": sourceRef,
+			"source": map[string]any{
+				"sourceReference": sourceRef,
+			},
+			"breakpoints": []any{
+				map[string]any{"line": 10},
+			},
 		},
 	})
-	if resp.Success {
-		t.Fatal("expected missing disk source to fail after close")
+	if !resp.Success {
+		t.Fatalf("expected setBreakpoints success, got %s", resp.Message)
 	}
-	if !strings.Contains(resp.Message, sourcePath) {
-		t.Fatalf("expected source failure message to include path, got %q", resp.Message)
+	call := ride.lastCall()
+	if call.command != "SetLineAttributes" || call.args["win"] != 402 {
+		t.Fatalf("unexpected SetLineAttributes call: %#v", call)
 	}
 }
 
-func TestHandleRidePayload_OpenWindowRegistersSourceReferenceAndToken(t *testing.T) {
+func TestHandleRequest_SetBreakpointsUnverifiedWhenSourceNotMapped(t *testing.T) {
+	ride := &mockRideController{}
 	server := NewServer()
+	server.SetRideController(ride)
 	enterRunningState(t, server)
 
-	server.HandleRidePayload(protocol.DecodedPayload{
-		Kind:    protocol.KindCommand,
-		Command: "OpenWindow",
-		Args: protocol.WindowContentArgs{
-			Token:    301,
-			Filename: "/ws/src/foo.apl",
-			Name:     "foo",
+	resp, _ := server.HandleRequest(Request{
+		Seq:     72,
+		Command: "setBreakpoints",
+		Arguments: map[string]any{
+			"source": map[string]any{
+				"path": "/ws/src/missing.apl",
+			},
+			"breakpoints": []any{
+				map[string]any{"line": 3},
+			},
 		},
 	})
+	if !resp.Success {
+		t.Fatalf("expected setBreakpoints success with unverified breakpoints, got %s", resp.Message)
+	}
+	if len(ride.calls) != 1 {
+		t.Fatalf("expected one RIDE command send, got %#v", ride.calls)
+	}
+	if ride.calls[0].command != "GetWindowLayout" {
+		t.Fatalf("expected GetWindowLayout sync request, got %q", ride.calls[0].command)
+	}
 
-	sourceRef, ok := server.ResolveSourceReferenceForToken(301)
-	if !ok {
-		t.Fatal("expected source reference for token 301")
+	body := resp.Body.(SetBreakpointsResponseBody)
+	if len(body.Breakpoints) != 1 {
+		t.Fatalf("expected one breakpoint response, got %d", len(body.Breakpoints))
 	}
-	if sourceRef <= 0 {
-		t.Fatalf("expected positive sourceRef, got %d", sourceRef)
+	if body.Breakpoints[0].Verified {
+		t.Fatal("expected unverified breakpoint for unmapped source")
+	}
+	if !strings.Contains(strings.ToLower(body.Breakpoints[0].Message), "pending") {
+		t.Fatalf("expected pending breakpoint message, got %#v", body.Breakpoints[0])
 	}
+}
 
-	token, ok := server.ResolveTokenForSourceReference(sourceRef)
-	if !ok || token != 301 {
-		t.Fatalf("expected sourceRef %d to resolve to token 301, got %d (ok=%v)", sourceRef, token, ok)
+func TestHandleRequest_SetBreakpointsPendingEmitsDiagnosticOutputEvent(t *testing.T) {
+	ride := &mockRideController{}
+	server := NewServer()
+	server.SetRideController(ride)
+	enterRunningState(t, server)
+
+	resp, events := server.HandleRequest(Request{
+		Seq:     72,
+		Command: "setBreakpoints",
+		Arguments: map[string]any{
+			"source": map[string]any{
+				"path": "/ws/src/pending.apl",
+			},
+			"breakpoints": []any{
+				map[string]any{"line": 3},
+			},
+		},
+	})
+	if !resp.Success {
+		t.Fatalf("expected pending setBreakpoints success, got %s", resp.Message)
+	}
+	if len(events) != 1 || events[0].Event != "output" {
+		t.Fatalf("expected one output diagnostic event, got %#v", events)
+	}
+	output := events[0].Body.(OutputEventBody).Output
+	if !strings.Contains(strings.ToLower(output), "breakpoints pending") {
+		t.Fatalf("expected pending diagnostic output, got %q", output)
 	}
 }
 
-func TestHandleRidePayload_CloseWindowRemovesTokenMapping(t *testing.T) {
+func TestHandleRidePayload_OpenWindowAppliesDeferredBreakpoints(t *testing.T) {
+	ride := &mockRideController{}
 	server := NewServer()
+	server.SetRideController(ride)
 	enterRunningState(t, server)
 
-	server.HandleRidePayload(protocol.DecodedPayload{
-		Kind:    protocol.KindCommand,
-		Command: "OpenWindow",
-		Args: protocol.WindowContentArgs{
-			Token:    302,
-			Filename: "/ws/src/bar.apl",
+	resp, _ := server.HandleRequest(Request{
+		Seq:     73,
+		Command: "setBreakpoints",
+		Arguments: map[string]any{
+			"source": map[string]any{
+				"path": "/ws/src/deferred.apl",
+			},
+			"breakpoints": []any{
+				map[string]any{"line": 4},
+				map[string]any{"line": 9},
+			},
 		},
 	})
-	sourceRef, ok := server.ResolveSourceReferenceForToken(302)
-	if !ok {
-		t.Fatal("expected source ref for open window")
+	if !resp.Success {
+		t.Fatalf("expected setBreakpoints success, got %s", resp.Message)
 	}
 
-	server.HandleRidePayload(protocol.DecodedPayload{
+	events := server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
-		Command: "CloseWindow",
-		Args: protocol.WindowArgs{
-			Win: 302,
+		Command: "OpenWindow",
+		Args: protocol.WindowContentArgs{
+			Token:    501,
+			Filename: "/ws/src/deferred.apl",
 		},
 	})
 
-	if _, ok := server.ResolveSourceReferenceForToken(302); ok {
-		t.Fatal("expected token mapping removed after close")
+	if len(ride.calls) < 2 {
+		t.Fatalf("expected deferred SetLineAttributes call after sync request, got %#v", ride.calls)
 	}
-	if _, ok := server.ResolveTokenForSourceReference(sourceRef); ok {
-		t.Fatal("expected sourceRef token mapping removed after close")
+	last := ride.lastCall()
+	if last.command != "SetLineAttributes" {
+		t.Fatalf("expected SetLineAttributes, got %q", last.command)
+	}
+	if last.args["win"] != 501 {
+		t.Fatalf("expected win=501, got %#v", last.args["win"])
+	}
+	stop := last.args["stop"].([]int)
+	if len(stop) != 2 || stop[0] != 3 || stop[1] != 8 {
+		t.Fatalf("expected stop=[3 8], got %#v", stop)
+	}
+	if len(events) == 0 || events[0].Event != "output" {
+		t.Fatalf("expected output diagnostic event from deferred apply, got %#v", events)
+	}
+	if !strings.Contains(strings.ToLower(events[0].Body.(OutputEventBody).Output), "deferred apply succeeded") {
+		t.Fatalf("expected deferred apply success diagnostic, got %#v", events[0])
 	}
 }
 
-func TestHandleRidePayload_ReopenSameSourceReusesSourceReference(t *testing.T) {
+func TestHandleRequest_SetBreakpointsUnmappedReplacesDeferredLines(t *testing.T) {
+	ride := &mockRideController{}
 	server := NewServer()
+	server.SetRideController(ride)
 	enterRunningState(t, server)
 
-	server.HandleRidePayload(protocol.DecodedPayload{
-		Kind:    protocol.KindCommand,
-		Command: "OpenWindow",
-		Args: protocol.WindowContentArgs{
-			Token:    303,
-			Filename: "/ws/src/baz.apl",
+	_, _ = server.HandleRequest(Request{
+		Seq:     74,
+		Command: "setBreakpoints",
+		Arguments: map[string]any{
+			"source": map[string]any{
+				"path": "/ws/src/replace.apl",
+			},
+			"breakpoints": []any{
+				map[string]any{"line": 2},
+			},
 		},
 	})
-	firstRef, ok := server.ResolveSourceReferenceForToken(303)
-	if !ok {
-		t.Fatal("expected first source ref")
-	}
-
-	server.HandleRidePayload(protocol.DecodedPayload{
-		Kind:    protocol.KindCommand,
-		Command: "CloseWindow",
-		Args: protocol.WindowArgs{
-			Win: 303,
+	_, _ = server.HandleRequest(Request{
+		Seq:     75,
+		Command: "setBreakpoints",
+		Arguments: map[string]any{
+			"source": map[string]any{
+				"path": "/ws/src/replace.apl",
+			},
+			"breakpoints": []any{
+				map[string]any{"line": 7},
+			},
 		},
 	})
+
 	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "OpenWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    304,
-			Filename: "/ws/src/baz.apl",
+			Token:    502,
+			Filename: "/ws/src/replace.apl",
 		},
 	})
 
-	secondRef, ok := server.ResolveSourceReferenceForToken(304)
-	if !ok {
-		t.Fatal("expected second source ref")
+	last := ride.lastCall()
+	if last.command != "SetLineAttributes" {
+		t.Fatalf("expected SetLineAttributes, got %q", last.command)
 	}
-	if firstRef != secondRef {
-		t.Fatalf("expected source ref reuse across reopen, got %d then %d", firstRef, secondRef)
+	stop := last.args["stop"].([]int)
+	if len(stop) != 1 || stop[0] != 6 {
+		t.Fatalf("expected latest deferred stop=[6], got %#v", stop)
 	}
 }
 
-func TestHandleRidePayload_UpdateWindowRebindsTokenToNewSource(t *testing.T) {
+func TestHandleRidePayload_UpdateWindowAppliesDeferredBreakpointsWithConsistentLineTranslation(t *testing.T) {
+	ride := &mockRideController{}
 	server := NewServer()
+	server.SetRideController(ride)
 	enterRunningState(t, server)
 
+	_, _ = server.HandleRequest(Request{
+		Seq:     77,
+		Command: "setBreakpoints",
+		Arguments: map[string]any{
+			"source": map[string]any{
+				"path": "/ws/src/update-deferred.apl",
+			},
+			"breakpoints": []any{
+				map[string]any{"line": 1},
+				map[string]any{"line": 10},
+			},
+		},
+	})
+
 	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "OpenWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    305,
-			Filename: "/ws/src/old.apl",
+			Token:    511,
+			Filename: "/ws/src/other.apl",
 		},
 	})
-	oldRef, ok := server.ResolveSourceReferenceForToken(305)
-	if !ok {
-		t.Fatal("expected old source ref")
-	}
 
 	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "UpdateWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    305,
-			Filename: "/ws/src/new.apl",
+			Token:    511,
+			Filename: "/ws/src/update-deferred.apl",
 		},
 	})
 
-	newRef, ok := server.ResolveSourceReferenceForToken(305)
-	if !ok {
-		t.Fatal("expected updated source ref")
-	}
-	if newRef == oldRef {
-		t.Fatal("expected updated source ref to differ after path change")
-	}
-	if _, ok := server.ResolveTokenForSourceReference(oldRef); ok {
-		t.Fatal("expected old source ref to be unbound from token")
+	last := ride.lastCall()
+	if last.command != "SetLineAttributes" {
+		t.Fatalf("expected SetLineAttributes, got %q", last.command)
 	}
-	token, ok := server.ResolveTokenForSourceReference(newRef)
-	if !ok || token != 305 {
-		t.Fatalf("expected new sourceRef to map to token 305, got %d (ok=%v)", token, ok)
+	stop := last.args["stop"].([]int)
+	if len(stop) != 2 || stop[0] != 0 || stop[1] != 9 {
+		t.Fatalf("expected consistent zero-based stops [0 9], got %#v", stop)
 	}
 }
 
-func TestHandleRidePayload_RebindingPathToNewTokenUnbindsOldToken(t *testing.T) {
+func TestHandleRidePayload_ReopenSourceAppliesDeferredBySourceReference(t *testing.T) {
+	ride := &mockRideController{}
 	server := NewServer()
+	server.SetRideController(ride)
 	enterRunningState(t, server)
 
 	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "OpenWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    306,
-			Filename: "/ws/src/shared.apl",
+			Token:    503,
+			Filename: "/ws/src/source-ref.apl",
 		},
 	})
-	ref, ok := server.ResolveSourceReferenceForToken(306)
+	sourceRef, ok := server.ResolveSourceReferenceForToken(503)
 	if !ok {
-		t.Fatal("expected source ref for first token")
+		t.Fatal("expected source reference")
 	}
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "CloseWindow",
+		Args: protocol.WindowArgs{
+			Win: 503,
+		},
+	})
+
+	_, _ = server.HandleRequest(Request{
+		Seq:     76,
+		Command: "setBreakpoints",
+		Arguments: map[string]any{
+			"source": map[string]any{
+				"sourceReference": sourceRef,
+			},
+			"breakpoints": []any{
+				map[string]any{"line": 12},
+			},
+		},
+	})
 
 	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "OpenWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    307,
-			Filename: "/ws/src/shared.apl",
+			Token:    504,
+			Filename: "/ws/src/source-ref.apl",
 		},
 	})
 
-	if _, ok := server.ResolveSourceReferenceForToken(306); ok {
-		t.Fatal("expected first token to be unbound after rebind")
+	last := ride.lastCall()
+	if last.command != "SetLineAttributes" {
+		t.Fatalf("expected SetLineAttributes, got %q", last.command)
 	}
-	token, ok := server.ResolveTokenForSourceReference(ref)
-	if !ok || token != 307 {
-		t.Fatalf("expected sourceRef to map to token 307, got %d (ok=%v)", token, ok)
+	if last.args["win"] != 504 {
+		t.Fatalf("expected win=504, got %#v", last.args["win"])
+	}
+	stop := last.args["stop"].([]int)
+	if len(stop) != 1 || stop[0] != 11 {
+		t.Fatalf("expected stop=[11], got %#v", stop)
 	}
 }
 
-func TestHandleRequest_SetBreakpointsTranslatesLinesAndSendsSetLineAttributes(t *testing.T) {
-	ride := &mockRideController{}
+func TestHandleRidePayload_DialogPromptForwardsEventAndReplyRequestAnswers(t *testing.T) {
 	server := NewServer()
-	server.SetRideController(ride)
 	enterRunningState(t, server)
+	ride := &mockRideController{}
+	server.SetRideController(ride)
 
-	server.HandleRidePayload(protocol.DecodedPayload{
+	events := server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
-		Command: "OpenWindow",
-		Args: protocol.WindowContentArgs{
-			Token:    401,
-			Filename: "/ws/src/break.apl",
+		Command: "TaskDialog",
+		Args: protocol.TaskDialogArgs{
+			Title:      "Save changes?",
+			Text:       "Fn was modified",
+			ButtonText: []string{"Save", "Discard"},
+			Token:      9,
 		},
 	})
+	if len(events) != 1 || events[0].Event != "dyalog/dialog" {
+		t.Fatalf("expected dyalog/dialog event, got %#v", events)
+	}
+	body, ok := events[0].Body.(DialogEventBody)
+	if !ok || body.Kind != "task" || body.Token != 9 || len(body.ButtonText) != 2 {
+		t.Fatalf("unexpected dialog body: %#v", events[0].Body)
+	}
+	if len(ride.calls) != 0 {
+		t.Fatalf("expected no reply before the client answers, got %#v", ride.calls)
+	}
 
 	resp, _ := server.HandleRequest(Request{
-		Seq:     70,
-		Command: "setBreakpoints",
-		Arguments: map[string]any{
-			"source": map[string]any{
-				"path": "/ws/src/break.apl",
-			},
-			"breakpoints": []any{
-				map[string]any{"line": 2},
-				map[string]any{"line": 5},
-			},
-		},
+		Seq:       300,
+		Command:   "dyalog/replyDialog",
+		Arguments: map[string]any{"token": 9, "index": 102},
 	})
-	if !resp.Success {
-		t.Fatalf("expected setBreakpoints success, got %s", resp.Message)
+	if resp.Success {
+		t.Fatal("expected out-of-range button index to be rejected")
 	}
 
-	call := ride.lastCall()
-	if call.command != "SetLineAttributes" {
-		t.Fatalf("expected SetLineAttributes, got %q", call.command)
-	}
-	if call.args["win"] != 401 {
-		t.Fatalf("expected win=401, got %#v", call.args["win"])
-	}
-	stop, ok := call.args["stop"].([]int)
-	if !ok {
-		t.Fatalf("expected []int stop array, got %T", call.args["stop"])
+	resp, _ = server.HandleRequest(Request{
+		Seq:       301,
+		Command:   "dyalog/replyDialog",
+		Arguments: map[string]any{"token": 9, "index": 101},
+	})
+	if !resp.Success {
+		t.Fatalf("expected reply to succeed, got %q", resp.Message)
 	}
-	if len(stop) != 2 || stop[0] != 1 || stop[1] != 4 {
-		t.Fatalf("expected stop=[1 4], got %#v", stop)
+	last := ride.lastCall()
+	if last.command != "ReplyTaskDialog" || last.args["index"] != 101 || last.args["token"] != 9 {
+		t.Fatalf("unexpected reply: %#v", last)
 	}
 
-	body, ok := resp.Body.(SetBreakpointsResponseBody)
-	if !ok {
-		t.Fatalf("expected SetBreakpointsResponseBody, got %T", resp.Body)
-	}
-	if len(body.Breakpoints) != 2 {
-		t.Fatalf("expected 2 breakpoint responses, got %d", len(body.Breakpoints))
+	resp, _ = server.HandleRequest(Request{
+		Seq:       302,
+		Command:   "dyalog/replyDialog",
+		Arguments: map[string]any{"token": 9, "index": 100},
+	})
+	if resp.Success {
+		t.Fatal("expected answered dialog to be gone")
 	}
-	if !body.Breakpoints[0].Verified || body.Breakpoints[0].Line != 2 {
-		t.Fatalf("unexpected first breakpoint response: %#v", body.Breakpoints[0])
+}
+
+func TestHandleRidePayload_DialogPolicyAnswersWithoutClient(t *testing.T) {
+	cases := []struct {
+		policy  string
+		command string
+		args    any
+		reply   string
+		field   string
+		want    any
+	}{
+		{DialogPolicyCancel, "OptionsDialog", protocol.OptionsDialogArgs{Options: []string{"Yes", "No"}, Token: 1}, "ReplyOptionsDialog", "index", -1},
+		{DialogPolicyCancel, "StringDialog", protocol.StringDialogArgs{InitialValue: "a", DefaultValue: "b", Token: 2}, "ReplyStringDialog", "value", "b"},
+		{DialogPolicyDefault, "StringDialog", protocol.StringDialogArgs{InitialValue: "a", DefaultValue: "b", Token: 3}, "ReplyStringDialog", "value", "a"},
+		{DialogPolicyDefault, "TaskDialog", protocol.TaskDialogArgs{ButtonText: []string{"OK"}, Token: 4}, "ReplyTaskDialog", "index", 100},
+		{DialogPolicyDefault, "OptionsDialog", protocol.OptionsDialogArgs{Options: []string{"Yes", "No"}, Token: 5}, "ReplyOptionsDialog", "index", 0},
 	}
-	if !strings.Contains(strings.ToLower(body.Breakpoints[0].Message), "active") {
-		t.Fatalf("expected active breakpoint message, got %#v", body.Breakpoints[0])
+	for _, tc := range cases {
+		server := NewServer()
+		enterRunningState(t, server)
+		server.SetDialogPolicy(tc.policy)
+		ride := &mockRideController{}
+		server.SetRideController(ride)
+
+		events := server.HandleRidePayload(protocol.DecodedPayload{Kind: protocol.KindCommand, Command: tc.command, Args: tc.args})
+		if len(events) != 1 || events[0].Event != "output" {
+			t.Fatalf("%s/%s: expected console note, got %#v", tc.policy, tc.command, events)
+		}
+		last := ride.lastCall()
+		if last.command != tc.reply || last.args[tc.field] != tc.want {
+			t.Fatalf("%s/%s: unexpected reply %#v", tc.policy, tc.command, last)
+		}
 	}
 }
 
-func TestHandleRequest_SetBreakpointsSupportsSourceReferenceLookup(t *testing.T) {
-	ride := &mockRideController{}
+func TestHandleEditRequest_OpensSavesAndClosesEditorWindow(t *testing.T) {
 	server := NewServer()
-	server.SetRideController(ride)
 	enterRunningState(t, server)
+	ride := &mockRideController{}
+	ride.onSend = func(command string, args map[string]any) {
+		switch command {
+		case "Edit":
+			server.HandleRidePayload(protocol.DecodedPayload{
+				Kind:    protocol.KindCommand,
+				Command: "OpenWindow",
+				Args: protocol.WindowContentArgs{
+					Token:      31,
+					Name:       "Foo",
+					Text:       []string{"r←Foo y", "r←y+1"},
+					EntityType: 1,
+					Stop:       []int{1},
+				},
+			})
+		case "SaveChanges":
+			ride.receive(server, protocol.DecodedPayload{
+				Kind:    protocol.KindCommand,
+				Command: "ReplySaveChanges",
+				Args:    protocol.ReplySaveChangesArgs{Win: 31},
+			})
+		}
+	}
+	server.SetRideController(ride)
 
-	server.HandleRidePayload(protocol.DecodedPayload{
-		Kind:    protocol.KindCommand,
-		Command: "OpenWindow",
-		Args: protocol.WindowContentArgs{
-			Token:    402,
-			Filename: "/ws/src/ref.apl",
-		},
+	resp, _ := server.HandleRequest(Request{
+		Seq:       400,
+		Command:   "dyalog/edit",
+		Arguments: map[string]any{"name": "Foo"},
 	})
-	sourceRef, ok := server.ResolveSourceReferenceForToken(402)
-	if !ok {
-		t.Fatal("expected sourceRef for token")
+	if !resp.Success {
+		t.Fatalf("expected edit to succeed, got %q", resp.Message)
+	}
+	body, ok := resp.Body.(EditResponseBody)
+	if !ok || body.Win != 31 || body.Name != "Foo" || body.Content != "r←Foo y\nr←y+1" {
+		t.Fatalf("unexpected edit body: %#v", resp.Body)
+	}
+	if edit := ride.calls[0]; edit.command != "Edit" || edit.args["text"] != "Foo" || edit.args["pos"] != 3 {
+		t.Fatalf("unexpected Edit call: %#v", edit)
 	}
 
-	resp, _ := server.HandleRequest(Request{
-		Seq:     71,
-		Command: "setBreakpoints",
-		Arguments: map[string]any{
-			"source": map[string]any{
-				"sourceReference": sourceRef,
-			},
-			"breakpoints": []any{
-				map[string]any{"line": 10},
-			},
-		},
+	resp, _ = server.HandleRequest(Request{
+		Seq:       401,
+		Command:   "dyalog/saveChanges",
+		Arguments: map[string]any{"win": 31, "content": "r←Foo y\r\nr←y+2", "close": true},
 	})
 	if !resp.Success {
-		t.Fatalf("expected setBreakpoints success, got %s", resp.Message)
+		t.Fatalf("expected save to succeed, got %q", resp.Message)
 	}
-	call := ride.lastCall()
-	if call.command != "SetLineAttributes" || call.args["win"] != 402 {
-		t.Fatalf("unexpected SetLineAttributes call: %#v", call)
+	if len(ride.calls) != 3 || ride.calls[1].command != "SaveChanges" || ride.calls[2].command != "CloseWindow" {
+		t.Fatalf("expected SaveChanges then CloseWindow, got %#v", ride.calls)
+	}
+	save := ride.calls[1].args
+	text := save["text"].([]string)
+	if len(text) != 2 || text[1] != "r←y+2" {
+		t.Fatalf("unexpected saved text: %#v", save["text"])
+	}
+	if stop := save["stop"].([]int); len(stop) != 1 || stop[0] != 1 {
+		t.Fatalf("expected window stops kept on save, got %#v", save["stop"])
 	}
 }
 
-func TestHandleRequest_SetBreakpointsUnverifiedWhenSourceNotMapped(t *testing.T) {
-	ride := &mockRideController{}
+func TestHandleEditRequest_IgnoresWindowsOpenedForOtherNames(t *testing.T) {
 	server := NewServer()
-	server.SetRideController(ride)
 	enterRunningState(t, server)
+	ride := &mockRideController{}
+	ride.onSend = func(command string, args map[string]any) {
+		if command != "Edit" {
+			return
+		}
+		// Another client's edit, and a focus change to it, land before the window asked for.
+		server.HandleRidePayload(protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "OpenWindow",
+			Args:    protocol.WindowContentArgs{Token: 33, Name: "Other", Text: []string{"Other"}},
+		})
+		server.HandleRidePayload(protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "GotoWindow",
+			Args:    protocol.WindowArgs{Win: 33},
+		})
+		server.HandleRidePayload(protocol.DecodedPayload{
+			Kind:    protocol.KindCommand,
+			Command: "OpenWindow",
+			Args:    protocol.WindowContentArgs{Token: 34, Name: "#.Foo", Text: []string{"r←Foo"}},
+		})
+	}
+	server.SetRideController(ride)
 
 	resp, _ := server.HandleRequest(Request{
-		Seq:     72,
-		Command: "setBreakpoints",
-		Arguments: map[string]any{
-			"source": map[string]any{
-				"path": "/ws/src/missing.apl",
-			},
-			"breakpoints": []any{
-				map[string]any{"line": 3},
-			},
-		},
+		Seq:       404,
+		Command:   "dyalog/edit",
+		Arguments: map[string]any{"name": "Foo"},
 	})
 	if !resp.Success {
-		t.Fatalf("expected setBreakpoints success with unverified breakpoints, got %s", resp.Message)
-	}
-	if len(ride.calls) != 1 {
-		t.Fatalf("expected one RIDE command send, got %#v", ride.calls)
+		t.Fatalf("expected edit to succeed, got %q", resp.Message)
 	}
-	if ride.calls[0].command != "GetWindowLayout" {
-		t.Fatalf("expected GetWindowLayout sync request, got %q", ride.calls[0].command)
+	if body := resp.Body.(EditResponseBody); body.Win != 34 || body.Name != "#.Foo" {
+		t.Fatalf("expected the window for #.Foo, got %#v", body)
 	}
+}
 
-	body := resp.Body.(SetBreakpointsResponseBody)
-	if len(body.Breakpoints) != 1 {
-		t.Fatalf("expected one breakpoint response, got %d", len(body.Breakpoints))
+func TestHandleEditRequest_ReportsRejectedSaveAndUnknownWindow(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+	ride := &mockRideController{}
+	ride.onSend = func(command string, args map[string]any) {
+		if command == "SaveChanges" {
+			ride.receive(server, protocol.DecodedPayload{
+				Kind:    protocol.KindCommand,
+				Command: "ReplySaveChanges",
+				Args:    map[string]any{"win": float64(32), "err": float64(1)},
+			})
+		}
 	}
-	if body.Breakpoints[0].Verified {
-		t.Fatal("expected unverified breakpoint for unmapped source")
+	server.SetRideController(ride)
+	server.HandleRidePayload(protocol.DecodedPayload{
+		Kind:    protocol.KindCommand,
+		Command: "OpenWindow",
+		Args:    protocol.WindowContentArgs{Token: 32, Name: "Bar", Text: []string{"Bar"}},
+	})
+
+	resp, _ := server.HandleRequest(Request{
+		Seq:       402,
+		Command:   "dyalog/saveChanges",
+		Arguments: map[string]any{"win": 32, "content": "Bar;"},
+	})
+	if resp.Success || !strings.Contains(resp.Message, "err=1") {
+		t.Fatalf("expected rejected save to fail, got %#v", resp)
 	}
-	if !strings.Contains(strings.ToLower(body.Breakpoints[0].Message), "pending") {
-		t.Fatalf("expected pending breakpoint message, got %#v", body.Breakpoints[0])
+
+	resp, _ = server.HandleRequest(Request{
+		Seq:       403,
+		Command:   "dyalog/saveChanges",
+		Arguments: map[string]any{"win": 99, "content": ""},
+	})
+	if resp.Success {
+		t.Fatal("expected save to an unknown window to fail")
 	}
 }
 
-func TestHandleRequest_SetBreakpointsPendingEmitsDiagnosticOutputEvent(t *testing.T) {
-	ride := &mockRideController{}
-	server := NewServer()
-	server.SetRideController(ride)
-	enterRunningState(t, server)
-
-	resp, events := server.HandleRequest(Request{
-		Seq:     72,
-		Command: "setBreakpoints",
-		Arguments: map[string]any{
-			"source": map[string]any{
-				"path": "/ws/src/pending.apl",
-			},
-			"breakpoints": []any{
-				map[string]any{"line": 3},
-			},
-		},
-	})
-	if !resp.Success {
-		t.Fatalf("expected pending setBreakpoints success, got %s", resp.Message)
+func TestVirtualSourcePath_RoundTripsEntityNames(t *testing.T) {
+	cases := []struct {
+		name       string
+		entityType int
+		path       string
+		qualified  string
+	}{
+		{"#.Ns.Fn", 1, "dyalog:/%23/Ns/Fn.aplf", "#.Ns.Fn"},
+		{"Fn", 1, "dyalog:/%23/Fn.aplf", "#.Fn"},
+		{"⎕SE.Util", 256, "dyalog:/%E2%8E%95SE/Util.apln", "⎕SE.Util"},
+		{"#.data", 16, "dyalog:/%23/data.apla", "#.data"},
 	}
-	if len(events) != 1 || events[0].Event != "output" {
-		t.Fatalf("expected one output diagnostic event, got %#v", events)
+	for _, tc := range cases {
+		path := virtualSourcePath(tc.name, tc.entityType)
+		if path != tc.path {
+			t.Fatalf("%s: expected %q, got %q", tc.name, tc.path, path)
+		}
+		if name, ok := virtualSourceName(path); !ok || name != tc.qualified {
+			t.Fatalf("%s: expected name %q, got %q (%v)", tc.name, tc.qualified, name, ok)
+		}
 	}
-	output := events[0].Body.(OutputEventBody).Output
-	if !strings.Contains(strings.ToLower(output), "breakpoints pending") {
-		t.Fatalf("expected pending diagnostic output, got %q", output)
+	if got := canonicalSourcePath("dyalog:/#/Ns/Fn.aplf"); got != "dyalog:/%23/Ns/Fn.aplf" {
+		t.Fatalf("expected unescaped # to canonicalize, got %q", got)
+	}
+	if got := canonicalSourcePath("/ws/src/Fn.aplf"); got != "/ws/src/Fn.aplf" {
+		t.Fatalf("expected file path unchanged, got %q", got)
 	}
 }
 
-func TestHandleRidePayload_OpenWindowAppliesDeferredBreakpoints(t *testing.T) {
-	ride := &mockRideController{}
+func TestHandleRidePayload_WorkspaceOnlyFunctionGetsVirtualSourceAndKeepsBreakpoints(t *testing.T) {
 	server := NewServer()
-	server.SetRideController(ride)
 	enterRunningState(t, server)
+	ride := &mockRideController{}
+	server.SetRideController(ride)
 
+	// Breakpoints from an earlier session arrive before the function is open.
 	resp, _ := server.HandleRequest(Request{
-		Seq:     73,
+		Seq:     500,
 		Command: "setBreakpoints",
 		Arguments: map[string]any{
-			"source": map[string]any{
-				"path": "/ws/src/deferred.apl",
-			},
-			"breakpoints": []any{
-				map[string]any{"line": 4},
-				map[string]any{"line": 9},
-			},
+			"source":      map[string]any{"path": "dyalog:/#/Ns/Fn.aplf"},
+			"breakpoints": []any{map[string]any{"line": 2}},
 		},
 	})
-	if !resp.Success {
-		t.Fatalf("expected setBreakpoints success, got %s", resp.Message)
+	body := resp.Body.(SetBreakpointsResponseBody)
+	if len(body.Breakpoints) != 1 || body.Breakpoints[0].Verified {
+		t.Fatalf("expected pending breakpoint, got %#v", body.Breakpoints)
 	}
 
-	events := server.HandleRidePayload(protocol.DecodedPayload{
+	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "OpenWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    501,
-			Filename: "/ws/src/deferred.apl",
+			Token:      41,
+			Name:       "#.Ns.Fn",
+			EntityType: 1,
+			Text:       []string{"Fn", "⎕←1", "⎕←2"},
+			Debugger:   true,
+			Tid:        1,
 		},
 	})
-
-	if len(ride.calls) < 2 {
-		t.Fatalf("expected deferred SetLineAttributes call after sync request, got %#v", ride.calls)
-	}
 	last := ride.lastCall()
-	if last.command != "SetLineAttributes" {
-		t.Fatalf("expected SetLineAttributes, got %q", last.command)
+	if last.command != "SetLineAttributes" || last.args["win"] != 41 {
+		t.Fatalf("expected pending breakpoints applied to window 41, got %#v", last)
 	}
-	if last.args["win"] != 501 {
-		t.Fatalf("expected win=501, got %#v", last.args["win"])
+	if stop := last.args["stop"].([]int); len(stop) != 1 || stop[0] != 1 {
+		t.Fatalf("expected stop=[1], got %#v", last.args["stop"])
 	}
-	stop := last.args["stop"].([]int)
-	if len(stop) != 2 || stop[0] != 3 || stop[1] != 8 {
-		t.Fatalf("expected stop=[3 8], got %#v", stop)
+
+	resp, _ = server.HandleRequest(Request{Seq: 501, Command: "stackTrace", Arguments: map[string]any{"threadId": 1}})
+	frames := resp.Body.(StackTraceResponseBody).StackFrames
+	if len(frames) != 1 || frames[0].Source == nil {
+		t.Fatalf("expected one frame with a source, got %#v", frames)
 	}
-	if len(events) == 0 || events[0].Event != "output" {
-		t.Fatalf("expected output diagnostic event from deferred apply, got %#v", events)
+	if source := *frames[0].Source; source.Path != "dyalog:/%23/Ns/Fn.aplf" || source.SourceReference != 0 {
+		t.Fatalf("expected virtual path without sourceReference, got %#v", source)
 	}
-	if !strings.Contains(strings.ToLower(events[0].Body.(OutputEventBody).Output), "deferred apply succeeded") {
-		t.Fatalf("expected deferred apply success diagnostic, got %#v", events[0])
+
+	resp, _ = server.HandleRequest(Request{
+		Seq:       502,
+		Command:   "source",
+		Arguments: map[string]any{"source": map[string]any{"path": "dyalog:/%23/Ns/Fn.aplf"}},
+	})
+	if content := resp.Body.(SourceResponseBody).Content; content != "Fn\n⎕←1\n⎕←2" {
+		t.Fatalf("unexpected source content: %q", content)
 	}
 }
 
-func TestHandleRequest_SetBreakpointsUnmappedReplacesDeferredLines(t *testing.T) {
-	ride := &mockRideController{}
+func TestHandleSourceRequest_VirtualSourceWithoutWindowOpensItViaEdit(t *testing.T) {
 	server := NewServer()
-	server.SetRideController(ride)
 	enterRunningState(t, server)
+	ride := &mockRideController{}
+	ride.onSend = func(command string, args map[string]any) {
+		if command == "Edit" {
+			server.HandleRidePayload(protocol.DecodedPayload{
+				Kind:    protocol.KindCommand,
+				Command: "OpenWindow",
+				Args: protocol.WindowContentArgs{
+					Token:      42,
+					Name:       stringFromAny(args["text"]),
+					EntityType: 1,
+					Text:       []string{"r←Gn", "r←42"},
+				},
+			})
+		}
+	}
+	server.SetRideController(ride)
 
-	_, _ = server.HandleRequest(Request{
-		Seq:     74,
-		Command: "setBreakpoints",
-		Arguments: map[string]any{
-			"source": map[string]any{
-				"path": "/ws/src/replace.apl",
-			},
-			"breakpoints": []any{
-				map[string]any{"line": 2},
-			},
-		},
-	})
-	_, _ = server.HandleRequest(Request{
-		Seq:     75,
-		Command: "setBreakpoints",
-		Arguments: map[string]any{
-			"source": map[string]any{
-				"path": "/ws/src/replace.apl",
-			},
-			"breakpoints": []any{
-				map[string]any{"line": 7},
-			},
-		},
+	resp, _ := server.HandleRequest(Request{
+		Seq:       503,
+		Command:   "source",
+		Arguments: map[string]any{"source": map[string]any{"path": "dyalog:/%23/Ns/Gn.aplf"}},
 	})
+	if !resp.Success {
+		t.Fatalf("expected source to succeed, got %q", resp.Message)
+	}
+	if content := resp.Body.(SourceResponseBody).Content; content != "r←Gn\nr←42" {
+		t.Fatalf("unexpected source content: %q", content)
+	}
+	if edit := ride.calls[0]; edit.command != "Edit" || edit.args["text"] != "#.Ns.Gn" {
+		t.Fatalf("expected Edit for #.Ns.Gn, got %#v", edit)
+	}
+	if len(ride.calls) != 2 || ride.calls[1].command != "CloseWindow" || ride.calls[1].args["win"] != 42 {
+		t.Fatalf("expected the window opened for the read to be closed, got %#v", ride.calls)
+	}
+}
+
+func TestHandleRidePayload_LinkedClassMethodMapsToItsLinesInTheScript(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "Calc.aplc")
+	script := ":Class Calc\n    ∇ r←Add y\n      :Access Public\n      r←y+1\n    ∇\n:EndClass\n"
+	if err := os.WriteFile(scriptPath, []byte(script), 0o600); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
 
+	server := NewServer()
+	enterRunningState(t, server)
+	ride := &mockRideController{}
+	server.SetRideController(ride)
 	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "OpenWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    502,
-			Filename: "/ws/src/replace.apl",
+			Token:      51,
+			Name:       "#.Calc.Add",
+			Filename:   scriptPath,
+			Text:       []string{"r←Add y", ":Access Public", "r←y+1"},
+			Debugger:   true,
+			Tid:        1,
+			CurrentRow: 2,
 		},
 	})
 
+	resp, _ := server.HandleRequest(Request{Seq: 600, Command: "stackTrace", Arguments: map[string]any{"threadId": 1}})
+	frames := resp.Body.(StackTraceResponseBody).StackFrames
+	if len(frames) != 1 || frames[0].Line != 4 {
+		t.Fatalf("expected frame on script line 4, got %#v", frames)
+	}
+
+	resp, _ = server.HandleRequest(Request{
+		Seq:     601,
+		Command: "setBreakpoints",
+		Arguments: map[string]any{
+			"source":      map[string]any{"path": scriptPath},
+			"breakpoints": []any{map[string]any{"line": 4}, map[string]any{"line": 6}},
+		},
+	})
+	breakpoints := resp.Body.(SetBreakpointsResponseBody).Breakpoints
+	if len(breakpoints) != 2 || !breakpoints[0].Verified || breakpoints[1].Verified {
+		t.Fatalf("expected line 4 verified and line 6 outside the method, got %#v", breakpoints)
+	}
 	last := ride.lastCall()
-	if last.command != "SetLineAttributes" {
-		t.Fatalf("expected SetLineAttributes, got %q", last.command)
+	if stop := last.args["stop"].([]int); last.command != "SetLineAttributes" || len(stop) != 1 || stop[0] != 2 {
+		t.Fatalf("expected stop on window line 2, got %#v", last)
 	}
-	stop := last.args["stop"].([]int)
-	if len(stop) != 1 || stop[0] != 6 {
-		t.Fatalf("expected latest deferred stop=[6], got %#v", stop)
+
+	resp, _ = server.HandleRequest(Request{
+		Seq:       602,
+		Command:   "source",
+		Arguments: map[string]any{"source": map[string]any{"path": scriptPath}},
+	})
+	if content := resp.Body.(SourceResponseBody).Content; content != script {
+		t.Fatalf("expected whole script as source, got %q", content)
 	}
 }
 
-func TestHandleRidePayload_UpdateWindowAppliesDeferredBreakpointsWithConsistentLineTranslation(t *testing.T) {
-	ride := &mockRideController{}
+func TestHeaderDeclares_ParsesTheEntityName(t *testing.T) {
+	cases := []struct {
+		line string
+		name string
+		want bool
+	}{
+		{"∇ r←Add y", "Add", true},
+		{"    ∇ r←Add y;t;u ⍝ adds", "Add", true},
+		{"r←x Add y", "Add", true},
+		{"{r}←{x}Add y", "Add", true},
+		{"Add", "Add", true},
+		{"∇ Add y", "Add", true},
+		{"r←(f Over g) y", "Over", true},
+		{"r←x (f Over) y", "Over", true},
+		{"Add←{⍵+1}", "Add", true},
+		{"Add←{", "Add", true},
+		{"∇ r←AddAll y", "Add", false},
+		{"∇ r←Add y", "AddAll", false},
+		{"r←x Add y", "x", false},
+		{"r←Add y", "r", false},
+		{"r←Add⍵", "Add", true},
+		{"total←{⍵+1}", "Add", false},
+	}
+	for _, tc := range cases {
+		if got := headerDeclares(tc.line, tc.name); got != tc.want {
+			t.Fatalf("headerDeclares(%q, %q) = %v, want %v", tc.line, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSourceLineOffset_AnchorsOnTheHeaderAndReportsAmbiguity(t *testing.T) {
+	file := strings.Split(":Class Calc\n∇ r←AddAll y\nr←y+1\n∇\n∇ r←Add y\nr←y+1\n∇\n:EndClass", "\n")
+	window := protocol.WindowContentArgs{Name: "#.Calc.Add", Filename: "Calc.aplc", Text: []string{"r←Add y", "r←y+1"}}
+	if offset, note := sourceLineOffset(window, file); offset != 4 || note != "" {
+		t.Fatalf("expected Add at line 5 rather than AddAll, got offset %d (%q)", offset, note)
+	}
+
+	twice := strings.Split(":Namespace N\n:Class A\n∇ r←Add y\nr←y+1\n∇\n:EndClass\n:Class B\n∇ r←Add y\nr←y+1\n∇\n:EndClass\n:EndNamespace", "\n")
+	offset, note := sourceLineOffset(window, twice)
+	if offset != 2 || !strings.Contains(note, "matches 2 places") {
+		t.Fatalf("expected ambiguous Add reported and mapped to the first, got offset %d (%q)", offset, note)
+	}
+
+	offset, note = sourceLineOffset(protocol.WindowContentArgs{Name: "Sub", Filename: "Calc.aplc", Text: []string{"r←Sub y", "r←y-1"}}, file)
+	if offset != 0 || !strings.Contains(note, "Sub was not found") {
+		t.Fatalf("expected missing Sub reported, got offset %d (%q)", offset, note)
+	}
+}
+
+func TestHandleRidePayload_AmbiguousScriptMethodIsReportedOnce(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "Pair.apln")
+	script := ":Namespace Pair\n:Class A\n∇ r←Add y\nr←y+1\n∇\n:EndClass\n:Class B\n∇ r←Add y\nr←y+1\n∇\n:EndClass\n:EndNamespace\n"
+	if err := os.WriteFile(scriptPath, []byte(script), 0o600); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
 	server := NewServer()
-	server.SetRideController(ride)
 	enterRunningState(t, server)
+	server.SetRideController(&mockRideController{})
+	window := protocol.WindowContentArgs{Token: 53, Name: "#.Pair.B.Add", Filename: scriptPath, Text: []string{"r←Add y", "r←y+1"}}
 
-	_, _ = server.HandleRequest(Request{
-		Seq:     77,
-		Command: "setBreakpoints",
-		Arguments: map[string]any{
-			"source": map[string]any{
-				"path": "/ws/src/update-deferred.apl",
-			},
-			"breakpoints": []any{
-				map[string]any{"line": 1},
-				map[string]any{"line": 10},
-			},
-		},
-	})
+	events := server.HandleRidePayload(protocol.DecodedPayload{Kind: protocol.KindCommand, Command: "OpenWindow", Args: window})
+	if len(events) != 1 || !strings.Contains(events[0].Body.(OutputEventBody).Output, "#.Pair.B.Add matches 2 places") {
+		t.Fatalf("expected a console note about the ambiguous method, got %#v", events)
+	}
+	events = server.HandleRidePayload(protocol.DecodedPayload{Kind: protocol.KindCommand, Command: "UpdateWindow", Args: window})
+	if len(events) != 0 {
+		t.Fatalf("expected the note only once, got %#v", events)
+	}
+}
 
+func TestHandleRidePayload_RideOffsetShiftsFrameLinesWithoutTheFile(t *testing.T) {
+	server := NewServer()
+	enterRunningState(t, server)
+	server.SetRideController(&mockRideController{})
 	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "OpenWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    511,
-			Filename: "/ws/src/other.apl",
+			Token:      52,
+			Name:       "Mul",
+			Filename:   filepath.Join(t.TempDir(), "missing.apln"),
+			Text:       []string{"r←Mul y", "r←y×2"},
+			Offset:     10,
+			Debugger:   true,
+			Tid:        1,
+			CurrentRow: 1,
 		},
 	})
 
-	server.HandleRidePayload(protocol.DecodedPayload{
-		Kind:    protocol.KindCommand,
-		Command: "UpdateWindow",
-		Args: protocol.WindowContentArgs{
-			Token:    511,
-			Filename: "/ws/src/update-deferred.apl",
-		},
-	})
+	resp, _ := server.HandleRequest(Request{Seq: 603, Command: "stackTrace", Arguments: map[string]any{"threadId": 1}})
+	frames := resp.Body.(StackTraceResponseBody).StackFrames
+	if len(frames) != 1 || frames[0].Line != 12 {
+		t.Fatalf("expected frame on file line 12, got %#v", frames)
+	}
+}
 
-	last := ride.lastCall()
-	if last.command != "SetLineAttributes" {
-		t.Fatalf("expected SetLineAttributes, got %q", last.command)
+func TestMapPathRoots_LongestRootWinsAndWindowsRootsIgnoreCase(t *testing.T) {
+	mappings := []PathMapping{
+		{LocalRoot: "/home/me/app", RemoteRoot: "C:\\Apps\\App"},
+		{LocalRoot: "/home/me/lib", RemoteRoot: "C:\\Apps\\App\\lib"},
+		{LocalRoot: "/src", RemoteRoot: "/opt/src"},
 	}
-	stop := last.args["stop"].([]int)
-	if len(stop) != 2 || stop[0] != 0 || stop[1] != 9 {
-		t.Fatalf("expected consistent zero-based stops [0 9], got %#v", stop)
+	remoteToLocal := func(m PathMapping) (string, string) { return m.RemoteRoot, m.LocalRoot }
+	localToRemote := func(m PathMapping) (string, string) { return m.LocalRoot, m.RemoteRoot }
+
+	cases := []struct {
+		path  string
+		roots func(PathMapping) (string, string)
+		want  string
+	}{
+		{"c:\\apps\\app\\src\\Foo.aplf", remoteToLocal, "/home/me/app/src/Foo.aplf"},
+		{"C:/Apps/App/lib/Util.aplf", remoteToLocal, "/home/me/lib/Util.aplf"},
+		{"/opt/src/Bar.aplf", remoteToLocal, "/src/Bar.aplf"},
+		{"/OPT/src/Bar.aplf", remoteToLocal, "/OPT/src/Bar.aplf"},
+		{"/opt/srcfoo/Bar.aplf", remoteToLocal, "/opt/srcfoo/Bar.aplf"},
+		{"/home/me/app/src/Foo.aplf", localToRemote, "C:\\Apps\\App\\src\\Foo.aplf"},
+		{"/src/Bar.aplf", localToRemote, "/opt/src/Bar.aplf"},
+	}
+	for _, tc := range cases {
+		if got := mapPathRoots(tc.path, mappings, tc.roots); got != tc.want {
+			t.Fatalf("%s: expected %q, got %q", tc.path, tc.want, got)
+		}
 	}
 }
 
-func TestHandleRidePayload_ReopenSourceAppliesDeferredBySourceReference(t *testing.T) {
-	ride := &mockRideController{}
+func TestHandleRidePayload_PathMappingsTranslateFramesSourcesAndBreakpoints(t *testing.T) {
+	localRoot := t.TempDir()
+	if err := os.WriteFile(filepath.Join(localRoot, "Closed.aplf"), []byte("Closed"), 0o600); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+
 	server := NewServer()
-	server.SetRideController(ride)
 	enterRunningState(t, server)
-
+	server.SetPathMappings([]PathMapping{{LocalRoot: localRoot, RemoteRoot: "/remote/ws"}})
+	ride := &mockRideController{}
+	server.SetRideController(ride)
 	server.HandleRidePayload(protocol.DecodedPayload{
 		Kind:    protocol.KindCommand,
 		Command: "OpenWindow",
 		Args: protocol.WindowContentArgs{
-			Token:    503,
-			Filename: "/ws/src/source-ref.apl",
+			Token:    61,
+			Name:     "Foo",
+			Filename: "/remote/ws/Foo.aplf",
+			Text:     []string{"Foo", "⎕←1"},
+			Debugger: true,
+			Tid:      1,
 		},
 	})
-	sourceRef, ok := server.ResolveSourceReferenceForToken(503)
-	if !ok {
-		t.Fatal("expected source reference")
+
+	resp, _ := server.HandleRequest(Request{Seq: 700, Command: "stackTrace", Arguments: map[string]any{"threadId": 1}})
+	frames := resp.Body.(StackTraceResponseBody).StackFrames
+	localFoo := filepath.Join(localRoot, "Foo.aplf")
+	if len(frames) != 1 || frames[0].Source == nil || frames[0].Source.Path != localFoo {
+		t.Fatalf("expected frame source mapped to %s, got %#v", localFoo, frames)
 	}
-	server.HandleRidePayload(protocol.DecodedPayload{
-		Kind:    protocol.KindCommand,
-		Command: "CloseWindow",
-		Args: protocol.WindowArgs{
-			Win: 503,
-		},
-	})
 
-	_, _ = server.HandleRequest(Request{
-		Seq:     76,
+	resp, _ = server.HandleRequest(Request{
+		Seq:     701,
 		Command: "setBreakpoints",
 		Arguments: map[string]any{
-			"source": map[string]any{
-				"sourceReference": sourceRef,
-			},
-			"breakpoints": []any{
-				map[string]any{"line": 12},
-			},
-		},
-	})
-
-	server.HandleRidePayload(protocol.DecodedPayload{
-		Kind:    protocol.KindCommand,
-		Command: "OpenWindow",
-		Args: protocol.WindowContentArgs{
-			Token:    504,
-			Filename: "/ws/src/source-ref.apl",
+			"source":      map[string]any{"path": localFoo},
+			"breakpoints": []any{map[string]any{"line": 2}},
 		},
 	})
-
-	last := ride.lastCall()
-	if last.command != "SetLineAttributes" {
-		t.Fatalf("expected SetLineAttributes, got %q", last.command)
+	if !resp.Body.(SetBreakpointsResponseBody).Breakpoints[0].Verified {
+		t.Fatalf("expected local path to resolve to the remote window, got %#v", resp.Body)
 	}
-	if last.args["win"] != 504 {
-		t.Fatalf("expected win=504, got %#v", last.args["win"])
+	if last := ride.lastCall(); last.command != "SetLineAttributes" || last.args["win"] != 61 {
+		t.Fatalf("expected SetLineAttributes on window 61, got %#v", last)
 	}
-	stop := last.args["stop"].([]int)
-	if len(stop) != 1 || stop[0] != 11 {
-		t.Fatalf("expected stop=[11], got %#v", stop)
+
+	resp, _ = server.HandleRequest(Request{
+		Seq:       702,
+		Command:   "source",
+		Arguments: map[string]any{"source": map[string]any{"path": filepath.Join(localRoot, "Closed.aplf")}},
+	})
+	if !resp.Success || resp.Body.(SourceResponseBody).Content != "Closed" {
+		t.Fatalf("expected closed source read from the local root, got %#v", resp)
 	}
 }
@@ -13,8 +13,91 @@ func DyalogServeLaunchCommand(addr, executable string) (string, error) {
 	if executable == "" {
 		executable = "dyalog"
 	}
+	rideInit, err := dyalogRideInit(addr, false)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("RIDE_INIT=%s %s +s -q", rideInit, shellEscape(executable)), nil
+}
 
-	_, port, err := net.SplitHostPort(addr)
+// DyalogConnectLaunchCommand builds a launch command that starts Dyalog in RIDE CONNECT mode,
+// dialing back to an adapter listening on addr: RIDE_INIT=CONNECT:<host>:<port> dyalog +s -q
+func DyalogConnectLaunchCommand(addr, executable string) (string, error) {
+	if executable == "" {
+		executable = "dyalog"
+	}
+	rideInit, err := dyalogRideInit(addr, true)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("RIDE_INIT=%s %s +s -q", rideInit, shellEscape(executable)), nil
+}
+
+// DyalogLaunchOptions describes how the adapter starts a Dyalog interpreter it owns.
+type DyalogLaunchOptions struct {
+	Executable string
+	// Workspace is loaded at startup via LOAD.
+	Workspace string
+	// Args are appended after the RIDE flags.
+	Args []string
+	// Env entries are added to the inherited environment.
+	Env        map[string]string
+	Cwd        string
+	ConfigFile string
+	MaxWS      string
+	// Connect starts the interpreter in RIDE CONNECT mode instead of SERVE.
+	Connect bool
+}
+
+// DyalogLaunchSpec builds a direct process launch for Dyalog with RIDE_INIT targeting addr.
+// Interpreter settings are passed as environment variables, so no shell quoting is involved.
+// For AutoRideAddr, RIDE_INIT is filled in by the harness once a port has been picked.
+func DyalogLaunchSpec(addr string, opts DyalogLaunchOptions) (LaunchSpec, error) {
+	rideInit := ""
+	if addr != AutoRideAddr {
+		var err error
+		rideInit, err = dyalogRideInit(addr, opts.Connect)
+		if err != nil {
+			return LaunchSpec{}, err
+		}
+	}
+
+	executable := opts.Executable
+	if executable == "" {
+		executable = "dyalog"
+	}
+
+	env := make(map[string]string, len(opts.Env)+4)
+	for key, value := range opts.Env {
+		env[key] = value
+	}
+	// Adapter-managed settings win over user env so the RIDE endpoint always matches rideAddr.
+	delete(env, "RIDE_INIT")
+	if rideInit != "" {
+		env["RIDE_INIT"] = rideInit
+	}
+	if opts.Workspace != "" {
+		env["LOAD"] = opts.Workspace
+	}
+	if opts.ConfigFile != "" {
+		env["CONFIGFILE"] = opts.ConfigFile
+	}
+	if opts.MaxWS != "" {
+		env["MAXWS"] = opts.MaxWS
+	}
+
+	args := append([]string{"+s", "-q"}, opts.Args...)
+	return LaunchSpec{
+		Executable: executable,
+		Args:       args,
+		Env:        env,
+		Dir:        opts.Cwd,
+	}, nil
+}
+
+// dyalogRideInit returns the RIDE_INIT value for addr: SERVE:*:<port>, or CONNECT:<host>:<port>.
+func dyalogRideInit(addr string, connect bool) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
 		return "", fmt.Errorf("parse host:port address %q: %w", addr, err)
 	}
@@ -24,8 +107,14 @@ func DyalogServeLaunchCommand(addr, executable string) (string, error) {
 	if _, err := strconv.Atoi(port); err != nil {
 		return "", fmt.Errorf("address %q has non-numeric port %q", addr, port)
 	}
-
-	return fmt.Sprintf("RIDE_INIT=SERVE:*:%s %s +s -q", port, shellEscape(executable)), nil
+	if !connect {
+		return "SERVE:*:" + port, nil
+	}
+	// Wildcard listen hosts are not dialable; the interpreter connects back over loopback.
+	if host == "" || host == "*" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "CONNECT:" + net.JoinHostPort(host, port), nil
 }
 
 func shellEscape(value string) string {
@@ -31,3 +31,27 @@ func TestDyalogServeLaunchCommand_RejectsMissingPort(t *testing.T) {
 		t.Fatal("expected error for address without port")
 	}
 }
+
+func TestDyalogConnectLaunchCommand_DialsBackToListenAddress(t *testing.T) {
+	cmd, err := DyalogConnectLaunchCommand("10.0.0.5:4600", "")
+	if err != nil {
+		t.Fatalf("DyalogConnectLaunchCommand returned error: %v", err)
+	}
+
+	const expected = "RIDE_INIT=CONNECT:10.0.0.5:4600 dyalog +s -q"
+	if cmd != expected {
+		t.Fatalf("command mismatch: got %q want %q", cmd, expected)
+	}
+}
+
+func TestDyalogConnectLaunchCommand_WildcardHostUsesLoopback(t *testing.T) {
+	cmd, err := DyalogConnectLaunchCommand("0.0.0.0:4600", "dyalog")
+	if err != nil {
+		t.Fatalf("DyalogConnectLaunchCommand returned error: %v", err)
+	}
+
+	const expected = "RIDE_INIT=CONNECT:127.0.0.1:4600 dyalog +s -q"
+	if cmd != expected {
+		t.Fatalf("command mismatch: got %q want %q", cmd, expected)
+	}
+}
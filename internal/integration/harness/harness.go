@@ -2,27 +2,38 @@ package harness
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/stefan/lsp-dap/internal/ride/transport"
 )
 
 const (
-	defaultTranscriptDir  = "artifacts/integration"
-	defaultConnectTimeout = 10 * time.Second
-	launchStopTimeout     = 1500 * time.Millisecond
+	defaultTranscriptDir    = "artifacts/integration"
+	defaultConnectTimeout   = 10 * time.Second
+	defaultReconnectTimeout = 30 * time.Second
+	launchStopTimeout       = 1500 * time.Millisecond
+	dialAttemptTimeout      = 300 * time.Millisecond
 )
 
+// AutoRideAddr asks the harness to pick a free loopback port for an interpreter it launches.
+const AutoRideAddr = "auto"
+
 var (
 	// ErrMissingRideAddr indicates no RIDE endpoint is configured for harness startup.
 	ErrMissingRideAddr = errors.New("missing DYALOG_RIDE_ADDR")
+	// ErrNotStarted indicates the harness has no active session to operate on.
+	ErrNotStarted = errors.New("harness session is not started")
 )
 
 // Config describes integration harness runtime settings.
@@ -31,6 +42,29 @@ type Config struct {
 	LaunchCommand  string
 	ConnectTimeout time.Duration
 	TranscriptDir  string
+	// ReconnectTimeout bounds how long a dropped RIDE connection is redialed; zero disables reconnects.
+	ReconnectTimeout time.Duration
+	TLS              TLSConfig
+	// Listen makes the harness accept an interpreter started with RIDE_INIT=CONNECT on RideAddr
+	// instead of dialing a SERVE endpoint.
+	Listen bool
+	// Launch starts the interpreter directly without a shell; it takes precedence over LaunchCommand.
+	Launch *LaunchSpec
+	// LaunchStdout and LaunchStderr receive output of the launched process when set.
+	LaunchStdout io.Writer
+	LaunchStderr io.Writer
+	// LaunchRunner, when set, starts Launch on the harness's behalf (for example in a client terminal)
+	// instead of via exec. A returned process is killed on Close.
+	LaunchRunner func(ctx context.Context, spec LaunchSpec) (*os.Process, error)
+}
+
+// LaunchSpec describes an interpreter process started via exec without shell interpretation.
+type LaunchSpec struct {
+	Executable string
+	Args       []string
+	// Env entries are added to the inherited environment.
+	Env map[string]string
+	Dir string
 }
 
 // ConfigFromEnv loads harness settings from environment variables.
@@ -44,6 +78,7 @@ func ConfigFromEnv() Config {
 		cfg.TranscriptDir = defaultTranscriptDir
 	}
 	cfg.ConnectTimeout = parseDurationEnv("DYALOG_RIDE_CONNECT_TIMEOUT", defaultConnectTimeout)
+	cfg.ReconnectTimeout = parseDurationEnv("DYALOG_RIDE_RECONNECT_TIMEOUT", defaultReconnectTimeout)
 	return cfg
 }
 
@@ -63,8 +98,11 @@ func parseDurationEnv(key string, fallback time.Duration) time.Duration {
 type Harness struct {
 	cfg Config
 
+	mu             sync.Mutex
 	client         *transport.Client
+	listener       net.Listener
 	launchCmd      *exec.Cmd
+	launchProc     *os.Process
 	transcriptPath string
 	transcriptFile *os.File
 }
@@ -88,21 +126,40 @@ func (h *Harness) Start(ctx context.Context, testName string) (*transport.Client
 	if h.cfg.RideAddr == "" {
 		return nil, ErrMissingRideAddr
 	}
+	if h.cfg.RideAddr == AutoRideAddr {
+		if err := h.resolveAutoRideAddr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if h.cfg.Listen && h.listener == nil {
+		// The listener must be open before the interpreter is launched so it can phone home.
+		ln, err := net.Listen("tcp", h.cfg.RideAddr)
+		if err != nil {
+			return nil, fmt.Errorf("listen for RIDE connection: %w", err)
+		}
+		h.mu.Lock()
+		h.listener = ln
+		h.mu.Unlock()
+	}
 
 	if err := h.startLaunchCommand(ctx); err != nil {
+		h.closeListener()
 		return nil, err
 	}
 
-	conn, err := waitForDial(ctx, h.cfg.RideAddr, h.cfg.ConnectTimeout)
+	conn, err := h.connect(ctx, h.cfg.ConnectTimeout)
 	if err != nil {
 		h.stopLaunchCommand()
-		return nil, fmt.Errorf("dial RIDE endpoint: %w", err)
+		h.closeListener()
+		return nil, err
 	}
 
 	transcriptFile, transcriptPath, err := openTranscript(h.cfg.TranscriptDir, testName)
 	if err != nil {
 		_ = conn.Close()
 		h.stopLaunchCommand()
+		h.closeListener()
 		return nil, err
 	}
 
@@ -114,15 +171,125 @@ func (h *Harness) Start(ctx context.Context, testName string) (*transport.Client
 		_ = client.Close()
 		_ = transcriptFile.Close()
 		h.stopLaunchCommand()
+		h.closeListener()
 		return nil, fmt.Errorf("initialize session: %w", err)
 	}
 
+	h.mu.Lock()
 	h.client = client
+	h.mu.Unlock()
 	h.transcriptFile = transcriptFile
 	h.transcriptPath = transcriptPath
 	return client, nil
 }
 
+// resolveAutoRideAddr binds a free loopback port and points the launched interpreter at it.
+// In listen mode the listener is kept open; otherwise the port is released for Dyalog to serve on.
+func (h *Harness) resolveAutoRideAddr() error {
+	if h.cfg.Launch == nil {
+		return errors.New("rideAddr auto requires an adapter-owned interpreter launch")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("pick free RIDE port: %w", err)
+	}
+	addr := ln.Addr().String()
+	rideInit := "SERVE:" + addr
+	if h.cfg.Listen {
+		rideInit = "CONNECT:" + addr
+		h.mu.Lock()
+		h.listener = ln
+		h.mu.Unlock()
+	} else {
+		_ = ln.Close()
+	}
+
+	spec := *h.cfg.Launch
+	spec.Env = make(map[string]string, len(h.cfg.Launch.Env)+1)
+	for key, value := range h.cfg.Launch.Env {
+		spec.Env[key] = value
+	}
+	spec.Env["RIDE_INIT"] = rideInit
+	h.cfg.Launch = &spec
+	h.cfg.RideAddr = addr
+	return nil
+}
+
+// RideAddr returns the RIDE endpoint in use, with an auto address resolved once Start has run.
+func (h *Harness) RideAddr() string {
+	return h.cfg.RideAddr
+}
+
+// connect dials the configured endpoint, or accepts an inbound interpreter in listen mode.
+func (h *Harness) connect(ctx context.Context, timeout time.Duration) (net.Conn, error) {
+	h.mu.Lock()
+	ln := h.listener
+	h.mu.Unlock()
+	if ln != nil {
+		conn, err := waitForAccept(ctx, ln, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("accept RIDE connection: %w", err)
+		}
+		return conn, nil
+	}
+
+	tlsConfig, err := h.cfg.TLS.ClientConfig(h.cfg.RideAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := waitForDial(ctx, h.cfg.RideAddr, timeout, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("dial RIDE endpoint: %w", err)
+	}
+	return conn, nil
+}
+
+// Reconnect makes one attempt to redial the RIDE endpoint and re-run the protocol handshake.
+// The existing client is reused so dispatchers and transcript logging stay attached.
+func (h *Harness) Reconnect(ctx context.Context) error {
+	h.mu.Lock()
+	client := h.client
+	h.mu.Unlock()
+	if client == nil {
+		return ErrNotStarted
+	}
+
+	conn, err := h.connect(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	if h.client != client {
+		h.mu.Unlock()
+		_ = conn.Close()
+		return ErrNotStarted
+	}
+	_ = client.Close()
+	client.AttachConn(conn)
+	h.mu.Unlock()
+
+	// Bound the handshake so a half-open endpoint cannot stall the reconnect loop.
+	_ = conn.SetDeadline(time.Now().Add(h.cfg.ConnectTimeout))
+	if err := client.InitializeSession(); err != nil {
+		_ = client.Close()
+		return fmt.Errorf("initialize session: %w", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return nil
+}
+
+// ProtocolVersion returns the RIDE protocol version negotiated for the current connection.
+func (h *Harness) ProtocolVersion() int {
+	h.mu.Lock()
+	client := h.client
+	h.mu.Unlock()
+	if client == nil {
+		return 0
+	}
+	return client.ProtocolVersion()
+}
+
 // TranscriptPath returns the JSONL protocol transcript path for the current harness session.
 func (h *Harness) TranscriptPath() string {
 	return h.transcriptPath
@@ -132,12 +299,14 @@ func (h *Harness) TranscriptPath() string {
 func (h *Harness) Close() error {
 	var firstErr error
 
+	h.mu.Lock()
 	if h.client != nil {
 		if err := h.client.Close(); err != nil && firstErr == nil {
 			firstErr = err
 		}
 		h.client = nil
 	}
+	h.mu.Unlock()
 
 	if h.transcriptFile != nil {
 		if err := h.transcriptFile.Close(); err != nil && firstErr == nil {
@@ -150,15 +319,51 @@ func (h *Harness) Close() error {
 		firstErr = err
 	}
 
+	h.closeListener()
 	return firstErr
 }
 
+func (h *Harness) closeListener() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.listener == nil {
+		return
+	}
+	_ = h.listener.Close()
+	h.listener = nil
+}
+
 func (h *Harness) startLaunchCommand(ctx context.Context) error {
-	if h.cfg.LaunchCommand == "" || h.launchCmd != nil {
+	if h.launchCmd != nil || h.launchProc != nil {
+		return nil
+	}
+	if h.cfg.Launch != nil && h.cfg.LaunchRunner != nil {
+		proc, err := h.cfg.LaunchRunner(ctx, *h.cfg.Launch)
+		if err != nil {
+			return fmt.Errorf("start launch command: %w", err)
+		}
+		h.launchProc = proc
 		return nil
 	}
 
-	cmd := exec.CommandContext(ctx, "sh", "-lc", h.cfg.LaunchCommand)
+	var cmd *exec.Cmd
+	switch {
+	case h.cfg.Launch != nil:
+		spec := h.cfg.Launch
+		cmd = exec.CommandContext(ctx, spec.Executable, spec.Args...)
+		cmd.Env = launchEnv(spec.Env)
+		cmd.Dir = spec.Dir
+	case h.cfg.LaunchCommand != "":
+		cmd = exec.CommandContext(ctx, "sh", "-lc", h.cfg.LaunchCommand)
+	default:
+		return nil
+	}
+	if h.cfg.LaunchStdout != nil || h.cfg.LaunchStderr != nil {
+		cmd.Stdout = h.cfg.LaunchStdout
+		cmd.Stderr = h.cfg.LaunchStderr
+		// Output copying must not keep Wait blocked on pipes inherited by orphaned children.
+		cmd.WaitDelay = launchStopTimeout
+	}
 	setLaunchProcessGroup(cmd)
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("start launch command: %w", err)
@@ -167,57 +372,89 @@ func (h *Harness) startLaunchCommand(ctx context.Context) error {
 	return nil
 }
 
+func launchEnv(extra map[string]string) []string {
+	env := os.Environ()
+	if len(extra) == 0 {
+		return env
+	}
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+extra[key])
+	}
+	return env
+}
+
 func (h *Harness) stopLaunchCommand() error {
+	if h.launchProc != nil {
+		proc := h.launchProc
+		h.launchProc = nil
+		// The process is not our child, so there is nothing to wait on; an already exited one is fine.
+		if err := proc.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return err
+		}
+		_ = proc.Release()
+	}
 	if h.launchCmd == nil {
 		return nil
 	}
 	cmd := h.launchCmd
 	h.launchCmd = nil
 
+	// Whether the command has exited is learned from this channel alone: cmd.ProcessState
+	// is written by Wait and must not be read while it runs.
 	waitCh := make(chan error, 1)
 	go func() {
 		waitCh <- cmd.Wait()
 	}()
 
-	if cmd.Process != nil && cmd.ProcessState == nil {
-		_ = terminateProcessTree(cmd)
-		select {
-		case err := <-waitCh:
-			if err != nil {
-				var exitErr *exec.ExitError
-				if errors.As(err, &exitErr) {
-					// Expected when process group termination is initiated by harness cleanup.
-					return nil
-				}
-				return err
-			}
-			return nil
-		case <-time.After(launchStopTimeout):
-			_ = killProcessTree(cmd)
-		}
-	}
-
-	if err := <-waitCh; err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			// Expected when process group termination is initiated by harness cleanup.
-			return nil
-		}
-		return err
+	if cmd.Process == nil {
+		return launchWaitError(<-waitCh)
 	}
-	return nil
+	select {
+	case err := <-waitCh:
+		// Already reaped, so its pid may belong to someone else now; do not signal it.
+		return launchWaitError(err)
+	default:
+	}
+
+	_ = terminateProcessTree(cmd)
+	select {
+	case err := <-waitCh:
+		return launchWaitError(err)
+	case <-time.After(launchStopTimeout):
+		_ = killProcessTree(cmd)
+	}
+	return launchWaitError(<-waitCh)
 }
 
-func waitForDial(ctx context.Context, addr string, timeout time.Duration) (net.Conn, error) {
+func launchWaitError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// Expected when process group termination is initiated by harness cleanup.
+		return nil
+	}
+	return err
+}
+
+func waitForDial(ctx context.Context, addr string, timeout time.Duration, tlsConfig *tls.Config) (net.Conn, error) {
 	deadline := time.Now().Add(timeout)
 	for {
 		if ctx.Err() != nil {
 			return nil, ctx.Err()
 		}
-		conn, err := net.DialTimeout("tcp", addr, 300*time.Millisecond)
+		conn, err := dialOnce(addr, tlsConfig)
 		if err == nil {
 			return conn, nil
 		}
+		var certErr *tls.CertificateVerificationError
+		if errors.As(err, &certErr) {
+			// Certificate problems do not resolve by retrying; surface them immediately.
+			return nil, err
+		}
 		if time.Now().After(deadline) {
 			return nil, err
 		}
@@ -225,6 +462,41 @@ func waitForDial(ctx context.Context, addr string, timeout time.Duration) (net.C
 	}
 }
 
+func waitForAccept(ctx context.Context, ln net.Listener, timeout time.Duration) (net.Conn, error) {
+	type deadlineListener interface {
+		SetDeadline(time.Time) error
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if dl, ok := ln.(deadlineListener); ok {
+			_ = dl.SetDeadline(time.Now().Add(dialAttemptTimeout))
+		}
+		conn, err := ln.Accept()
+		if err == nil {
+			return conn, nil
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+	}
+}
+
+func dialOnce(addr string, tlsConfig *tls.Config) (net.Conn, error) {
+	if tlsConfig == nil {
+		return net.DialTimeout("tcp", addr, dialAttemptTimeout)
+	}
+	dialer := &net.Dialer{Timeout: dialAttemptTimeout}
+	return tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+}
+
 func openTranscript(dir, testName string) (*os.File, string, error) {
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, "", fmt.Errorf("create transcript dir: %w", err)
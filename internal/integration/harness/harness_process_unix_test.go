@@ -3,13 +3,16 @@
 package harness
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
@@ -44,6 +47,109 @@ func TestHarness_CloseTerminatesSpawnedBackgroundChild(t *testing.T) {
 	}
 }
 
+func TestHarness_LaunchSpecRunsWithoutShellAndCapturesOutput(t *testing.T) {
+	dir := t.TempDir()
+	var stdout, stderr lockedBuffer
+
+	h := New(Config{
+		Launch: &LaunchSpec{
+			Executable: "sh",
+			Args:       []string{"-c", `echo "$1|$GREETING|$(pwd)"; echo oops >&2`, "sh", "a b;$HOME"},
+			Env:        map[string]string{"GREETING": "hello"},
+			Dir:        dir,
+		},
+		LaunchStdout:  &stdout,
+		LaunchStderr:  &stderr,
+		TranscriptDir: t.TempDir(),
+	})
+	if err := h.startLaunchCommand(context.Background()); err != nil {
+		t.Fatalf("startLaunchCommand failed: %v", err)
+	}
+	if err := h.launchCmd.Wait(); err != nil {
+		t.Fatalf("launched process failed: %v", err)
+	}
+	h.launchCmd = nil
+
+	resolvedDir, _ := filepath.EvalSymlinks(dir)
+	if got, want := stdout.String(), "a b;$HOME|hello|"+resolvedDir+"\n"; got != want {
+		t.Fatalf("unexpected stdout: got %q, want %q", got, want)
+	}
+	if got := stderr.String(); got != "oops\n" {
+		t.Fatalf("unexpected stderr: %q", got)
+	}
+}
+
+func TestHarness_StartAutoRideAddrInListenModeHandsAddressToInterpreter(t *testing.T) {
+	initFile := filepath.Join(t.TempDir(), "ride_init")
+
+	interpreterErr := make(chan error, 1)
+	go func() {
+		// Play the role of Dyalog: read RIDE_INIT=CONNECT:<addr> and dial back.
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			data, err := os.ReadFile(initFile)
+			if err == nil && len(data) > 0 {
+				addr, ok := strings.CutPrefix(string(data), "CONNECT:")
+				if !ok {
+					interpreterErr <- fmt.Errorf("unexpected RIDE_INIT %q", data)
+					return
+				}
+				conn, err := net.Dial("tcp", addr)
+				if err != nil {
+					interpreterErr <- err
+					return
+				}
+				defer conn.Close()
+				interpreterErr <- runHandshake(conn)
+				return
+			}
+			if time.Now().After(deadline) {
+				interpreterErr <- fmt.Errorf("timed out waiting for RIDE_INIT: %v", err)
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	h := New(Config{
+		RideAddr: AutoRideAddr,
+		Listen:   true,
+		Launch: &LaunchSpec{
+			Executable: "sh",
+			Args:       []string{"-c", `printf %s "$RIDE_INIT" > "$1"; sleep 60`, "sh", initFile},
+		},
+		ConnectTimeout: 2 * time.Second,
+		TranscriptDir:  t.TempDir(),
+	})
+	if _, err := h.Start(context.Background(), t.Name()); err != nil {
+		t.Fatalf("Start with auto rideAddr failed: %v", err)
+	}
+	defer h.Close()
+	if err := <-interpreterErr; err != nil {
+		t.Fatalf("interpreter assertions failed: %v", err)
+	}
+	if strings.HasSuffix(h.RideAddr(), ":0") || !strings.HasPrefix(h.RideAddr(), "127.0.0.1:") {
+		t.Fatalf("unexpected resolved address %q", h.RideAddr())
+	}
+}
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
 func waitForChildPID(t *testing.T, pidFile string) int {
 	t.Helper()
 	deadline := time.Now().Add(2 * time.Second)
@@ -154,6 +154,72 @@ func TestHarness_StartInitializesSessionAndCapturesTranscript(t *testing.T) {
 	}
 }
 
+func TestHarness_StartListenAcceptsConnectingInterpreter(t *testing.T) {
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("probe listen failed: %v", err)
+	}
+	addr := probe.Addr().String()
+	_ = probe.Close()
+
+	interpreterErr := make(chan error, 1)
+	go func() {
+		// Play the role of an interpreter started with RIDE_INIT=CONNECT:<addr>.
+		var conn net.Conn
+		var err error
+		for i := 0; i < 40; i++ {
+			conn, err = net.Dial("tcp", addr)
+			if err == nil {
+				break
+			}
+			time.Sleep(25 * time.Millisecond)
+		}
+		if err != nil {
+			interpreterErr <- err
+			return
+		}
+		defer conn.Close()
+		interpreterErr <- runHandshake(conn)
+	}()
+
+	h := New(Config{
+		RideAddr:       addr,
+		Listen:         true,
+		ConnectTimeout: 2 * time.Second,
+		TranscriptDir:  t.TempDir(),
+	})
+	if _, err := h.Start(context.Background(), t.Name()); err != nil {
+		t.Fatalf("Start in listen mode failed: %v", err)
+	}
+	if err := <-interpreterErr; err != nil {
+		t.Fatalf("connecting interpreter assertions failed: %v", err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if conn, err := net.DialTimeout("tcp", addr, 200*time.Millisecond); err == nil {
+		_ = conn.Close()
+		t.Fatal("expected listener to be closed with the harness")
+	}
+}
+
+func TestHarness_StartListenTimesOutWithoutInterpreter(t *testing.T) {
+	h := New(Config{
+		RideAddr:       "127.0.0.1:0",
+		Listen:         true,
+		ConnectTimeout: 400 * time.Millisecond,
+		TranscriptDir:  t.TempDir(),
+	})
+	_, err := h.Start(context.Background(), t.Name())
+	if err == nil {
+		_ = h.Close()
+		t.Fatal("expected listen mode without a connecting interpreter to fail")
+	}
+	if !strings.Contains(err.Error(), "accept RIDE connection") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestHarness_ExecutePromptTransitionLifecycle(t *testing.T) {
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -732,6 +798,77 @@ func TestIntegration_SaveReplyCloseOrdering(t *testing.T) {
 	}
 }
 
+func TestHarness_ResolveAutoRideAddrPicksLoopbackPortForLaunch(t *testing.T) {
+	spec := &LaunchSpec{Executable: "dyalog", Env: map[string]string{"LOAD": "app"}}
+	h := New(Config{RideAddr: AutoRideAddr, Launch: spec, TranscriptDir: t.TempDir()})
+	if err := h.resolveAutoRideAddr(); err != nil {
+		t.Fatalf("resolveAutoRideAddr failed: %v", err)
+	}
+
+	host, port, err := net.SplitHostPort(h.RideAddr())
+	if err != nil || host != "127.0.0.1" || port == "0" {
+		t.Fatalf("unexpected resolved address %q (%v)", h.RideAddr(), err)
+	}
+	if got := h.cfg.Launch.Env["RIDE_INIT"]; got != "SERVE:"+h.RideAddr() {
+		t.Fatalf("unexpected RIDE_INIT %q", got)
+	}
+	if h.cfg.Launch.Env["LOAD"] != "app" {
+		t.Fatalf("expected launch env to be preserved, got %#v", h.cfg.Launch.Env)
+	}
+	if _, ok := spec.Env["RIDE_INIT"]; ok {
+		t.Fatal("expected caller launch spec to stay unmodified")
+	}
+	// The port is released so the interpreter can serve on it.
+	ln, err := net.Listen("tcp", h.RideAddr())
+	if err != nil {
+		t.Fatalf("expected resolved port to be free: %v", err)
+	}
+	_ = ln.Close()
+}
+
+func TestHarness_StartAutoRideAddrRequiresLaunch(t *testing.T) {
+	h := New(Config{RideAddr: AutoRideAddr, TranscriptDir: t.TempDir()})
+	if _, err := h.Start(context.Background(), t.Name()); err == nil {
+		_ = h.Close()
+		t.Fatal("expected rideAddr auto without a launch spec to fail")
+	}
+}
+
+func TestHarness_LaunchRunnerReplacesDirectExec(t *testing.T) {
+	var got []LaunchSpec
+	h := New(Config{
+		Launch: &LaunchSpec{Executable: "does-not-exist-dyalog", Args: []string{"+s", "-q"}},
+		LaunchRunner: func(_ context.Context, spec LaunchSpec) (*os.Process, error) {
+			got = append(got, spec)
+			return nil, nil
+		},
+		TranscriptDir: t.TempDir(),
+	})
+	if err := h.startLaunchCommand(context.Background()); err != nil {
+		t.Fatalf("startLaunchCommand failed: %v", err)
+	}
+	if len(got) != 1 || got[0].Executable != "does-not-exist-dyalog" {
+		t.Fatalf("unexpected runner calls: %#v", got)
+	}
+	if h.launchCmd != nil {
+		t.Fatal("expected no directly executed launch command")
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	failing := New(Config{
+		Launch: &LaunchSpec{Executable: "dyalog"},
+		LaunchRunner: func(context.Context, LaunchSpec) (*os.Process, error) {
+			return nil, errors.New("runInTerminal failed: denied")
+		},
+		TranscriptDir: t.TempDir(),
+	})
+	if err := failing.startLaunchCommand(context.Background()); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Fatalf("expected runner error, got %v", err)
+	}
+}
+
 func runHandshake(conn net.Conn) error {
 	if err := writeFrame(conn, "SupportedProtocols=2"); err != nil {
 		return err
@@ -0,0 +1,155 @@
+package harness
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHarness_StartDialsRideOverTLS(t *testing.T) {
+	certPEM, serverCert := newSelfSignedCert(t)
+	caFile := filepath.Join(t.TempDir(), "ride-ca.pem")
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatalf("write CA file failed: %v", err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}})
+	if err != nil {
+		t.Fatalf("tls listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		serverErr <- runHandshake(conn)
+	}()
+
+	h := New(Config{
+		RideAddr:       ln.Addr().String(),
+		ConnectTimeout: 2 * time.Second,
+		TranscriptDir:  t.TempDir(),
+		TLS: TLSConfig{
+			Enabled: true,
+			CAFile:  caFile,
+		},
+	})
+	if _, err := h.Start(context.Background(), t.Name()); err != nil {
+		t.Fatalf("Start over TLS failed: %v", err)
+	}
+	defer h.Close()
+
+	if err := <-serverErr; err != nil {
+		t.Fatalf("fake TLS server assertions failed: %v", err)
+	}
+}
+
+func TestHarness_StartRejectsUntrustedTLSCertificateWithoutRetrying(t *testing.T) {
+	_, serverCert := newSelfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}})
+	if err != nil {
+		t.Fatalf("tls listen failed: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				_ = c.(*tls.Conn).Handshake()
+				_ = c.Close()
+			}(conn)
+		}
+	}()
+
+	h := New(Config{
+		RideAddr:       ln.Addr().String(),
+		ConnectTimeout: 5 * time.Second,
+		TranscriptDir:  t.TempDir(),
+		TLS:            TLSConfig{Enabled: true},
+	})
+	started := time.Now()
+	_, err = h.Start(context.Background(), t.Name())
+	if err == nil {
+		_ = h.Close()
+		t.Fatal("expected untrusted certificate to fail")
+	}
+	if !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("expected certificate verification error, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("expected certificate failure to skip dial retries, took %s", elapsed)
+	}
+}
+
+func TestTLSConfig_ClientConfigDefaultsServerNameToHost(t *testing.T) {
+	cfg, err := TLSConfig{Enabled: true}.ClientConfig("ride.example.com:4502")
+	if err != nil {
+		t.Fatalf("ClientConfig failed: %v", err)
+	}
+	if cfg.ServerName != "ride.example.com" {
+		t.Fatalf("expected server name from address host, got %q", cfg.ServerName)
+	}
+
+	disabled, err := TLSConfig{}.ClientConfig("ride.example.com:4502")
+	if err != nil || disabled != nil {
+		t.Fatalf("expected nil config when TLS disabled, got %#v (%v)", disabled, err)
+	}
+
+	if _, err := (TLSConfig{Enabled: true, CertFile: "client.pem"}).ClientConfig("127.0.0.1:4502"); err == nil {
+		t.Fatal("expected cert without key to fail")
+	}
+}
+
+func newSelfSignedCert(t *testing.T) ([]byte, tls.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ride-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate failed: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key failed: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("load key pair failed: %v", err)
+	}
+	return certPEM, cert
+}
@@ -23,6 +23,9 @@ type DecodedPayload struct {
 	Command string
 	Args    any
 	Known   bool
+	// Invalid reports schema violations in a known command's arguments.
+	// Args are still decoded leniently so that one odd field does not drop the message.
+	Invalid error
 }
 
 // ExecuteArgs is the typed argument model for Execute.
@@ -32,9 +35,22 @@ type ExecuteArgs struct {
 }
 
 // IdentifyArgs is the typed argument model for Identify.
+// The client sends only APIVersion and Identity; the interpreter's reply also
+// describes itself and the session.
 type IdentifyArgs struct {
-	APIVersion int `json:"apiVersion"`
-	Identity   int `json:"identity"`
+	APIVersion int    `json:"apiVersion"`
+	Identity   int    `json:"identity"`
+	Version    string `json:"version,omitempty"`
+	Platform   string `json:"platform,omitempty"`
+	Arch       string `json:"arch,omitempty"`
+	PID        int    `json:"pid,omitempty"`
+	Project    string `json:"Project,omitempty"`
+	Vendor     string `json:"Vendor,omitempty"`
+	Language   string `json:"Language,omitempty"`
+	Machine    string `json:"Machine,omitempty"`
+	Process    string `json:"Process,omitempty"`
+	User       string `json:"User,omitempty"`
+	Date       string `json:"date,omitempty"`
 }
 
 // ConnectArgs is the typed argument model for Connect.
@@ -196,110 +212,123 @@ type SetSessionLineGroupArgs struct {
 	Group      int `json:"group"`
 }
 
+// GetAutocompleteArgs models GetAutocomplete.
+type GetAutocompleteArgs struct {
+	Line  string `json:"line"`
+	Pos   int    `json:"pos"`
+	Token int    `json:"token"`
+	Win   int    `json:"win"`
+}
+
+// ReplyGetAutocompleteArgs models ReplyGetAutocomplete.
+type ReplyGetAutocompleteArgs struct {
+	Options []string `json:"options"`
+	Skip    int      `json:"skip"`
+	Token   int      `json:"token"`
+}
+
 // EmptyArgs represents commands with empty argument objects.
 type EmptyArgs struct{}
 
 // Codec handles encoding and decoding RIDE protocol messages.
+// A command is known when it appears in the embedded RIDE schema.
 type Codec struct {
-	knownCommands map[string]struct{}
-	decoders      map[string]func(args map[string]any) any
+	schema   map[string]CommandSpec
+	decoders map[string]func(args map[string]any) any
 }
 
 // NewCodec creates a message codec.
 func NewCodec() *Codec {
-	knownCommands := map[string]struct{}{
-		"Identify":              {},
-		"Connect":               {},
-		"GetWindowLayout":       {},
-		"Execute":               {},
-		"SetPromptType":         {},
-		"AppendSessionOutput":   {},
-		"OpenWindow":            {},
-		"UpdateWindow":          {},
-		"CloseWindow":           {},
-		"SetLineAttributes":     {},
-		"SetHighlightLine":      {},
-		"StepInto":              {},
-		"RunCurrentLine":        {},
-		"ContinueTrace":         {},
-		"Continue":              {},
-		"TraceBackward":         {},
-		"TraceForward":          {},
-		"RestartThreads":        {},
-		"WeakInterrupt":         {},
-		"StrongInterrupt":       {},
-		"GetThreads":            {},
-		"ReplyGetThreads":       {},
-		"SetThread":             {},
-		"GetSIStack":            {},
-		"ReplyGetSIStack":       {},
-		"SaveChanges":           {},
-		"ReplySaveChanges":      {},
-		"HadError":              {},
-		"Disconnect":            {},
-		"SysError":              {},
-		"UnknownCommand":        {},
-		"InternalError":         {},
-		"SetSIStack":            {},
-		"ExitMultilineInput":    {},
-		"SetSessionLineGroup":   {},
-		"WindowTypeChanged":     {},
-		"GetAutocomplete":       {},
-		"ReplyGetAutocomplete":  {},
-		"GetValueTip":           {},
-		"ValueTip":              {},
-		"GetConfiguration":      {},
-		"ReplyGetConfiguration": {},
-	}
-
 	return &Codec{
-		knownCommands: knownCommands,
+		schema: commandSchema,
 		decoders: map[string]func(args map[string]any) any{
-			"Identify":            decodeIdentifyArgs,
-			"Connect":             decodeConnectArgs,
-			"GetWindowLayout":     decodeEmptyArgs,
-			"Execute":             decodeExecuteArgs,
-			"SetPromptType":       decodeSetPromptTypeArgs,
-			"AppendSessionOutput": decodeAppendSessionOutputArgs,
-			"OpenWindow":          decodeWindowContentArgs,
-			"UpdateWindow":        decodeWindowContentArgs,
-			"CloseWindow":         decodeWindowArgs,
-			"SetLineAttributes":   decodeSetLineAttributesArgs,
-			"SetHighlightLine":    decodeSetHighlightLineArgs,
-			"StepInto":            decodeWindowArgs,
-			"RunCurrentLine":      decodeWindowArgs,
-			"ContinueTrace":       decodeWindowArgs,
-			"Continue":            decodeWindowArgs,
-			"TraceBackward":       decodeWindowArgs,
-			"TraceForward":        decodeWindowArgs,
-			"RestartThreads":      decodeEmptyArgs,
-			"WeakInterrupt":       decodeEmptyArgs,
-			"StrongInterrupt":     decodeEmptyArgs,
-			"GetThreads":          decodeGetThreadsArgs,
-			"ReplyGetThreads":     decodeReplyGetThreadsArgs,
-			"SetThread":           decodeSetThreadArgs,
-			"GetSIStack":          decodeGetSIStackArgs,
-			"ReplyGetSIStack":     decodeReplyGetSIStackArgs,
-			"SaveChanges":         decodeSaveChangesArgs,
-			"ReplySaveChanges":    decodeReplySaveChangesArgs,
-			"HadError":            decodeHadErrorArgs,
-			"Disconnect":          decodeDisconnectArgs,
-			"SysError":            decodeSysErrorArgs,
-			"UnknownCommand":      decodeUnknownCommandArgs,
-			"InternalError":       decodeInternalErrorArgs,
-			"SetSIStack":          decodeSetSIStackArgs,
-			"ExitMultilineInput":  decodeExitMultilineInputArgs,
-			"SetSessionLineGroup": decodeSetSessionLineGroupArgs,
-			"WindowTypeChanged":   decodeWindowTypeChangedArgs,
+			"Identify":                   decodeIdentifyArgs,
+			"Connect":                    decodeConnectArgs,
+			"GetWindowLayout":            decodeEmptyArgs,
+			"Execute":                    decodeExecuteArgs,
+			"SetPromptType":              decodeSetPromptTypeArgs,
+			"AppendSessionOutput":        decodeAppendSessionOutputArgs,
+			"OpenWindow":                 decodeWindowContentArgs,
+			"UpdateWindow":               decodeWindowContentArgs,
+			"CloseWindow":                decodeWindowArgs,
+			"SetLineAttributes":          decodeSetLineAttributesArgs,
+			"SetHighlightLine":           decodeSetHighlightLineArgs,
+			"StepInto":                   decodeWindowArgs,
+			"RunCurrentLine":             decodeWindowArgs,
+			"ContinueTrace":              decodeWindowArgs,
+			"Continue":                   decodeWindowArgs,
+			"TraceBackward":              decodeWindowArgs,
+			"TraceForward":               decodeWindowArgs,
+			"RestartThreads":             decodeEmptyArgs,
+			"WeakInterrupt":              decodeEmptyArgs,
+			"StrongInterrupt":            decodeEmptyArgs,
+			"GetThreads":                 decodeGetThreadsArgs,
+			"ReplyGetThreads":            decodeReplyGetThreadsArgs,
+			"SetThread":                  decodeSetThreadArgs,
+			"GetSIStack":                 decodeGetSIStackArgs,
+			"ReplyGetSIStack":            decodeReplyGetSIStackArgs,
+			"SaveChanges":                decodeSaveChangesArgs,
+			"ReplySaveChanges":           decodeReplySaveChangesArgs,
+			"HadError":                   decodeHadErrorArgs,
+			"Disconnect":                 decodeDisconnectArgs,
+			"SysError":                   decodeSysErrorArgs,
+			"UnknownCommand":             decodeUnknownCommandArgs,
+			"InternalError":              decodeInternalErrorArgs,
+			"SetSIStack":                 decodeSetSIStackArgs,
+			"ExitMultilineInput":         decodeExitMultilineInputArgs,
+			"SetSessionLineGroup":        decodeSetSessionLineGroupArgs,
+			"WindowTypeChanged":          decodeWindowTypeChangedArgs,
+			"GetAutocomplete":            decodeGetAutocompleteArgs,
+			"ReplyGetAutocomplete":       decodeReplyGetAutocompleteArgs,
+			"GetValueTip":                decodeGetValueTipArgs,
+			"ValueTip":                   decodeValueTipArgs,
+			"GetConfiguration":           decodeGetConfigurationArgs,
+			"ReplyGetConfiguration":      decodeReplyGetConfigurationArgs,
+			"SetConfiguration":           decodeSetConfigurationArgs,
+			"Subscribe":                  decodeSubscribeArgs,
+			"EchoInput":                  decodeEchoInputArgs,
+			"CanAcceptInput":             decodeCanAcceptInputArgs,
+			"SetPW":                      decodeSetPWArgs,
+			"UpdateSessionCaption":       decodeUpdateSessionCaptionArgs,
+			"UpdateDisplayName":          decodeUpdateDisplayNameArgs,
+			"StatusOutput":               decodeStatusOutputArgs,
+			"NotificationMessage":        decodeNotificationMessageArgs,
+			"ShowHTML":                   decodeShowHTMLArgs,
+			"Exit":                       decodeExitArgs,
+			"Edit":                       decodeEditArgs,
+			"GotoWindow":                 decodeWindowArgs,
+			"FormatCode":                 decodeFormatCodeArgs,
+			"ReplyFormatCode":            decodeReplyFormatCodeArgs,
+			"Cutback":                    decodeWindowArgs,
+			"ClearTraceStopMonitor":      decodeClearTraceStopMonitorArgs,
+			"ReplyClearTraceStopMonitor": decodeReplyClearTraceStopMonitorArgs,
+			"GetHelpInformation":         decodeGetHelpInformationArgs,
+			"ReplyGetHelpInformation":    decodeReplyGetHelpInformationArgs,
+			"GetLanguageBar":             decodeEmptyArgs,
+			"ReplyGetLanguageBar":        decodeReplyGetLanguageBarArgs,
+			"TreeList":                   decodeTreeListArgs,
+			"ReplyTreeList":              decodeReplyTreeListArgs,
+			"OptionsDialog":              decodeOptionsDialogArgs,
+			"ReplyOptionsDialog":         decodeReplyOptionsDialogArgs,
+			"StringDialog":               decodeStringDialogArgs,
+			"ReplyStringDialog":          decodeReplyStringDialogArgs,
+			"TaskDialog":                 decodeTaskDialogArgs,
+			"ReplyTaskDialog":            decodeReplyTaskDialogArgs,
 		},
 	}
 }
 
 // EncodeCommand marshals a command payload as ["Command",{...}].
+// Args is normally the typed model for the command (ExecuteArgs, WindowArgs, ...); a
+// map is accepted for commands without one. Arguments of known commands are validated
+// against the schema first.
 func (c *Codec) EncodeCommand(command string, args any) (string, error) {
 	if args == nil {
 		args = map[string]any{}
 	}
+	if err := c.Validate(command, args); err != nil {
+		return "", err
+	}
 	payload, err := json.Marshal([]any{command, args})
 	if err != nil {
 		return "", err
@@ -329,9 +358,11 @@ func (c *Codec) DecodePayload(payload string) (DecodedPayload, error) {
 		return DecodedPayload{Kind: KindRaw, Raw: payload}, nil
 	}
 
-	_, known := c.knownCommands[command]
+	spec, known := c.schema[command]
 	decodedArgs := any(argsMap)
+	var invalid error
 	if known {
+		invalid = spec.validate(command, argsMap)
 		if decoder, ok := c.decoders[command]; ok {
 			decodedArgs = decoder(argsMap)
 		}
@@ -342,6 +373,7 @@ func (c *Codec) DecodePayload(payload string) (DecodedPayload, error) {
 		Command: command,
 		Args:    decodedArgs,
 		Known:   known,
+		Invalid: invalid,
 	}, nil
 }
 
@@ -353,6 +385,17 @@ func decodeIdentifyArgs(args map[string]any) any {
 	return IdentifyArgs{
 		APIVersion: getInt(args, "apiVersion"),
 		Identity:   getInt(args, "identity"),
+		Version:    getString(args, "version"),
+		Platform:   getString(args, "platform"),
+		Arch:       getString(args, "arch"),
+		PID:        getInt(args, "pid"),
+		Project:    getString(args, "Project"),
+		Vendor:     getString(args, "Vendor"),
+		Language:   getString(args, "Language"),
+		Machine:    getString(args, "Machine"),
+		Process:    getString(args, "Process"),
+		User:       getString(args, "User"),
+		Date:       getString(args, "date"),
 	}
 }
 
@@ -431,6 +474,23 @@ func decodeWindowTypeChangedArgs(args map[string]any) any {
 	}
 }
 
+func decodeGetAutocompleteArgs(args map[string]any) any {
+	return GetAutocompleteArgs{
+		Line:  getString(args, "line"),
+		Pos:   getInt(args, "pos"),
+		Token: getInt(args, "token"),
+		Win:   getInt(args, "win"),
+	}
+}
+
+func decodeReplyGetAutocompleteArgs(args map[string]any) any {
+	return ReplyGetAutocompleteArgs{
+		Options: getStringSlice(args, "options"),
+		Skip:    getInt(args, "skip"),
+		Token:   getInt(args, "token"),
+	}
+}
+
 func decodeSaveChangesArgs(args map[string]any) any {
 	return SaveChangesArgs{
 		Win:     getInt(args, "win"),
@@ -201,6 +201,91 @@ func TestDecodePayload_UndocumentedCommandSubset_DecodesTypedArgs(t *testing.T)
 			t.Fatalf("unexpected decoded args: %#v", args)
 		}
 	})
+
+	t.Run("ReplyGetAutocomplete", func(t *testing.T) {
+		decoded, err := codec.DecodePayload(`["ReplyGetAutocomplete",{"options":["⎕IO","⎕ML"],"skip":2,"token":7}]`)
+		if err != nil {
+			t.Fatalf("DecodePayload failed: %v", err)
+		}
+		args, ok := decoded.Args.(ReplyGetAutocompleteArgs)
+		if !ok {
+			t.Fatalf("expected ReplyGetAutocompleteArgs, got %T", decoded.Args)
+		}
+		if len(args.Options) != 2 || args.Options[1] != "⎕ML" || args.Skip != 2 || args.Token != 7 {
+			t.Fatalf("unexpected decoded args: %#v", args)
+		}
+	})
+}
+
+func TestDecodePayload_EditorDialogAndConfigurationCommands_DecodeTypedArgs(t *testing.T) {
+	codec := NewCodec()
+
+	t.Run("ValueTip", func(t *testing.T) {
+		decoded, err := codec.DecodePayload(`["ValueTip",{"tip":["1 2 3"],"class":2,"startCol":0,"endCol":1,"token":9}]`)
+		if err != nil {
+			t.Fatalf("DecodePayload failed: %v", err)
+		}
+		args, ok := decoded.Args.(ValueTipArgs)
+		if !ok {
+			t.Fatalf("expected ValueTipArgs, got %T", decoded.Args)
+		}
+		if len(args.Tip) != 1 || args.Tip[0] != "1 2 3" || args.Class != 2 || args.EndCol != 1 || args.Token != 9 {
+			t.Fatalf("unexpected decoded args: %#v", args)
+		}
+	})
+
+	t.Run("Edit", func(t *testing.T) {
+		decoded, err := codec.DecodePayload(`["Edit",{"win":0,"text":"Foo","pos":3,"unsaved":{"4":"x"}}]`)
+		if err != nil {
+			t.Fatalf("DecodePayload failed: %v", err)
+		}
+		args, ok := decoded.Args.(EditArgs)
+		if !ok {
+			t.Fatalf("expected EditArgs, got %T", decoded.Args)
+		}
+		if args.Text != "Foo" || args.Pos != 3 || args.Unsaved["4"] != "x" {
+			t.Fatalf("unexpected decoded args: %#v", args)
+		}
+	})
+
+	t.Run("TaskDialog", func(t *testing.T) {
+		decoded, err := codec.DecodePayload(`["TaskDialog",{"title":"Link","text":"Overwrite?","buttonText":["Yes","No"],"options":[],"token":4}]`)
+		if err != nil {
+			t.Fatalf("DecodePayload failed: %v", err)
+		}
+		args, ok := decoded.Args.(TaskDialogArgs)
+		if !ok {
+			t.Fatalf("expected TaskDialogArgs, got %T", decoded.Args)
+		}
+		if args.Title != "Link" || len(args.ButtonText) != 2 || args.ButtonText[1] != "No" || args.Token != 4 {
+			t.Fatalf("unexpected decoded args: %#v", args)
+		}
+	})
+
+	t.Run("ReplyGetConfiguration", func(t *testing.T) {
+		decoded, err := codec.DecodePayload(`["ReplyGetConfiguration",{"configurations":[{"name":"AUTO_PW","value":"1"}]}]`)
+		if err != nil {
+			t.Fatalf("DecodePayload failed: %v", err)
+		}
+		args, ok := decoded.Args.(ReplyGetConfigurationArgs)
+		if !ok {
+			t.Fatalf("expected ReplyGetConfigurationArgs, got %T", decoded.Args)
+		}
+		if len(args.Configurations) != 1 || args.Configurations[0] != (ConfigurationEntry{Name: "AUTO_PW", Value: "1"}) {
+			t.Fatalf("unexpected decoded args: %#v", args)
+		}
+	})
+
+	t.Run("CanAcceptInput", func(t *testing.T) {
+		decoded, err := codec.DecodePayload(`["CanAcceptInput",{"canAcceptInput":1}]`)
+		if err != nil {
+			t.Fatalf("DecodePayload failed: %v", err)
+		}
+		args, ok := decoded.Args.(CanAcceptInputArgs)
+		if !ok || !args.CanAcceptInput {
+			t.Fatalf("expected CanAcceptInput=true, got %#v", decoded.Args)
+		}
+	})
 }
 
 func TestDecodePayload_NonJSONIsRaw(t *testing.T) {
@@ -0,0 +1,445 @@
+package protocol
+
+// EditArgs models Edit, which asks the interpreter to open an editor for the
+// name under Pos in Text.
+type EditArgs struct {
+	Win     int            `json:"win"`
+	Text    string         `json:"text"`
+	Pos     int            `json:"pos"`
+	Unsaved map[string]any `json:"unsaved,omitempty"`
+}
+
+// FormatCodeArgs models FormatCode.
+type FormatCodeArgs struct {
+	Win  int      `json:"win"`
+	Text []string `json:"text"`
+}
+
+// ReplyFormatCodeArgs models ReplyFormatCode.
+type ReplyFormatCodeArgs struct {
+	Win  int      `json:"win"`
+	Text []string `json:"text"`
+}
+
+// GetValueTipArgs models GetValueTip.
+type GetValueTipArgs struct {
+	Win       int    `json:"win"`
+	Line      string `json:"line"`
+	Pos       int    `json:"pos"`
+	Token     int    `json:"token"`
+	MaxWidth  int    `json:"maxWidth"`
+	MaxHeight int    `json:"maxHeight"`
+}
+
+// ValueTipArgs models ValueTip.
+type ValueTipArgs struct {
+	Tip      []string `json:"tip"`
+	Class    int      `json:"class"`
+	StartCol int      `json:"startCol"`
+	EndCol   int      `json:"endCol"`
+	Token    int      `json:"token"`
+}
+
+// GetHelpInformationArgs models GetHelpInformation.
+type GetHelpInformationArgs struct {
+	Line string `json:"line"`
+	Pos  int    `json:"pos"`
+}
+
+// ReplyGetHelpInformationArgs models ReplyGetHelpInformation.
+type ReplyGetHelpInformationArgs struct {
+	URL string `json:"url"`
+}
+
+// LanguageBarEntry models one entry in ReplyGetLanguageBar.
+type LanguageBarEntry struct {
+	Name     string   `json:"name"`
+	AvChar   string   `json:"avchar"`
+	HelpText []string `json:"helptext"`
+}
+
+// ReplyGetLanguageBarArgs models ReplyGetLanguageBar.
+type ReplyGetLanguageBarArgs struct {
+	Entries []LanguageBarEntry `json:"entries"`
+}
+
+// TreeListArgs models TreeList.
+type TreeListArgs struct {
+	NodeID int `json:"nodeId"`
+}
+
+// ReplyTreeListArgs models ReplyTreeList.
+type ReplyTreeListArgs struct {
+	NodeID  int      `json:"nodeId"`
+	Nodes   []int    `json:"nodes"`
+	Names   []string `json:"names"`
+	Classes []int    `json:"classes"`
+	Err     string   `json:"err"`
+}
+
+// ConfigurationEntry models one name/value pair in configuration commands.
+type ConfigurationEntry struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// GetConfigurationArgs models GetConfiguration.
+type GetConfigurationArgs struct {
+	Names []string `json:"names"`
+}
+
+// ReplyGetConfigurationArgs models ReplyGetConfiguration.
+type ReplyGetConfigurationArgs struct {
+	Configurations []ConfigurationEntry `json:"configurations"`
+}
+
+// SetConfigurationArgs models SetConfiguration.
+type SetConfigurationArgs struct {
+	Configurations []ConfigurationEntry `json:"configurations"`
+}
+
+// ClearTraceStopMonitorArgs models ClearTraceStopMonitor.
+type ClearTraceStopMonitorArgs struct {
+	Token int `json:"token"`
+}
+
+// ReplyClearTraceStopMonitorArgs models ReplyClearTraceStopMonitor.
+type ReplyClearTraceStopMonitorArgs struct {
+	Token    int `json:"token"`
+	Traces   int `json:"traces"`
+	Stops    int `json:"stops"`
+	Monitors int `json:"monitors"`
+}
+
+// EchoInputArgs models EchoInput.
+type EchoInputArgs struct {
+	Input string `json:"input"`
+}
+
+// CanAcceptInputArgs models CanAcceptInput.
+type CanAcceptInputArgs struct {
+	CanAcceptInput bool `json:"canAcceptInput"`
+}
+
+// SetPWArgs models SetPW (the session print width).
+type SetPWArgs struct {
+	PW int `json:"pw"`
+}
+
+// UpdateSessionCaptionArgs models UpdateSessionCaption.
+type UpdateSessionCaptionArgs struct {
+	Text string `json:"text"`
+}
+
+// UpdateDisplayNameArgs models UpdateDisplayName.
+type UpdateDisplayNameArgs struct {
+	DisplayName string `json:"displayName"`
+}
+
+// StatusOutputArgs models StatusOutput.
+type StatusOutputArgs struct {
+	Text  string `json:"text"`
+	Flags int    `json:"flags"`
+}
+
+// NotificationMessageArgs models NotificationMessage.
+type NotificationMessageArgs struct {
+	Message string `json:"message"`
+}
+
+// ShowHTMLArgs models ShowHTML.
+type ShowHTMLArgs struct {
+	Title string `json:"title"`
+	HTML  string `json:"html"`
+}
+
+// ExitArgs models Exit.
+type ExitArgs struct {
+	Code int `json:"code"`
+}
+
+// SubscribeArgs models Subscribe.
+type SubscribeArgs struct {
+	Status    []string `json:"status"`
+	Heartbeat bool     `json:"heartbeat"`
+}
+
+// OptionsDialogArgs models OptionsDialog.
+type OptionsDialogArgs struct {
+	Title   string   `json:"title"`
+	Text    string   `json:"text"`
+	Type    int      `json:"type"`
+	Options []string `json:"options"`
+	Token   int      `json:"token"`
+}
+
+// ReplyOptionsDialogArgs models ReplyOptionsDialog; Index -1 cancels the dialog.
+type ReplyOptionsDialogArgs struct {
+	Index int `json:"index"`
+	Token int `json:"token"`
+}
+
+// StringDialogArgs models StringDialog.
+type StringDialogArgs struct {
+	Title        string `json:"title"`
+	Text         string `json:"text"`
+	InitialValue string `json:"initialValue"`
+	DefaultValue string `json:"defaultValue"`
+	Token        int    `json:"token"`
+}
+
+// ReplyStringDialogArgs models ReplyStringDialog.
+type ReplyStringDialogArgs struct {
+	Value string `json:"value"`
+	Token int    `json:"token"`
+}
+
+// TaskDialogArgs models TaskDialog.
+type TaskDialogArgs struct {
+	Title      string   `json:"title"`
+	Text       string   `json:"text"`
+	Subtext    string   `json:"subtext"`
+	ButtonText []string `json:"buttonText"`
+	Options    []string `json:"options"`
+	Footer     string   `json:"footer"`
+	Token      int      `json:"token"`
+}
+
+// ReplyTaskDialogArgs models ReplyTaskDialog; Index is 100+n for buttonText[n],
+// n for options[n] and -1 when the dialog is cancelled.
+type ReplyTaskDialogArgs struct {
+	Index int `json:"index"`
+	Token int `json:"token"`
+}
+
+func decodeEditArgs(args map[string]any) any {
+	unsaved, _ := args["unsaved"].(map[string]any)
+	return EditArgs{
+		Win:     getInt(args, "win"),
+		Text:    getString(args, "text"),
+		Pos:     getInt(args, "pos"),
+		Unsaved: unsaved,
+	}
+}
+
+func decodeFormatCodeArgs(args map[string]any) any {
+	return FormatCodeArgs{
+		Win:  getInt(args, "win"),
+		Text: getStringSlice(args, "text"),
+	}
+}
+
+func decodeReplyFormatCodeArgs(args map[string]any) any {
+	return ReplyFormatCodeArgs{
+		Win:  getInt(args, "win"),
+		Text: getStringSlice(args, "text"),
+	}
+}
+
+func decodeGetValueTipArgs(args map[string]any) any {
+	return GetValueTipArgs{
+		Win:       getInt(args, "win"),
+		Line:      getString(args, "line"),
+		Pos:       getInt(args, "pos"),
+		Token:     getInt(args, "token"),
+		MaxWidth:  getInt(args, "maxWidth"),
+		MaxHeight: getInt(args, "maxHeight"),
+	}
+}
+
+func decodeValueTipArgs(args map[string]any) any {
+	return ValueTipArgs{
+		Tip:      getStringSlice(args, "tip"),
+		Class:    getInt(args, "class"),
+		StartCol: getInt(args, "startCol"),
+		EndCol:   getInt(args, "endCol"),
+		Token:    getInt(args, "token"),
+	}
+}
+
+func decodeGetHelpInformationArgs(args map[string]any) any {
+	return GetHelpInformationArgs{
+		Line: getString(args, "line"),
+		Pos:  getInt(args, "pos"),
+	}
+}
+
+func decodeReplyGetHelpInformationArgs(args map[string]any) any {
+	return ReplyGetHelpInformationArgs{URL: getString(args, "url")}
+}
+
+func decodeReplyGetLanguageBarArgs(args map[string]any) any {
+	entriesRaw := getSlice(args, "entries")
+	entries := make([]LanguageBarEntry, 0, len(entriesRaw))
+	for _, item := range entriesRaw {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		entries = append(entries, LanguageBarEntry{
+			Name:     getString(m, "name"),
+			AvChar:   getString(m, "avchar"),
+			HelpText: getStringSlice(m, "helptext"),
+		})
+	}
+	return ReplyGetLanguageBarArgs{Entries: entries}
+}
+
+func decodeTreeListArgs(args map[string]any) any {
+	return TreeListArgs{NodeID: getInt(args, "nodeId")}
+}
+
+func decodeReplyTreeListArgs(args map[string]any) any {
+	return ReplyTreeListArgs{
+		NodeID:  getInt(args, "nodeId"),
+		Nodes:   getIntSlice(args, "nodes"),
+		Names:   getStringSlice(args, "names"),
+		Classes: getIntSlice(args, "classes"),
+		Err:     getString(args, "err"),
+	}
+}
+
+func decodeGetConfigurationArgs(args map[string]any) any {
+	return GetConfigurationArgs{Names: getStringSlice(args, "names")}
+}
+
+func decodeReplyGetConfigurationArgs(args map[string]any) any {
+	return ReplyGetConfigurationArgs{Configurations: getConfigurationEntries(args)}
+}
+
+func decodeSetConfigurationArgs(args map[string]any) any {
+	return SetConfigurationArgs{Configurations: getConfigurationEntries(args)}
+}
+
+func getConfigurationEntries(args map[string]any) []ConfigurationEntry {
+	raw := getSlice(args, "configurations")
+	entries := make([]ConfigurationEntry, 0, len(raw))
+	for _, item := range raw {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		entries = append(entries, ConfigurationEntry{
+			Name:  getString(m, "name"),
+			Value: getString(m, "value"),
+		})
+	}
+	return entries
+}
+
+func decodeClearTraceStopMonitorArgs(args map[string]any) any {
+	return ClearTraceStopMonitorArgs{Token: getInt(args, "token")}
+}
+
+func decodeReplyClearTraceStopMonitorArgs(args map[string]any) any {
+	return ReplyClearTraceStopMonitorArgs{
+		Token:    getInt(args, "token"),
+		Traces:   getInt(args, "traces"),
+		Stops:    getInt(args, "stops"),
+		Monitors: getInt(args, "monitors"),
+	}
+}
+
+func decodeEchoInputArgs(args map[string]any) any {
+	return EchoInputArgs{Input: getString(args, "input")}
+}
+
+func decodeCanAcceptInputArgs(args map[string]any) any {
+	canAcceptInput, _ := NormalizeBool(args["canAcceptInput"])
+	return CanAcceptInputArgs{CanAcceptInput: canAcceptInput}
+}
+
+func decodeSetPWArgs(args map[string]any) any {
+	return SetPWArgs{PW: getInt(args, "pw")}
+}
+
+func decodeUpdateSessionCaptionArgs(args map[string]any) any {
+	return UpdateSessionCaptionArgs{Text: getString(args, "text")}
+}
+
+func decodeUpdateDisplayNameArgs(args map[string]any) any {
+	return UpdateDisplayNameArgs{DisplayName: getString(args, "displayName")}
+}
+
+func decodeStatusOutputArgs(args map[string]any) any {
+	return StatusOutputArgs{
+		Text:  getString(args, "text"),
+		Flags: getInt(args, "flags"),
+	}
+}
+
+func decodeNotificationMessageArgs(args map[string]any) any {
+	return NotificationMessageArgs{Message: getString(args, "message")}
+}
+
+func decodeShowHTMLArgs(args map[string]any) any {
+	return ShowHTMLArgs{
+		Title: getString(args, "title"),
+		HTML:  getString(args, "html"),
+	}
+}
+
+func decodeExitArgs(args map[string]any) any {
+	return ExitArgs{Code: getInt(args, "code")}
+}
+
+func decodeSubscribeArgs(args map[string]any) any {
+	heartbeat, _ := NormalizeBool(args["heartbeat"])
+	return SubscribeArgs{
+		Status:    getStringSlice(args, "status"),
+		Heartbeat: heartbeat,
+	}
+}
+
+func decodeOptionsDialogArgs(args map[string]any) any {
+	return OptionsDialogArgs{
+		Title:   getString(args, "title"),
+		Text:    getString(args, "text"),
+		Type:    getInt(args, "type"),
+		Options: getStringSlice(args, "options"),
+		Token:   getInt(args, "token"),
+	}
+}
+
+func decodeReplyOptionsDialogArgs(args map[string]any) any {
+	return ReplyOptionsDialogArgs{
+		Index: getInt(args, "index"),
+		Token: getInt(args, "token"),
+	}
+}
+
+func decodeStringDialogArgs(args map[string]any) any {
+	return StringDialogArgs{
+		Title:        getString(args, "title"),
+		Text:         getString(args, "text"),
+		InitialValue: getString(args, "initialValue"),
+		DefaultValue: getString(args, "defaultValue"),
+		Token:        getInt(args, "token"),
+	}
+}
+
+func decodeReplyStringDialogArgs(args map[string]any) any {
+	return ReplyStringDialogArgs{
+		Value: getString(args, "value"),
+		Token: getInt(args, "token"),
+	}
+}
+
+func decodeTaskDialogArgs(args map[string]any) any {
+	return TaskDialogArgs{
+		Title:      getString(args, "title"),
+		Text:       getString(args, "text"),
+		Subtext:    getString(args, "subtext"),
+		ButtonText: getStringSlice(args, "buttonText"),
+		Options:    getStringSlice(args, "options"),
+		Footer:     getString(args, "footer"),
+		Token:      getInt(args, "token"),
+	}
+}
+
+func decodeReplyTaskDialogArgs(args map[string]any) any {
+	return ReplyTaskDialogArgs{
+		Index: getInt(args, "index"),
+		Token: getInt(args, "token"),
+	}
+}
@@ -0,0 +1,140 @@
+package protocol
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/stefan/lsp-dap/internal/support/decode"
+)
+
+//go:embed schema.json
+var schemaJSON []byte
+
+// ErrInvalidArgs indicates command arguments that do not match the RIDE command schema.
+var ErrInvalidArgs = errors.New("invalid RIDE command arguments")
+
+// CommandSpec is one command entry of the machine-readable RIDE schema.
+type CommandSpec struct {
+	// SentBy is "client", "interpreter" or "both".
+	SentBy string `json:"sentBy"`
+	// Args maps argument names to field types (string, int, bool, string[], int[], object, object[], any).
+	Args     map[string]string `json:"args"`
+	Required []string          `json:"required"`
+}
+
+type schemaDocument struct {
+	Commands map[string]CommandSpec `json:"commands"`
+}
+
+var commandSchema = mustLoadSchema(schemaJSON)
+
+func mustLoadSchema(data []byte) map[string]CommandSpec {
+	var doc schemaDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		panic(fmt.Sprintf("protocol: invalid embedded schema: %v", err))
+	}
+	return doc.Commands
+}
+
+// Spec returns the schema entry for command, if the command is known.
+func (c *Codec) Spec(command string) (CommandSpec, bool) {
+	spec, ok := c.schema[command]
+	return spec, ok
+}
+
+// Validate checks args against the schema entry for command.
+// Args may be a typed argument struct or a map. Unknown commands and
+// unlisted fields are accepted, matching the codec's tolerance for newer interpreters.
+func (c *Codec) Validate(command string, args any) error {
+	spec, ok := c.schema[command]
+	if !ok {
+		return nil
+	}
+	fields, err := argsToFields(args)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidArgs, command, err)
+	}
+	return spec.validate(command, fields)
+}
+
+func (spec CommandSpec) validate(command string, fields map[string]any) error {
+	for _, name := range spec.Required {
+		if fields[name] == nil {
+			return fmt.Errorf("%w: %s requires %q", ErrInvalidArgs, command, name)
+		}
+	}
+
+	names := make([]string, 0, len(spec.Args))
+	for name := range spec.Args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := fields[name]
+		if value == nil {
+			continue
+		}
+		fieldType := spec.Args[name]
+		if !matchesFieldType(fieldType, value) {
+			return fmt.Errorf("%w: %s.%s must be %s", ErrInvalidArgs, command, name, fieldType)
+		}
+	}
+	return nil
+}
+
+// argsToFields normalizes typed or map arguments to their JSON object form.
+func argsToFields(args any) (map[string]any, error) {
+	if args == nil {
+		return map[string]any{}, nil
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return nil, errors.New("arguments must encode as a JSON object")
+	}
+	return fields, nil
+}
+
+func matchesFieldType(fieldType string, value any) bool {
+	switch fieldType {
+	case "any":
+		return true
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "int":
+		return isIntegral(value)
+	case "bool":
+		_, ok := decode.Bool(value)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "string[]", "int[]", "object[]":
+		items, ok := value.([]any)
+		if !ok {
+			return false
+		}
+		elemType := fieldType[:len(fieldType)-2]
+		for _, item := range items {
+			if !matchesFieldType(elemType, item) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+func isIntegral(value any) bool {
+	f, ok := value.(float64)
+	return ok && f == math.Trunc(f)
+}
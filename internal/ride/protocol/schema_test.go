@@ -0,0 +1,121 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSchema_EveryCommandHasDecoderAndValidFieldTypes(t *testing.T) {
+	codec := NewCodec()
+
+	if len(codec.schema) == 0 {
+		t.Fatal("expected embedded schema to list commands")
+	}
+	for command, spec := range codec.schema {
+		if _, ok := codec.decoders[command]; !ok {
+			t.Errorf("%s: no typed decoder", command)
+		}
+		switch spec.SentBy {
+		case "client", "interpreter", "both":
+		default:
+			t.Errorf("%s: unexpected sentBy %q", command, spec.SentBy)
+		}
+		for name, fieldType := range spec.Args {
+			elemType := strings.TrimSuffix(fieldType, "[]")
+			switch elemType {
+			case "string", "int", "bool", "object", "any":
+			default:
+				t.Errorf("%s.%s: unknown field type %q", command, name, fieldType)
+			}
+		}
+		for _, name := range spec.Required {
+			if _, ok := spec.Args[name]; !ok {
+				t.Errorf("%s: required field %q is not listed in args", command, name)
+			}
+		}
+	}
+	for command := range codec.decoders {
+		if _, ok := codec.schema[command]; !ok {
+			t.Errorf("%s: decoder without schema entry", command)
+		}
+	}
+}
+
+func TestValidate_ChecksRequiredFieldsAndTypes(t *testing.T) {
+	codec := NewCodec()
+
+	cases := []struct {
+		name    string
+		command string
+		args    any
+		wantErr string
+	}{
+		{name: "typed args", command: "ReplyOptionsDialog", args: ReplyOptionsDialogArgs{Index: -1, Token: 3}},
+		{name: "map args with Go slices", command: "SetLineAttributes", args: map[string]any{"win": 1, "stop": []int{0, 2}}},
+		{name: "numeric bool", command: "WindowTypeChanged", args: map[string]any{"win": 1, "tracer": 1}},
+		{name: "nil optional slice", command: "SaveChanges", args: SaveChangesArgs{Win: 1, Text: []string{"f"}}},
+		{name: "unknown command", command: "SomethingNew", args: map[string]any{"anything": true}},
+		{name: "missing required", command: "Execute", args: map[string]any{"trace": 0}, wantErr: `Execute requires "text"`},
+		{name: "wrong scalar type", command: "SetThread", args: map[string]any{"tid": "2"}, wantErr: "SetThread.tid must be int"},
+		{name: "fractional int", command: "GetValueTip", args: map[string]any{"line": "x", "pos": 1.5, "token": 1}, wantErr: "GetValueTip.pos must be int"},
+		{name: "wrong element type", command: "SaveChanges", args: map[string]any{"win": 1, "text": []any{"f", 2}}, wantErr: "SaveChanges.text must be string[]"},
+		{name: "not an object", command: "Execute", args: []string{"1+1"}, wantErr: "must encode as a JSON object"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := codec.Validate(tc.command, tc.args)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected valid args, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidArgs) {
+				t.Fatalf("expected ErrInvalidArgs, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %q", tc.wantErr, err.Error())
+			}
+		})
+	}
+}
+
+func TestEncodeCommand_RejectsInvalidArgsForKnownCommands(t *testing.T) {
+	codec := NewCodec()
+
+	if _, err := codec.EncodeCommand("ReplyStringDialog", map[string]any{"token": 7}); !errors.Is(err, ErrInvalidArgs) {
+		t.Fatalf("expected ErrInvalidArgs, got %v", err)
+	}
+	payload, err := codec.EncodeCommand("ReplyStringDialog", ReplyStringDialogArgs{Value: "yes", Token: 7})
+	if err != nil {
+		t.Fatalf("EncodeCommand failed: %v", err)
+	}
+	if payload != `["ReplyStringDialog",{"value":"yes","token":7}]` {
+		t.Fatalf("unexpected payload: %s", payload)
+	}
+}
+
+func TestDecodePayload_ReportsSchemaViolationsWithoutDroppingArgs(t *testing.T) {
+	codec := NewCodec()
+
+	decoded, err := codec.DecodePayload(`["SetPromptType",{"type":"busy"}]`)
+	if err != nil {
+		t.Fatalf("DecodePayload failed: %v", err)
+	}
+	if !errors.Is(decoded.Invalid, ErrInvalidArgs) {
+		t.Fatalf("expected schema violation, got %v", decoded.Invalid)
+	}
+	if _, ok := decoded.Args.(SetPromptTypeArgs); !ok {
+		t.Fatalf("expected SetPromptTypeArgs despite violation, got %T", decoded.Args)
+	}
+
+	decoded, err = codec.DecodePayload(`["SetPromptType",{"type":1}]`)
+	if err != nil {
+		t.Fatalf("DecodePayload failed: %v", err)
+	}
+	if decoded.Invalid != nil {
+		t.Fatalf("expected no violation, got %v", decoded.Invalid)
+	}
+}
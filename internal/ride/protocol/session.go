@@ -0,0 +1,129 @@
+package protocol
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SessionInfo describes the connected interpreter, built from its Identify reply.
+type SessionInfo struct {
+	ProtocolVersion int
+	APIVersion      int
+	Version         string
+	Platform        string
+	Arch            string
+	PID             int
+	Workspace       string
+	Machine         string
+	User            string
+}
+
+// Feature names an interpreter capability the adapter gates behaviour on.
+type Feature string
+
+const (
+	// FeatureJSONHighRank is ⎕JSON's HighRank variant option.
+	FeatureJSONHighRank Feature = "jsonHighRank"
+	// FeatureTraceBackward is the tracer's TraceBackward/TraceForward line skipping.
+	FeatureTraceBackward Feature = "traceBackward"
+	// FeatureDMX is ⎕DMX, whose fields HadError can carry.
+	FeatureDMX Feature = "dmx"
+	// FeatureLink is the bundled ]LINK user command.
+	FeatureLink Feature = "link"
+)
+
+// featureMinVersions lists the first interpreter major/minor version providing each feature.
+var featureMinVersions = map[Feature][2]int{
+	FeatureJSONHighRank:  {18, 0},
+	FeatureTraceBackward: {18, 0},
+	FeatureDMX:           {14, 0},
+	FeatureLink:          {18, 0},
+}
+
+// Features lists every gated feature in name order.
+func Features() []Feature {
+	features := make([]Feature, 0, len(featureMinVersions))
+	for feature := range featureMinVersions {
+		features = append(features, feature)
+	}
+	sort.Slice(features, func(i, j int) bool { return features[i] < features[j] })
+	return features
+}
+
+// MinVersion returns the first interpreter version providing feature, as "major.minor".
+func MinVersion(feature Feature) string {
+	minVersion, ok := featureMinVersions[feature]
+	if !ok {
+		return ""
+	}
+	return strconv.Itoa(minVersion[0]) + "." + strconv.Itoa(minVersion[1])
+}
+
+// NewSessionInfo builds session info from the interpreter's Identify reply.
+func NewSessionInfo(identify IdentifyArgs, protocolVersion int) SessionInfo {
+	return SessionInfo{
+		ProtocolVersion: protocolVersion,
+		APIVersion:      identify.APIVersion,
+		Version:         identify.Version,
+		Platform:        identify.Platform,
+		Arch:            identify.Arch,
+		PID:             identify.PID,
+		Workspace:       identify.Project,
+		Machine:         identify.Machine,
+		User:            identify.User,
+	}
+}
+
+// VersionNumbers parses the major and minor interpreter version from Version ("19.0.48745").
+func (i SessionInfo) VersionNumbers() (major int, minor int, ok bool) {
+	parts := strings.SplitN(strings.TrimSpace(i.Version), ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// VersionAtLeast reports whether the interpreter version is major.minor or newer.
+// An unparseable version is treated as new enough, so gating never hides
+// features from interpreters that report their version in an unexpected form.
+func (i SessionInfo) VersionAtLeast(major, minor int) bool {
+	gotMajor, gotMinor, ok := i.VersionNumbers()
+	if !ok {
+		return true
+	}
+	if gotMajor != major {
+		return gotMajor > major
+	}
+	return gotMinor >= minor
+}
+
+// Unicode reports whether the interpreter is a Unicode (not Classic) edition.
+func (i SessionInfo) Unicode() bool {
+	return !strings.Contains(strings.ToLower(i.Arch), "classic")
+}
+
+// Edition returns "Unicode" or "Classic".
+func (i SessionInfo) Edition() string {
+	if i.Unicode() {
+		return "Unicode"
+	}
+	return "Classic"
+}
+
+// Supports reports whether the interpreter provides feature.
+func (i SessionInfo) Supports(feature Feature) bool {
+	minVersion, ok := featureMinVersions[feature]
+	if !ok {
+		return true
+	}
+	return i.VersionAtLeast(minVersion[0], minVersion[1])
+}
@@ -0,0 +1,56 @@
+package protocol
+
+import "testing"
+
+func TestSessionInfo_VersionGatingAndEdition(t *testing.T) {
+	cases := []struct {
+		name     string
+		info     SessionInfo
+		supports bool
+		unicode  bool
+	}{
+		{name: "19.0 unicode", info: SessionInfo{Version: "19.0.48745", Arch: "Unicode/64"}, supports: true, unicode: true},
+		{name: "18.0 exact", info: SessionInfo{Version: "18.0.40684"}, supports: true, unicode: true},
+		{name: "17.1 classic", info: SessionInfo{Version: "17.1.40404", Arch: "Classic/32"}, supports: false, unicode: false},
+		{name: "unparseable version", info: SessionInfo{Version: "dev"}, supports: true, unicode: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.info.Supports(FeatureJSONHighRank); got != tc.supports {
+				t.Fatalf("Supports(FeatureJSONHighRank) = %v, want %v", got, tc.supports)
+			}
+			if got := tc.info.Unicode(); got != tc.unicode {
+				t.Fatalf("Unicode() = %v, want %v", got, tc.unicode)
+			}
+		})
+	}
+}
+
+func TestNewSessionInfo_MapsIdentifyReply(t *testing.T) {
+	codec := NewCodec()
+	decoded, err := codec.DecodePayload(`["Identify",{"apiVersion":1,"version":"19.0.48745","platform":"Linux-64","arch":"Unicode/64","pid":812,"Project":"CLEAR WS","Machine":"build01","User":"apl"}]`)
+	if err != nil {
+		t.Fatalf("DecodePayload failed: %v", err)
+	}
+	identify, ok := decoded.Args.(IdentifyArgs)
+	if !ok {
+		t.Fatalf("expected IdentifyArgs, got %T", decoded.Args)
+	}
+
+	info := NewSessionInfo(identify, 2)
+	want := SessionInfo{
+		ProtocolVersion: 2,
+		APIVersion:      1,
+		Version:         "19.0.48745",
+		Platform:        "Linux-64",
+		Arch:            "Unicode/64",
+		PID:             812,
+		Workspace:       "CLEAR WS",
+		Machine:         "build01",
+		User:            "apl",
+	}
+	if info != want {
+		t.Fatalf("unexpected session info: %#v", info)
+	}
+}
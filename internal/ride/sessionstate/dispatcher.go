@@ -2,10 +2,14 @@ package sessionstate
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/stefan/lsp-dap/internal/ride/protocol"
 )
@@ -16,9 +20,132 @@ type Transport interface {
 	WritePayload(payload string) error
 }
 
+// ErrRequestAborted is returned by Request when the session ends before the reply arrives.
+var ErrRequestAborted = errors.New("RIDE request aborted by session end")
+
+// defaultRequestTimeout bounds a Request whose context carries no deadline.
+const defaultRequestTimeout = 5 * time.Second
+
+// ReplyMatcher reports whether an inbound payload is the reply to a pending Request.
+// It runs on the receive loop and must not call back into the dispatcher.
+type ReplyMatcher func(reply protocol.DecodedPayload) bool
+
+// MatchCommand matches the next command named reply, for replies that carry no
+// token or window (ReplyGetThreads, ReplyGetSIStack).
+func MatchCommand(reply string) ReplyMatcher {
+	return func(decoded protocol.DecodedPayload) bool {
+		return decoded.Kind == protocol.KindCommand && decoded.Command == reply
+	}
+}
+
+// MatchToken matches the reply command carrying token, such as ValueTip.
+func MatchToken(reply string, token int) ReplyMatcher {
+	return matchIntField(reply, "token", token)
+}
+
+// MatchWin matches the reply command for window win, such as ReplySaveChanges.
+func MatchWin(reply string, win int) ReplyMatcher {
+	return matchIntField(reply, "win", win)
+}
+
+func matchIntField(reply, field string, want int) ReplyMatcher {
+	return func(decoded protocol.DecodedPayload) bool {
+		if decoded.Kind != protocol.KindCommand || decoded.Command != reply {
+			return false
+		}
+		got, ok := intField(decoded.Args, field)
+		return ok && got == want
+	}
+}
+
+// RequestStats counts the Requests made for one command.
+type RequestStats struct {
+	Sent      int
+	Answered  int
+	TimedOut  int
+	Cancelled int
+	Aborted   int
+	Failed    int
+	// TotalLatency and MaxLatency cover answered requests only.
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+}
+
+// criticalCommands are inbound commands the adapter's state depends on. When a slow
+// subscriber's channel is full they wait in an overflow queue and are delivered in order
+// as it drains; they are dropped, and reported as a loss, only once that queue is full.
+var criticalCommands = map[string]struct{}{
+	"Identify":          {},
+	"SetPromptType":     {},
+	"OpenWindow":        {},
+	"UpdateWindow":      {},
+	"CloseWindow":       {},
+	"GotoWindow":        {},
+	"WindowTypeChanged": {},
+	"SetHighlightLine":  {},
+	"ReplySaveChanges":  {},
+	"HadError":          {},
+	"OptionsDialog":     {},
+	"StringDialog":      {},
+	"TaskDialog":        {},
+	"Disconnect":        {},
+	"SysError":          {},
+	"InternalError":     {},
+	"Exit":              {},
+}
+
+// defaultLossReportInterval is the minimum gap between two loss reports for one subscriber.
+const defaultLossReportInterval = time.Second
+
+// defaultOverflowLimit caps the critical payloads queued for one subscriber, so a
+// subscriber that stops reading cannot grow the queue without bound.
+const defaultOverflowLimit = 256
+
+// SubscriberStats counts what publishing did for one subscriber.
+type SubscriberStats struct {
+	// Dropped counts payloads discarded because the subscriber was full: non-critical
+	// ones, and critical ones that found the overflow queue full too.
+	Dropped          int
+	DroppedByCommand map[string]int
+	// Deferred counts critical payloads that had to wait in the overflow queue.
+	Deferred int
+	// Backlog is the number of critical payloads waiting in the overflow queue now.
+	Backlog int
+}
+
+// SubscriberLoss reports payloads dropped for one subscriber since its previous report.
+type SubscriberLoss struct {
+	Subscriber int
+	Dropped    int
+	Commands   map[string]int
+	// TotalDropped counts every payload dropped for the subscriber so far.
+	TotalDropped int
+}
+
+type subscription struct {
+	ch       chan protocol.DecodedPayload
+	done     chan struct{}
+	overflow []protocol.DecodedPayload
+	draining bool
+	stats    SubscriberStats
+
+	unreported      map[string]int
+	unreportedCount int
+	lossTimer       *time.Timer
+}
+
+type pendingRequest struct {
+	command string
+	match   ReplyMatcher
+	reply   chan protocol.DecodedPayload
+	aborted chan struct{}
+}
+
+// outboundCommand is a command encoded, and so schema-validated, once when it is sent,
+// ready to write whether it goes out at once or after being queued or deferred.
 type outboundCommand struct {
-	name string
-	args any
+	name    string
+	payload string
 }
 
 // Dispatcher owns the single-reader receive loop and prompt-aware outbound gating.
@@ -32,9 +159,14 @@ type Dispatcher struct {
 	queue          []outboundCommand
 	pendingSaves   map[int]int
 	pendingCloses  map[int][]outboundCommand
-	subscribers    map[int]chan protocol.DecodedPayload
+	subscribers    map[int]*subscription
 	nextSubID      int
 	busyAllowList  map[string]struct{}
+	requests       []*pendingRequest
+	requestStats   map[string]RequestStats
+	lossHandler    func(SubscriberLoss)
+	lossInterval   time.Duration
+	overflowLimit  int
 }
 
 // NewDispatcher creates a session dispatcher over transport and codec.
@@ -47,7 +179,10 @@ func NewDispatcher(transport Transport, codec *protocol.Codec) *Dispatcher {
 		codec:         codec,
 		pendingSaves:  map[int]int{},
 		pendingCloses: map[int][]outboundCommand{},
-		subscribers:   map[int]chan protocol.DecodedPayload{},
+		subscribers:   map[int]*subscription{},
+		requestStats:  map[string]RequestStats{},
+		lossInterval:  defaultLossReportInterval,
+		overflowLimit: defaultOverflowLimit,
 		busyAllowList: map[string]struct{}{
 			"WeakInterrupt":    {},
 			"StrongInterrupt":  {},
@@ -58,11 +193,12 @@ func NewDispatcher(transport Transport, codec *protocol.Codec) *Dispatcher {
 	}
 }
 
-// Run starts the single-reader receive loop.
+// Run starts the single-reader receive loop. Requests still waiting when it returns are aborted.
 func (d *Dispatcher) Run(ctx context.Context) {
 	if d.transport == nil {
 		return
 	}
+	defer d.abortRequests()
 
 	for {
 		select {
@@ -89,26 +225,61 @@ func (d *Dispatcher) Run(ctx context.Context) {
 	}
 }
 
-// Subscribe registers an event subscriber channel.
+// Subscribe registers an event subscriber channel. Payloads that do not fit in buffer are
+// dropped and reported, except critical commands, which are queued until there is room.
 func (d *Dispatcher) Subscribe(buffer int) (<-chan protocol.DecodedPayload, func()) {
 	if buffer < 1 {
 		buffer = 1
 	}
-	ch := make(chan protocol.DecodedPayload, buffer)
+	sub := &subscription{
+		ch:         make(chan protocol.DecodedPayload, buffer),
+		done:       make(chan struct{}),
+		unreported: map[string]int{},
+	}
+	sub.stats.DroppedByCommand = map[string]int{}
 
 	d.mu.Lock()
 	id := d.nextSubID
 	d.nextSubID++
-	d.subscribers[id] = ch
+	d.subscribers[id] = sub
 	d.mu.Unlock()
 
+	var once sync.Once
 	unsubscribe := func() {
 		d.mu.Lock()
 		defer d.mu.Unlock()
-		delete(d.subscribers, id)
+		d.removeSubscriberLocked(id, sub)
+		once.Do(func() { close(sub.done) })
 	}
 
-	return ch, unsubscribe
+	return sub.ch, unsubscribe
+}
+
+// SetLossHandler installs a callback told when payloads are dropped for a slow subscriber.
+// The first loss is reported at once and later ones are batched, at most one report per
+// second for each subscriber. The callback must not block.
+func (d *Dispatcher) SetLossHandler(handler func(SubscriberLoss)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lossHandler = handler
+}
+
+// SubscriberStats returns publish counters for each current subscriber, by subscriber id.
+func (d *Dispatcher) SubscriberStats() map[int]SubscriberStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := make(map[int]SubscriberStats, len(d.subscribers))
+	for id, sub := range d.subscribers {
+		entry := sub.stats
+		entry.DroppedByCommand = make(map[string]int, len(sub.stats.DroppedByCommand))
+		for command, count := range sub.stats.DroppedByCommand {
+			entry.DroppedByCommand[command] = count
+		}
+		entry.Backlog = len(sub.overflow)
+		stats[id] = entry
+	}
+	return stats
 }
 
 // PromptType returns the most recently observed prompt type and whether one has been seen.
@@ -118,13 +289,28 @@ func (d *Dispatcher) PromptType() (int, bool) {
 	return d.promptType, d.promptTypeSeen
 }
 
+// ResetSession clears prompt state, deferred sends and pending Requests so a fresh
+// interpreter connection starts clean.
+func (d *Dispatcher) ResetSession() {
+	d.mu.Lock()
+	d.promptType = 0
+	d.promptTypeSeen = false
+	d.mu.Unlock()
+	d.clearDeferredSends()
+	d.abortRequests()
+}
+
 // SendCommand sends a command immediately when allowed, or queues it while promptType=0.
 func (d *Dispatcher) SendCommand(command string, args any) error {
 	if d.transport == nil {
 		return errors.New("dispatcher has no transport")
 	}
+	payload, err := d.codec.EncodeCommand(command, args)
+	if err != nil {
+		return err
+	}
 
-	cmd := outboundCommand{name: command, args: args}
+	cmd := outboundCommand{name: command, payload: payload}
 	saveWin, tracksSave := saveWindowID(command, args)
 
 	d.mu.Lock()
@@ -156,6 +342,151 @@ func (d *Dispatcher) SendCommand(command string, args any) error {
 	return nil
 }
 
+// Request sends command and waits for the inbound reply that match accepts, so callers
+// need no token or window bookkeeping of their own. The reply is still published to
+// subscribers. A context without a deadline is bounded by a five second timeout; the
+// returned error wraps context.DeadlineExceeded on timeout, context.Canceled on
+// cancellation, and ErrRequestAborted when the session ends first.
+func (d *Dispatcher) Request(ctx context.Context, command string, args any, match ReplyMatcher) (protocol.DecodedPayload, error) {
+	if match == nil {
+		return protocol.DecodedPayload{}, errors.New("request requires a reply matcher")
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultRequestTimeout)
+		defer cancel()
+	}
+
+	pending := &pendingRequest{
+		command: command,
+		match:   match,
+		reply:   make(chan protocol.DecodedPayload, 1),
+		aborted: make(chan struct{}),
+	}
+	// Register before sending: the reply can arrive before SendCommand returns.
+	d.mu.Lock()
+	d.requests = append(d.requests, pending)
+	d.mu.Unlock()
+
+	started := time.Now()
+	if err := d.SendCommand(command, args); err != nil {
+		d.mu.Lock()
+		d.removeRequestLocked(pending)
+		d.recordRequestLocked(command, func(stats *RequestStats) { stats.Failed++ })
+		d.mu.Unlock()
+		return protocol.DecodedPayload{}, err
+	}
+	d.mu.Lock()
+	d.recordRequestLocked(command, func(stats *RequestStats) { stats.Sent++ })
+	d.mu.Unlock()
+
+	select {
+	case reply := <-pending.reply:
+		return d.requestAnswered(pending, reply, started), nil
+	case <-pending.aborted:
+		return protocol.DecodedPayload{}, d.requestAborted(pending)
+	case <-ctx.Done():
+	}
+
+	d.mu.Lock()
+	if !d.removeRequestLocked(pending) {
+		// The reply or an abort won the race with the context.
+		d.mu.Unlock()
+		select {
+		case reply := <-pending.reply:
+			return d.requestAnswered(pending, reply, started), nil
+		case <-pending.aborted:
+			return protocol.DecodedPayload{}, d.requestAborted(pending)
+		}
+	}
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	d.recordRequestLocked(command, func(stats *RequestStats) {
+		if timedOut {
+			stats.TimedOut++
+			return
+		}
+		stats.Cancelled++
+	})
+	d.mu.Unlock()
+	return protocol.DecodedPayload{}, fmt.Errorf("RIDE %s request: %w", command, ctx.Err())
+}
+
+// RequestStats returns per-command counters for Requests made so far.
+func (d *Dispatcher) RequestStats() map[string]RequestStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := make(map[string]RequestStats, len(d.requestStats))
+	for command, entry := range d.requestStats {
+		stats[command] = entry
+	}
+	return stats
+}
+
+func (d *Dispatcher) requestAnswered(pending *pendingRequest, reply protocol.DecodedPayload, started time.Time) protocol.DecodedPayload {
+	latency := time.Since(started)
+	d.mu.Lock()
+	d.recordRequestLocked(pending.command, func(stats *RequestStats) {
+		stats.Answered++
+		stats.TotalLatency += latency
+		if latency > stats.MaxLatency {
+			stats.MaxLatency = latency
+		}
+	})
+	d.mu.Unlock()
+	return reply
+}
+
+func (d *Dispatcher) requestAborted(pending *pendingRequest) error {
+	d.mu.Lock()
+	d.recordRequestLocked(pending.command, func(stats *RequestStats) { stats.Aborted++ })
+	d.mu.Unlock()
+	return fmt.Errorf("%w: %s", ErrRequestAborted, pending.command)
+}
+
+func (d *Dispatcher) recordRequestLocked(command string, update func(stats *RequestStats)) {
+	stats := d.requestStats[command]
+	update(&stats)
+	d.requestStats[command] = stats
+}
+
+func (d *Dispatcher) removeRequestLocked(pending *pendingRequest) bool {
+	for i, candidate := range d.requests {
+		if candidate == pending {
+			d.requests = append(d.requests[:i], d.requests[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// deliverReply hands decoded to the oldest pending Request that matches it.
+func (d *Dispatcher) deliverReply(decoded protocol.DecodedPayload) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, pending := range d.requests {
+		if !pending.match(decoded) {
+			continue
+		}
+		d.removeRequestLocked(pending)
+		pending.reply <- decoded
+		return
+	}
+}
+
+// abortRequests fails every pending Request; nothing sent earlier will be answered.
+func (d *Dispatcher) abortRequests() {
+	d.mu.Lock()
+	pending := d.requests
+	d.requests = nil
+	d.mu.Unlock()
+
+	for _, request := range pending {
+		close(request.aborted)
+	}
+}
+
 func (d *Dispatcher) isAllowedWhileBusy(command string) bool {
 	if strings.HasPrefix(command, "Reply") {
 		return true
@@ -178,6 +509,7 @@ func (d *Dispatcher) handleInbound(decoded protocol.DecodedPayload) {
 		case "Disconnect", "SysError", "InternalError":
 			d.clearDeferredSends()
 		}
+		d.deliverReply(decoded)
 	}
 	d.publish(decoded)
 }
@@ -210,11 +542,7 @@ func (d *Dispatcher) handlePromptType(promptType int) {
 }
 
 func (d *Dispatcher) writeCommand(cmd outboundCommand) error {
-	payload, err := d.codec.EncodeCommand(cmd.name, cmd.args)
-	if err != nil {
-		return err
-	}
-	return d.transport.WritePayload(payload)
+	return d.transport.WritePayload(cmd.payload)
 }
 
 func (d *Dispatcher) rollbackPendingSave(win int) {
@@ -297,43 +625,196 @@ func (d *Dispatcher) clearDeferredSends() {
 }
 
 func (d *Dispatcher) publish(decoded protocol.DecodedPayload) {
-	type subscriber struct {
-		id int
-		ch chan protocol.DecodedPayload
-	}
+	critical := isCritical(decoded)
+	name := payloadName(decoded)
 
+	var reports []SubscriberLoss
 	d.mu.Lock()
-	subs := make([]subscriber, 0, len(d.subscribers))
-	for id, ch := range d.subscribers {
-		subs = append(subs, subscriber{id: id, ch: ch})
+	handler := d.lossHandler
+	for id, sub := range d.subscribers {
+		// Queued critical payloads stay ahead of later critical ones; anything else goes
+		// straight through whenever the channel has room.
+		if !critical || len(sub.overflow) == 0 {
+			sent, closed := trySend(sub.ch, decoded)
+			if closed {
+				d.removeSubscriberLocked(id, sub)
+				continue
+			}
+			if sent {
+				continue
+			}
+		}
+
+		if critical && len(sub.overflow) < d.overflowLimit {
+			sub.overflow = append(sub.overflow, decoded)
+			sub.stats.Deferred++
+			if !sub.draining {
+				sub.draining = true
+				go d.drainOverflow(sub)
+			}
+			continue
+		}
+		sub.stats.Dropped++
+		sub.stats.DroppedByCommand[name]++
+		if report, ok := d.noteLossLocked(id, sub, name); ok {
+			reports = append(reports, report)
+		}
 	}
 	d.mu.Unlock()
 
-	for _, subscriber := range subs {
-		if d.tryPublish(subscriber.ch, decoded) {
-			continue
+	if handler != nil {
+		for _, report := range reports {
+			handler(report)
 		}
+	}
+}
 
+// drainOverflow delivers a subscriber's queued critical payloads in order, waiting for
+// room, until the queue is empty or the subscriber goes away.
+func (d *Dispatcher) drainOverflow(sub *subscription) {
+	for {
 		d.mu.Lock()
-		if current, ok := d.subscribers[subscriber.id]; ok && current == subscriber.ch {
-			delete(d.subscribers, subscriber.id)
+		if len(sub.overflow) == 0 {
+			sub.draining = false
+			d.mu.Unlock()
+			return
 		}
+		next := sub.overflow[0]
+		d.mu.Unlock()
+
+		// The payload leaves the queue only once delivered, so publish keeps later ones behind it.
+		if !sendUntilDone(sub.ch, sub.done, next) {
+			d.mu.Lock()
+			sub.overflow = nil
+			sub.draining = false
+			d.mu.Unlock()
+			return
+		}
+		d.mu.Lock()
+		sub.overflow = sub.overflow[1:]
 		d.mu.Unlock()
 	}
 }
 
-func (d *Dispatcher) tryPublish(ch chan protocol.DecodedPayload, decoded protocol.DecodedPayload) (ok bool) {
+// noteLossLocked records a drop and returns a report when one is due now. Drops inside
+// the report interval are collected and reported when it ends.
+func (d *Dispatcher) noteLossLocked(id int, sub *subscription, name string) (SubscriberLoss, bool) {
+	sub.unreported[name]++
+	sub.unreportedCount++
+	if sub.lossTimer != nil {
+		return SubscriberLoss{}, false
+	}
+	sub.lossTimer = time.AfterFunc(d.lossInterval, func() { d.flushLossReport(id, sub) })
+	return takeLossReportLocked(id, sub), true
+}
+
+func (d *Dispatcher) flushLossReport(id int, sub *subscription) {
+	d.mu.Lock()
+	if d.subscribers[id] != sub {
+		// Unsubscribed after the timer fired; its drops no longer matter to anyone.
+		d.mu.Unlock()
+		return
+	}
+	if sub.unreportedCount == 0 {
+		sub.lossTimer = nil
+		d.mu.Unlock()
+		return
+	}
+	report := takeLossReportLocked(id, sub)
+	handler := d.lossHandler
+	sub.lossTimer = time.AfterFunc(d.lossInterval, func() { d.flushLossReport(id, sub) })
+	d.mu.Unlock()
+
+	if handler != nil {
+		handler(report)
+	}
+}
+
+// removeSubscriberLocked forgets a subscriber and stops its pending loss report.
+func (d *Dispatcher) removeSubscriberLocked(id int, sub *subscription) {
+	delete(d.subscribers, id)
+	if sub.lossTimer != nil {
+		sub.lossTimer.Stop()
+		sub.lossTimer = nil
+	}
+}
+
+func takeLossReportLocked(id int, sub *subscription) SubscriberLoss {
+	report := SubscriberLoss{
+		Subscriber:   id,
+		Dropped:      sub.unreportedCount,
+		Commands:     sub.unreported,
+		TotalDropped: sub.stats.Dropped,
+	}
+	sub.unreported = map[string]int{}
+	sub.unreportedCount = 0
+	return report
+}
+
+// String summarises the loss for a diagnostic log line, busiest commands first.
+func (l SubscriberLoss) String() string {
+	commands := make([]string, 0, len(l.Commands))
+	for command := range l.Commands {
+		commands = append(commands, command)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		if l.Commands[commands[i]] != l.Commands[commands[j]] {
+			return l.Commands[commands[i]] > l.Commands[commands[j]]
+		}
+		return commands[i] < commands[j]
+	})
+	counts := make([]string, 0, len(commands))
+	for _, command := range commands {
+		counts = append(counts, fmt.Sprintf("%s×%d", command, l.Commands[command]))
+	}
+	return fmt.Sprintf("dropped %d RIDE payload(s) for slow subscriber %d (%s); %d dropped in total",
+		l.Dropped, l.Subscriber, strings.Join(counts, ", "), l.TotalDropped)
+}
+
+func isCritical(decoded protocol.DecodedPayload) bool {
+	if decoded.Kind != protocol.KindCommand {
+		return false
+	}
+	_, ok := criticalCommands[decoded.Command]
+	return ok
+}
+
+func payloadName(decoded protocol.DecodedPayload) string {
+	if decoded.Kind != protocol.KindCommand || decoded.Command == "" {
+		return "raw"
+	}
+	return decoded.Command
+}
+
+// trySend delivers without blocking; closed reports a subscriber channel closed under us.
+func trySend(ch chan protocol.DecodedPayload, decoded protocol.DecodedPayload) (sent bool, closed bool) {
 	defer func() {
 		if recover() != nil {
-			ok = false
+			sent, closed = false, true
 		}
 	}()
 
 	select {
 	case ch <- decoded:
+		return true, false
 	default:
+		return false, false
+	}
+}
+
+func sendUntilDone(ch chan protocol.DecodedPayload, done <-chan struct{}, decoded protocol.DecodedPayload) (sent bool) {
+	defer func() {
+		if recover() != nil {
+			sent = false
+		}
+	}()
+
+	select {
+	case ch <- decoded:
+		return true
+	case <-done:
+		return false
 	}
-	return true
 }
 
 func extractPromptType(args any) (int, bool) {
@@ -410,6 +891,18 @@ func windowIDFromArgs(args any) (int, bool) {
 	}
 }
 
+// intField reads an integer argument from typed or map command args.
+func intField(args any, name string) (int, bool) {
+	fields, ok := args.(map[string]any)
+	if !ok {
+		data, err := json.Marshal(args)
+		if err != nil || json.Unmarshal(data, &fields) != nil {
+			return 0, false
+		}
+	}
+	return toInt(fields[name])
+}
+
 func saveWindowID(command string, args any) (int, bool) {
 	if command != "SaveChanges" {
 		return 0, false
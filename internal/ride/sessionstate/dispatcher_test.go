@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -553,7 +555,7 @@ func TestDispatcher_PublishDoesNotPanicWhenSubscriberChannelIsClosed(t *testing.
 
 	dispatcher.mu.Lock()
 	for _, subscriber := range dispatcher.subscribers {
-		close(subscriber)
+		close(subscriber.ch)
 		break
 	}
 	dispatcher.mu.Unlock()
@@ -566,6 +568,284 @@ func TestDispatcher_PublishDoesNotPanicWhenSubscriberChannelIsClosed(t *testing.
 	dispatcher.publish(protocol.DecodedPayload{Kind: protocol.KindRaw, Raw: "x"})
 }
 
+func TestDispatcher_SlowSubscriberKeepsCriticalCommandsAndReportsDrops(t *testing.T) {
+	transport := newMockTransport()
+	dispatcher := NewDispatcher(transport, protocol.NewCodec())
+	dispatcher.lossInterval = 20 * time.Millisecond
+	reports := make(chan SubscriberLoss, 4)
+	dispatcher.SetLossHandler(func(loss SubscriberLoss) { reports <- loss })
+	events, _ := dispatcher.Subscribe(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	transport.push(`["AppendSessionOutput",{"result":"first","type":14}]`)
+	transport.push(`["AppendSessionOutput",{"result":"dropped","type":14}]`)
+	transport.push(`["OpenWindow",{"token":9,"debugger":1}]`)
+	transport.push(`["AppendSessionOutput",{"result":"still full","type":14}]`)
+	transport.push(`["SetPromptType",{"type":1}]`)
+
+	waitForCondition(t, 250*time.Millisecond, func() bool {
+		stats := dispatcher.SubscriberStats()[0]
+		return stats.Dropped == 2 && stats.Deferred == 2
+	})
+	if stats := dispatcher.SubscriberStats()[0]; stats.DroppedByCommand["AppendSessionOutput"] != 2 || stats.Backlog != 2 {
+		t.Fatalf("unexpected subscriber stats: %#v", stats)
+	}
+
+	for _, want := range []string{"AppendSessionOutput", "OpenWindow", "SetPromptType"} {
+		select {
+		case event := <-events:
+			if event.Command != want {
+				t.Fatalf("expected %s next, got %s", want, event.Command)
+			}
+		case <-time.After(250 * time.Millisecond):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+
+	var got []SubscriberLoss
+	for len(got) < 2 {
+		select {
+		case loss := <-reports:
+			got = append(got, loss)
+		case <-time.After(250 * time.Millisecond):
+			t.Fatalf("expected the first drop reported at once and the second batched, got %#v", got)
+		}
+	}
+	if got[0].Dropped != 1 || got[0].TotalDropped != 1 || got[1].Dropped != 1 || got[1].TotalDropped != 2 {
+		t.Fatalf("unexpected loss reports: %#v", got)
+	}
+	if text := got[1].String(); !strings.Contains(text, "AppendSessionOutput×1") || !strings.Contains(text, "2 dropped in total") {
+		t.Fatalf("unexpected loss report text: %q", text)
+	}
+}
+
+func TestDispatcher_OverflowIsCappedAndDoesNotHoldBackPayloadsThatFit(t *testing.T) {
+	dispatcher := NewDispatcher(newMockTransport(), protocol.NewCodec())
+	dispatcher.overflowLimit = 1
+	reports := make(chan SubscriberLoss, 4)
+	dispatcher.SetLossHandler(func(loss SubscriberLoss) { reports <- loss })
+	events, _ := dispatcher.Subscribe(1)
+
+	// A critical payload is already queued and its drain has not yet taken the free slot.
+	dispatcher.mu.Lock()
+	sub := dispatcher.subscribers[0]
+	sub.overflow = []protocol.DecodedPayload{{Kind: protocol.KindCommand, Command: "OpenWindow"}}
+	sub.draining = true
+	dispatcher.mu.Unlock()
+
+	dispatcher.publish(protocol.DecodedPayload{Kind: protocol.KindCommand, Command: "AppendSessionOutput"})
+	select {
+	case event := <-events:
+		if event.Command != "AppendSessionOutput" {
+			t.Fatalf("expected AppendSessionOutput to go through, got %s", event.Command)
+		}
+	default:
+		t.Fatal("non-critical payload was held back although the channel had room")
+	}
+
+	dispatcher.publish(protocol.DecodedPayload{Kind: protocol.KindCommand, Command: "SetPromptType"})
+	stats := dispatcher.SubscriberStats()[0]
+	if stats.Backlog != 1 || stats.Dropped != 1 || stats.DroppedByCommand["SetPromptType"] != 1 {
+		t.Fatalf("expected the full overflow queue to drop SetPromptType, got %#v", stats)
+	}
+	select {
+	case loss := <-reports:
+		if loss.Commands["SetPromptType"] != 1 {
+			t.Fatalf("unexpected loss report: %#v", loss)
+		}
+	default:
+		t.Fatal("expected the dropped critical payload to be reported")
+	}
+}
+
+func TestDispatcher_UnsubscribeStopsPendingLossReports(t *testing.T) {
+	dispatcher := NewDispatcher(newMockTransport(), protocol.NewCodec())
+	dispatcher.lossInterval = 10 * time.Millisecond
+	reports := make(chan SubscriberLoss, 4)
+	dispatcher.SetLossHandler(func(loss SubscriberLoss) { reports <- loss })
+	_, unsubscribe := dispatcher.Subscribe(1)
+
+	dispatcher.mu.Lock()
+	sub := dispatcher.subscribers[0]
+	dispatcher.mu.Unlock()
+
+	for _, raw := range []string{"kept", "reported", "batched"} {
+		dispatcher.publish(protocol.DecodedPayload{Kind: protocol.KindRaw, Raw: raw})
+	}
+	<-reports
+	unsubscribe()
+
+	dispatcher.mu.Lock()
+	timer := sub.lossTimer
+	dispatcher.mu.Unlock()
+	if timer != nil {
+		t.Fatal("expected unsubscribe to stop the loss report timer")
+	}
+	select {
+	case loss := <-reports:
+		t.Fatalf("expected no report after unsubscribe, got %#v", loss)
+	case <-time.After(5 * dispatcher.lossInterval):
+	}
+}
+
+func TestDispatcher_RequestReturnsReplyMatchedByTokenWinOrCommand(t *testing.T) {
+	transport := newMockTransport()
+	dispatcher := NewDispatcher(transport, protocol.NewCodec())
+	events, _ := dispatcher.Subscribe(16)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	cases := []struct {
+		command string
+		args    any
+		match   ReplyMatcher
+		replies []string
+		want    string
+	}{
+		{
+			command: "GetValueTip",
+			args:    map[string]any{"win": 1, "line": "x", "pos": 1, "token": 7},
+			match:   MatchToken("ValueTip", 7),
+			replies: []string{
+				`["ValueTip",{"tip":["other"],"class":2,"token":6}]`,
+				`["ValueTip",{"tip":["42"],"class":2,"token":7}]`,
+			},
+			want: "42",
+		},
+		{
+			command: "SaveChanges",
+			args:    protocol.SaveChangesArgs{Win: 5, Text: []string{"F"}},
+			match:   MatchWin("ReplySaveChanges", 5),
+			replies: []string{
+				`["ReplySaveChanges",{"win":4,"err":0}]`,
+				`["ReplySaveChanges",{"win":5,"err":1}]`,
+			},
+			want: "err=1",
+		},
+		{
+			command: "GetThreads",
+			args:    map[string]any{},
+			match:   MatchCommand("ReplyGetThreads"),
+			replies: []string{
+				`["AppendSessionOutput",{"result":"noise","type":14}]`,
+				`["ReplyGetThreads",{"threads":[{"tid":0,"description":"Main"}]}]`,
+			},
+			want: "tid=0",
+		},
+	}
+
+	for _, tc := range cases {
+		result := make(chan protocol.DecodedPayload, 1)
+		go func() {
+			reply, err := dispatcher.Request(context.Background(), tc.command, tc.args, tc.match)
+			if err != nil {
+				t.Errorf("%s request failed: %v", tc.command, err)
+			}
+			result <- reply
+		}()
+		if name, err := decodeCommandName(waitForWrite(t, transport.writeCh, 250*time.Millisecond)); err != nil || name != tc.command {
+			t.Fatalf("expected %s to be written, got %q (%v)", tc.command, name, err)
+		}
+		for _, reply := range tc.replies {
+			transport.push(reply)
+		}
+
+		var reply protocol.DecodedPayload
+		select {
+		case reply = <-result:
+		case <-time.After(250 * time.Millisecond):
+			t.Fatalf("timed out waiting for %s reply", tc.command)
+		}
+		var got string
+		switch args := reply.Args.(type) {
+		case protocol.ValueTipArgs:
+			got = strings.Join(args.Tip, "")
+		case protocol.ReplySaveChangesArgs:
+			got = fmt.Sprintf("err=%d", args.Err)
+		case protocol.ReplyGetThreadsArgs:
+			if len(args.Threads) == 1 {
+				got = fmt.Sprintf("tid=%d", args.Threads[0].Tid)
+			}
+		}
+		if got != tc.want {
+			t.Fatalf("%s correlated the wrong reply: %#v", tc.command, reply)
+		}
+
+		// Correlated replies are still broadcast to subscribers.
+		for range tc.replies {
+			select {
+			case <-events:
+			case <-time.After(250 * time.Millisecond):
+				t.Fatalf("expected %s replies to be published", tc.command)
+			}
+		}
+	}
+
+	stats := dispatcher.RequestStats()
+	for _, command := range []string{"GetValueTip", "SaveChanges", "GetThreads"} {
+		if got := stats[command]; got.Sent != 1 || got.Answered != 1 || got.TotalLatency <= 0 {
+			t.Fatalf("unexpected %s stats: %#v", command, got)
+		}
+	}
+}
+
+func TestDispatcher_RequestTimesOutCancelsAndAbortsOnReset(t *testing.T) {
+	transport := newMockTransport()
+	dispatcher := NewDispatcher(transport, protocol.NewCodec())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	timeoutCtx, cancelTimeout := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelTimeout()
+	if _, err := dispatcher.Request(timeoutCtx, "GetThreads", map[string]any{}, MatchCommand("ReplyGetThreads")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	waitForWrite(t, transport.writeCh, 250*time.Millisecond)
+
+	cancelledCtx, cancelRequest := context.WithCancel(context.Background())
+	go func() {
+		waitForWrite(t, transport.writeCh, 250*time.Millisecond)
+		cancelRequest()
+	}()
+	if _, err := dispatcher.Request(cancelledCtx, "GetSIStack", map[string]any{}, MatchCommand("ReplyGetSIStack")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+
+	go func() {
+		waitForWrite(t, transport.writeCh, 250*time.Millisecond)
+		dispatcher.ResetSession()
+	}()
+	if _, err := dispatcher.Request(context.Background(), "GetValueTip", map[string]any{"line": "x", "pos": 1, "token": 3}, MatchToken("ValueTip", 3)); !errors.Is(err, ErrRequestAborted) {
+		t.Fatalf("expected reset to abort the request, got %v", err)
+	}
+
+	// A late reply to an abandoned request is only published.
+	transport.push(`["ReplyGetThreads",{"threads":[]}]`)
+	waitForCondition(t, 250*time.Millisecond, func() bool {
+		dispatcher.mu.Lock()
+		defer dispatcher.mu.Unlock()
+		return len(dispatcher.requests) == 0
+	})
+
+	stats := dispatcher.RequestStats()
+	if got := stats["GetThreads"]; got.Sent != 1 || got.TimedOut != 1 || got.Answered != 0 {
+		t.Fatalf("unexpected GetThreads stats: %#v", got)
+	}
+	if got := stats["GetSIStack"]; got.Cancelled != 1 {
+		t.Fatalf("unexpected GetSIStack stats: %#v", got)
+	}
+	if got := stats["GetValueTip"]; got.Aborted != 1 {
+		t.Fatalf("unexpected GetValueTip stats: %#v", got)
+	}
+}
+
 type readResult struct {
 	payload string
 	err     error
@@ -8,31 +8,39 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 )
 
 const (
-	rideMagic               = "RIDE"
-	protocolVersion         = "2"
-	supportedProtocolsFrame = "SupportedProtocols=" + protocolVersion
-	usingProtocolFrame      = "UsingProtocol=" + protocolVersion
+	rideMagic                = "RIDE"
+	supportedProtocolsPrefix = "SupportedProtocols="
+	usingProtocolPrefix      = "UsingProtocol="
 )
 
+// supportedProtocolVersions lists the RIDE protocol versions this client speaks.
+var supportedProtocolVersions = []int{2}
+
 var (
 	// ErrNoConnection indicates the client has not been attached to a socket.
 	ErrNoConnection = errors.New("no connection attached")
 	// ErrInvalidMagic indicates the frame did not contain the RIDE magic bytes.
 	ErrInvalidMagic = errors.New("invalid RIDE frame magic")
+	// ErrNoCommonProtocol indicates the interpreter offered no protocol version this client speaks.
+	ErrNoCommonProtocol = errors.New("no mutually supported RIDE protocol version")
 )
 
 // Client manages low-level RIDE transport interactions.
 type Client struct {
-	mu            sync.RWMutex
-	readMu        sync.Mutex
-	writeMu       sync.Mutex
-	conn          net.Conn
-	rd            *bufio.Reader
-	trafficLogger TrafficLogger
+	mu              sync.RWMutex
+	readMu          sync.Mutex
+	writeMu         sync.Mutex
+	conn            net.Conn
+	rd              *bufio.Reader
+	trafficLogger   TrafficLogger
+	protocolVersion int
 }
 
 // NewClient creates a transport client.
@@ -148,20 +156,34 @@ func (c *Client) WriteCommand(command string, args map[string]any) error {
 	return c.WritePayload(string(payload))
 }
 
-// InitializeSession performs protocol v2 handshake and startup commands.
+// ProtocolVersion returns the RIDE protocol version negotiated by the last
+// InitializeSession, or 0 before a handshake has completed.
+func (c *Client) ProtocolVersion() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.protocolVersion
+}
+
+// InitializeSession negotiates the protocol version and sends the startup commands.
+// The highest version offered by both sides is used.
 func (c *Client) InitializeSession() error {
 	first, err := c.ReadPayload()
 	if err != nil {
 		return fmt.Errorf("read handshake supported protocols: %w", err)
 	}
-	if first != supportedProtocolsFrame {
+	offered, err := parseProtocolVersions(first, supportedProtocolsPrefix)
+	if err != nil {
 		return fmt.Errorf("unexpected supported protocols payload %q", first)
 	}
+	version, err := negotiateProtocolVersion(offered, supportedProtocolVersions)
+	if err != nil {
+		return fmt.Errorf("%w: interpreter offered %q", err, first)
+	}
 
-	if err := c.WritePayload(supportedProtocolsFrame); err != nil {
+	if err := c.WritePayload(supportedProtocolsPrefix + joinProtocolVersions(supportedProtocolVersions)); err != nil {
 		return fmt.Errorf("write handshake supported protocols: %w", err)
 	}
-	if err := c.WritePayload(usingProtocolFrame); err != nil {
+	if err := c.WritePayload(usingProtocolPrefix + strconv.Itoa(version)); err != nil {
 		return fmt.Errorf("write handshake using protocol: %w", err)
 	}
 
@@ -169,10 +191,15 @@ func (c *Client) InitializeSession() error {
 	if err != nil {
 		return fmt.Errorf("read handshake using protocol: %w", err)
 	}
-	if second != usingProtocolFrame {
+	using, err := parseProtocolVersions(second, usingProtocolPrefix)
+	if err != nil || len(using) != 1 || using[0] != version {
 		return fmt.Errorf("unexpected using protocol payload %q", second)
 	}
 
+	c.mu.Lock()
+	c.protocolVersion = version
+	c.mu.Unlock()
+
 	if err := c.WriteCommand("Identify", map[string]any{
 		"apiVersion": 1,
 		"identity":   1,
@@ -190,3 +217,41 @@ func (c *Client) InitializeSession() error {
 
 	return nil
 }
+
+// parseProtocolVersions reads the comma-separated version list of a handshake frame.
+func parseProtocolVersions(payload string, prefix string) ([]int, error) {
+	list, ok := strings.CutPrefix(payload, prefix)
+	if !ok {
+		return nil, fmt.Errorf("missing %q prefix", prefix)
+	}
+	var versions []int
+	for _, field := range strings.Split(list, ",") {
+		version, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+func negotiateProtocolVersion(offered []int, supported []int) (int, error) {
+	best := 0
+	for _, version := range offered {
+		if version > best && slices.Contains(supported, version) {
+			best = version
+		}
+	}
+	if best == 0 {
+		return 0, ErrNoCommonProtocol
+	}
+	return best, nil
+}
+
+func joinProtocolVersions(versions []int) string {
+	fields := make([]string, len(versions))
+	for i, version := range versions {
+		fields[i] = strconv.Itoa(version)
+	}
+	return strings.Join(fields, ",")
+}
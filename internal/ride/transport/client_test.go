@@ -253,6 +253,60 @@ func TestInitializeSession_PerformsProtocol2HandshakeAndStartup(t *testing.T) {
 	}
 }
 
+func TestInitializeSession_NegotiatesHighestCommonProtocolVersion(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	client := NewClient()
+	client.AttachConn(clientConn)
+
+	errCh := make(chan error, 1)
+	go func() {
+		if err := writeFrame(serverConn, "SupportedProtocols=1,2,3"); err != nil {
+			errCh <- err
+			return
+		}
+		var handshake []string
+		for i := 0; i < 2; i++ {
+			payload, err := readFrame(serverConn)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			handshake = append(handshake, payload)
+		}
+		if handshake[0] != "SupportedProtocols=2" || handshake[1] != "UsingProtocol=2" {
+			errCh <- fmt.Errorf("unexpected handshake: %q", handshake)
+			return
+		}
+		if err := writeFrame(serverConn, "UsingProtocol=2"); err != nil {
+			errCh <- err
+			return
+		}
+		for i := 0; i < 3; i++ {
+			if _, err := readFrame(serverConn); err != nil {
+				errCh <- err
+				return
+			}
+		}
+		errCh <- nil
+	}()
+
+	if got := client.ProtocolVersion(); got != 0 {
+		t.Fatalf("expected no protocol version before handshake, got %d", got)
+	}
+	if err := client.InitializeSession(); err != nil {
+		t.Fatalf("InitializeSession failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("server assertions failed: %v", err)
+	}
+	if got := client.ProtocolVersion(); got != 2 {
+		t.Fatalf("expected negotiated protocol 2, got %d", got)
+	}
+}
+
 func TestInitializeSession_ErrsOnUnexpectedServerProtocol(t *testing.T) {
 	clientConn, serverConn := net.Pipe()
 	defer clientConn.Close()
@@ -266,8 +320,8 @@ func TestInitializeSession_ErrsOnUnexpectedServerProtocol(t *testing.T) {
 	}()
 
 	err := client.InitializeSession()
-	if err == nil {
-		t.Fatal("expected InitializeSession error")
+	if !errors.Is(err, ErrNoCommonProtocol) {
+		t.Fatalf("expected ErrNoCommonProtocol, got %v", err)
 	}
 }
 
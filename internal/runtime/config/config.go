@@ -3,6 +3,11 @@ package config
 import (
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/stefan/lsp-dap/internal/integration/harness"
@@ -51,18 +56,70 @@ func FromRequest(requestCommand string, arguments any) (harness.Config, error) {
 	if timeoutMs, ok := decode.IntFromMapTextOrNumber(argsMap, "rideConnectTimeoutMs"); ok && timeoutMs > 0 {
 		cfg.ConnectTimeout = time.Duration(timeoutMs) * time.Millisecond
 	}
-	if dyalogBin, ok := decode.NonEmptyTrimmedStringFromMap(argsMap, "dyalogBin"); ok && cfg.LaunchCommand == "" && cfg.RideAddr != "" {
-		command, err := harness.DyalogServeLaunchCommand(cfg.RideAddr, dyalogBin)
+	if value, exists := argsMap["rideReconnectTimeout"]; exists {
+		// Zero is allowed here: it turns reconnects off.
+		timeout, err := durationFrom(value)
+		if err == nil && timeout < 0 {
+			err = errors.New("must not be negative")
+		}
 		if err != nil {
-			return cfg, err
+			return cfg, fmt.Errorf("invalid rideReconnectTimeout %v: %w", value, err)
+		}
+		cfg.ReconnectTimeout = timeout
+	}
+	if err := applyTLSSettings(&cfg, argsMap); err != nil {
+		return cfg, err
+	}
+	if value, exists := argsMap["rideListen"]; exists {
+		listen, ok := decode.Bool(value)
+		if !ok {
+			return cfg, fmt.Errorf("invalid rideListen %v: expected boolean", value)
+		}
+		cfg.Listen = listen
+	}
+	if cfg.Listen && cfg.TLS.Enabled {
+		return cfg, errors.New("rideListen does not support rideTls; the adapter cannot act as a TLS server")
+	}
+	launchOpts, hasLaunchOpts, err := dyalogLaunchOptionsFrom(argsMap)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.RideAddr == "" && requestCommand == "launch" && !explicitLaunchSetting {
+		// Without an endpoint, an adapter-owned launch picks its own port.
+		cfg.RideAddr = harness.AutoRideAddr
+	}
+	if cfg.RideAddr == harness.AutoRideAddr {
+		if requestCommand != "launch" {
+			return cfg, errors.New("rideAddr auto is only supported for launch")
+		}
+		if explicitLaunchSetting && !hasLaunchOpts {
+			return cfg, errors.New("rideAddr auto cannot be used with rideLaunchCommand; use dyalogBin instead")
+		}
+		if cfg.LaunchCommand != "" && !hasLaunchOpts {
+			// The environment command carries its own RIDE_INIT, so a picked port would never reach it.
+			return cfg, errors.New("rideAddr auto cannot be used with DYALOG_RIDE_LAUNCH; set rideAddr (or DYALOG_RIDE_ADDR) to the address it serves, or use dyalogBin")
+		}
+		hasLaunchOpts = true
+	}
+	if hasLaunchOpts {
+		if cfg.LaunchCommand != "" && explicitLaunchSetting {
+			return cfg, errors.New("rideLaunchCommand cannot be combined with dyalogBin/workspace/args/env/cwd/configFile/maxws")
 		}
-		cfg.LaunchCommand = command
 		explicitLaunchSetting = true
+		if requestCommand == "launch" && cfg.RideAddr != "" {
+			launchOpts.Connect = cfg.Listen
+			spec, err := harness.DyalogLaunchSpec(cfg.RideAddr, launchOpts)
+			if err != nil {
+				return cfg, err
+			}
+			cfg.Launch = &spec
+			cfg.LaunchCommand = ""
+		}
 	}
 
 	if requestCommand == "attach" {
 		if explicitLaunchSetting {
-			return cfg, errors.New("attach does not support adapter-owned launch; use launch request for rideLaunchCommand/dyalogBin")
+			return cfg, errors.New("attach does not support adapter-owned launch; use launch request for rideLaunchCommand/dyalogBin/workspace/args/env/cwd/configFile/maxws")
 		}
 		// Attach is connect-only and must not inherit process ownership from environment launch settings.
 		cfg.LaunchCommand = ""
@@ -73,3 +130,321 @@ func FromRequest(requestCommand string, arguments any) (harness.Config, error) {
 	}
 	return cfg, nil
 }
+
+// Limits holds the per-session evaluate/locals timeouts and value size limits read from
+// launch/attach arguments. Zero fields were not set and keep the adapter's defaults.
+type Limits struct {
+	EvaluateTimeout           time.Duration
+	LocalsFetchTimeout        time.Duration
+	MaxLocalValuePreviewRunes int
+	MaxLocalValueChildren     int
+	MaxLocalSymbolsPerFrame   int
+}
+
+// PathMapping relates a source root on the interpreter's machine (RemoteRoot) to the same
+// tree on the client's (LocalRoot).
+type PathMapping struct {
+	LocalRoot  string
+	RemoteRoot string
+}
+
+// LimitsFromRequest reads the per-session evaluate/locals timeouts and value size limits
+// from launch/attach arguments. Unset fields are left zero.
+func LimitsFromRequest(arguments any) (Limits, error) {
+	var limits Limits
+	argsMap, ok := arguments.(map[string]any)
+	if !ok {
+		return limits, nil
+	}
+
+	for _, field := range []struct {
+		key    string
+		target *time.Duration
+	}{
+		{"evaluateTimeout", &limits.EvaluateTimeout},
+		{"localsFetchTimeout", &limits.LocalsFetchTimeout},
+	} {
+		value, exists := argsMap[field.key]
+		if !exists {
+			continue
+		}
+		timeout, err := positiveDurationFrom(value)
+		if err != nil {
+			return limits, fmt.Errorf("invalid %s %v: %w", field.key, value, err)
+		}
+		*field.target = timeout
+	}
+
+	for _, field := range []struct {
+		key    string
+		target *int
+	}{
+		{"maxLocalValuePreviewRunes", &limits.MaxLocalValuePreviewRunes},
+		{"maxLocalValueChildren", &limits.MaxLocalValueChildren},
+		{"maxLocalSymbolsPerFrame", &limits.MaxLocalSymbolsPerFrame},
+	} {
+		value, exists := argsMap[field.key]
+		if !exists {
+			continue
+		}
+		n, ok := decode.IntFromTextOrNumber(value)
+		if !ok || n <= 0 {
+			return limits, fmt.Errorf("invalid %s %v: expected positive integer", field.key, value)
+		}
+		*field.target = n
+	}
+	return limits, nil
+}
+
+// HoverAllowlistFromRequest reads hoverAllowlist: extra expressions, such as ⎕ names or
+// dotted references, that hover evaluate may inspect despite the side-effect guard.
+func HoverAllowlistFromRequest(arguments any) ([]string, error) {
+	argsMap, ok := arguments.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	value, exists := argsMap["hoverAllowlist"]
+	if !exists {
+		return nil, nil
+	}
+	items, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid hoverAllowlist %v: expected array of strings", value)
+	}
+	allowlist := make([]string, 0, len(items))
+	for _, item := range items {
+		text, ok := decode.NonEmptyTrimmedString(item)
+		if !ok {
+			return nil, fmt.Errorf("invalid hoverAllowlist entry %v: expected non-empty string", item)
+		}
+		allowlist = append(allowlist, text)
+	}
+	return allowlist, nil
+}
+
+// PathMappingsFromRequest reads pathMappings: {localRoot, remoteRoot} pairs relating
+// interpreter paths to the client's, for remote or containerised interpreters.
+func PathMappingsFromRequest(arguments any) ([]PathMapping, error) {
+	argsMap, ok := arguments.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	value, exists := argsMap["pathMappings"]
+	if !exists {
+		return nil, nil
+	}
+	items, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid pathMappings %v: expected array of {localRoot, remoteRoot}", value)
+	}
+	mappings := make([]PathMapping, 0, len(items))
+	for _, item := range items {
+		entry, _ := item.(map[string]any)
+		localRoot, hasLocal := decode.NonEmptyTrimmedStringFromMap(entry, "localRoot")
+		remoteRoot, hasRemote := decode.NonEmptyTrimmedStringFromMap(entry, "remoteRoot")
+		if !hasLocal || !hasRemote {
+			return nil, fmt.Errorf("invalid pathMappings entry %v: expected non-empty localRoot and remoteRoot", item)
+		}
+		mappings = append(mappings, PathMapping{LocalRoot: localRoot, RemoteRoot: remoteRoot})
+	}
+	return mappings, nil
+}
+
+// ReplDisplayFromRequest reads replDisplay: plain (the default), boxed or json.
+func ReplDisplayFromRequest(arguments any) (string, error) {
+	argsMap, ok := arguments.(map[string]any)
+	if !ok {
+		return "plain", nil
+	}
+	mode, ok := decode.NonEmptyTrimmedStringFromMap(argsMap, "replDisplay")
+	if !ok {
+		return "plain", nil
+	}
+	switch mode {
+	case "plain", "boxed", "json":
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid replDisplay %q: expected plain, boxed or json", mode)
+	}
+}
+
+// DialogPolicyFromRequest reads dialogPolicy: prompt (the default), cancel or default.
+func DialogPolicyFromRequest(arguments any) (string, error) {
+	argsMap, ok := arguments.(map[string]any)
+	if !ok {
+		return "prompt", nil
+	}
+	policy, ok := decode.NonEmptyTrimmedStringFromMap(argsMap, "dialogPolicy")
+	if !ok {
+		return "prompt", nil
+	}
+	switch policy {
+	case "prompt", "cancel", "default":
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid dialogPolicy %q: expected prompt, cancel or default", policy)
+	}
+}
+
+// durationFrom accepts a Go duration string (for example 500ms) or a number of milliseconds.
+func durationFrom(value any) (time.Duration, error) {
+	if text, ok := value.(string); ok {
+		return time.ParseDuration(strings.TrimSpace(text))
+	}
+	ms, ok := decode.Int(value)
+	if !ok {
+		return 0, errors.New("expected duration string or milliseconds")
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// positiveDurationFrom is durationFrom restricted to durations above zero.
+func positiveDurationFrom(value any) (time.Duration, error) {
+	timeout, err := durationFrom(value)
+	if err != nil {
+		return 0, err
+	}
+	if timeout <= 0 {
+		return 0, errors.New("must be positive")
+	}
+	return timeout, nil
+}
+
+func applyTLSSettings(cfg *harness.Config, argsMap map[string]any) error {
+	if value, exists := argsMap["rideTls"]; exists {
+		enabled, ok := decode.Bool(value)
+		if !ok {
+			return fmt.Errorf("invalid rideTls %v: expected boolean", value)
+		}
+		cfg.TLS.Enabled = enabled
+	}
+	if caFile, ok := decode.NonEmptyTrimmedStringFromMap(argsMap, "rideCaFile"); ok {
+		cfg.TLS.CAFile = caFile
+	}
+	if certFile, ok := decode.NonEmptyTrimmedStringFromMap(argsMap, "rideCertFile"); ok {
+		cfg.TLS.CertFile = certFile
+	}
+	if keyFile, ok := decode.NonEmptyTrimmedStringFromMap(argsMap, "rideKeyFile"); ok {
+		cfg.TLS.KeyFile = keyFile
+	}
+	if serverName, ok := decode.NonEmptyTrimmedStringFromMap(argsMap, "rideServerName"); ok {
+		cfg.TLS.ServerName = serverName
+	}
+	if value, exists := argsMap["rideInsecureSkipVerify"]; exists {
+		skip, ok := decode.Bool(value)
+		if !ok {
+			return fmt.Errorf("invalid rideInsecureSkipVerify %v: expected boolean", value)
+		}
+		cfg.TLS.InsecureSkipVerify = skip
+	}
+
+	if !cfg.TLS.Enabled {
+		if cfg.TLS.CAFile != "" || cfg.TLS.CertFile != "" || cfg.TLS.KeyFile != "" ||
+			cfg.TLS.ServerName != "" || cfg.TLS.InsecureSkipVerify {
+			return errors.New("rideCaFile/rideCertFile/rideKeyFile/rideServerName/rideInsecureSkipVerify require rideTls: true")
+		}
+		return nil
+	}
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		return errors.New("rideCertFile and rideKeyFile must be set together")
+	}
+	return nil
+}
+
+// maxwsPattern matches Dyalog MAXWS values: a size with an optional K/M/G/T unit suffix.
+var maxwsPattern = regexp.MustCompile(`^[0-9]+[KkMmGgTt]?$`)
+
+// dyalogLaunchOptionsFrom reads the structured interpreter launch fields. The second result
+// reports whether any of them were present.
+func dyalogLaunchOptionsFrom(argsMap map[string]any) (harness.DyalogLaunchOptions, bool, error) {
+	var opts harness.DyalogLaunchOptions
+	present := false
+	for _, key := range []string{"dyalogBin", "workspace", "args", "env", "cwd", "configFile", "maxws"} {
+		if _, exists := argsMap[key]; exists {
+			present = true
+			break
+		}
+	}
+	if !present {
+		return opts, false, nil
+	}
+
+	if dyalogBin, ok := decode.NonEmptyTrimmedStringFromMap(argsMap, "dyalogBin"); ok {
+		opts.Executable = dyalogBin
+	}
+	if workspace, ok := decode.NonEmptyTrimmedStringFromMap(argsMap, "workspace"); ok {
+		opts.Workspace = workspace
+	}
+	if value, exists := argsMap["args"]; exists {
+		items, ok := value.([]any)
+		if !ok {
+			return opts, true, fmt.Errorf("invalid args %v: expected array of strings", value)
+		}
+		for _, item := range items {
+			arg, ok := item.(string)
+			if !ok {
+				return opts, true, fmt.Errorf("invalid args entry %v: expected string", item)
+			}
+			opts.Args = append(opts.Args, arg)
+		}
+	}
+	if value, exists := argsMap["env"]; exists {
+		entries, ok := value.(map[string]any)
+		if !ok {
+			return opts, true, fmt.Errorf("invalid env %v: expected object of strings", value)
+		}
+		opts.Env = make(map[string]string, len(entries))
+		for key, entry := range entries {
+			if key == "" || strings.ContainsAny(key, "=\x00") {
+				return opts, true, fmt.Errorf("invalid env name %q", key)
+			}
+			text, ok := entry.(string)
+			if !ok {
+				return opts, true, fmt.Errorf("invalid env %s value %v: expected string", key, entry)
+			}
+			opts.Env[key] = text
+		}
+	}
+	if cwd, ok := decode.NonEmptyTrimmedStringFromMap(argsMap, "cwd"); ok {
+		info, err := os.Stat(cwd)
+		if err != nil {
+			return opts, true, fmt.Errorf("invalid cwd %q: %w", cwd, err)
+		}
+		if !info.IsDir() {
+			return opts, true, fmt.Errorf("invalid cwd %q: not a directory", cwd)
+		}
+		opts.Cwd = cwd
+	}
+	if configFile, ok := decode.NonEmptyTrimmedStringFromMap(argsMap, "configFile"); ok {
+		path := configFile
+		if !filepath.IsAbs(path) && opts.Cwd != "" {
+			path = filepath.Join(opts.Cwd, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return opts, true, fmt.Errorf("invalid configFile %q: %w", configFile, err)
+		}
+		opts.ConfigFile = configFile
+	}
+	if value, exists := argsMap["maxws"]; exists {
+		maxws, err := maxwsFrom(value)
+		if err != nil {
+			return opts, true, err
+		}
+		opts.MaxWS = maxws
+	}
+	return opts, true, nil
+}
+
+func maxwsFrom(value any) (string, error) {
+	if n, ok := decode.Int(value); ok {
+		if n <= 0 {
+			return "", fmt.Errorf("invalid maxws %v: expected positive size", value)
+		}
+		return strconv.Itoa(n), nil
+	}
+	text, _ := decode.NonEmptyTrimmedString(value)
+	if !maxwsPattern.MatchString(text) {
+		return "", fmt.Errorf("invalid maxws %v: expected size such as 256M or 4G", value)
+	}
+	return text, nil
+}
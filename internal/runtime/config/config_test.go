@@ -1,8 +1,13 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/stefan/lsp-dap/internal/integration/harness"
 )
 
 func TestFromRequest_AttachClearsEnvLaunchCommand(t *testing.T) {
@@ -31,3 +36,356 @@ func TestFromRequest_AttachRejectsExplicitLaunchSettings(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestFromRequest_ParsesRideReconnectTimeout(t *testing.T) {
+	t.Setenv("DYALOG_RIDE_ADDR", "127.0.0.1:4502")
+
+	cfg, err := FromRequest("attach", map[string]any{
+		"rideReconnectTimeout": "0s",
+	})
+	if err != nil {
+		t.Fatalf("FromRequest failed: %v", err)
+	}
+	if cfg.ReconnectTimeout != 0 {
+		t.Fatalf("expected reconnect to be disabled, got %s", cfg.ReconnectTimeout)
+	}
+
+	cfg, err = FromRequest("attach", map[string]any{
+		"rideReconnectTimeout": float64(1500),
+	})
+	if err != nil {
+		t.Fatalf("FromRequest with milliseconds failed: %v", err)
+	}
+	if cfg.ReconnectTimeout != 1500*time.Millisecond {
+		t.Fatalf("expected 1.5s reconnect timeout, got %s", cfg.ReconnectTimeout)
+	}
+
+	for _, value := range []any{"soon", "-1s", float64(-5), true} {
+		if _, err := FromRequest("attach", map[string]any{"rideReconnectTimeout": value}); err == nil {
+			t.Fatalf("expected invalid rideReconnectTimeout %v to fail", value)
+		}
+	}
+}
+
+func TestFromRequest_ParsesRideTLSSettings(t *testing.T) {
+	cfg, err := FromRequest("attach", map[string]any{
+		"rideAddr":               "ride.example.com:4502",
+		"rideTls":                true,
+		"rideCaFile":             "/etc/ride/ca.pem",
+		"rideCertFile":           "/etc/ride/client.pem",
+		"rideKeyFile":            "/etc/ride/client.key",
+		"rideServerName":         "ride.internal",
+		"rideInsecureSkipVerify": false,
+	})
+	if err != nil {
+		t.Fatalf("FromRequest failed: %v", err)
+	}
+	if !cfg.TLS.Enabled || cfg.TLS.CAFile != "/etc/ride/ca.pem" || cfg.TLS.ServerName != "ride.internal" {
+		t.Fatalf("unexpected TLS config: %#v", cfg.TLS)
+	}
+	if cfg.TLS.CertFile != "/etc/ride/client.pem" || cfg.TLS.KeyFile != "/etc/ride/client.key" {
+		t.Fatalf("unexpected TLS client certificate config: %#v", cfg.TLS)
+	}
+}
+
+func TestFromRequest_RejectsInconsistentRideTLSSettings(t *testing.T) {
+	cases := map[string]map[string]any{
+		"tls option without rideTls": {"rideCaFile": "/etc/ride/ca.pem"},
+		"cert without key":           {"rideTls": true, "rideCertFile": "/etc/ride/client.pem"},
+		"non-boolean rideTls":        {"rideTls": "yes"},
+	}
+	for name, args := range cases {
+		args["rideAddr"] = "127.0.0.1:4502"
+		if _, err := FromRequest("attach", args); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestFromRequest_RideListenBuildsConnectLaunchCommand(t *testing.T) {
+	t.Setenv("DYALOG_RIDE_LAUNCH", "")
+
+	cfg, err := FromRequest("launch", map[string]any{
+		"rideAddr":   "127.0.0.1:4600",
+		"rideListen": true,
+		"dyalogBin":  "dyalog",
+	})
+	if err != nil {
+		t.Fatalf("FromRequest failed: %v", err)
+	}
+	if !cfg.Listen {
+		t.Fatal("expected listen mode")
+	}
+	if cfg.Launch == nil || cfg.Launch.Env["RIDE_INIT"] != "CONNECT:127.0.0.1:4600" {
+		t.Fatalf("unexpected launch spec: %#v", cfg.Launch)
+	}
+
+	if _, err := FromRequest("attach", map[string]any{
+		"rideAddr":   "127.0.0.1:4600",
+		"rideListen": true,
+		"rideTls":    true,
+	}); err == nil {
+		t.Fatal("expected rideListen with rideTls to fail")
+	}
+}
+
+func TestFromRequest_BuildsDirectLaunchSpec(t *testing.T) {
+	t.Setenv("DYALOG_RIDE_LAUNCH", "RIDE_INIT=SERVE:*:4502 dyalog +s -q")
+	cwd := t.TempDir()
+	if err := os.WriteFile(filepath.Join(cwd, "dyalog.dcfg"), []byte("{}"), 0o644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	cfg, err := FromRequest("launch", map[string]any{
+		"rideAddr":   "127.0.0.1:4502",
+		"dyalogBin":  "/opt/mdyalog/19.0/64/unicode/dyalog",
+		"workspace":  "/work/My App.dws",
+		"args":       []any{"DEBUG=1", "it's fine"},
+		"env":        map[string]any{"WSPATH": "/work", "RIDE_INIT": "SERVE:*:9999"},
+		"cwd":        cwd,
+		"configFile": "dyalog.dcfg",
+		"maxws":      "4G",
+	})
+	if err != nil {
+		t.Fatalf("FromRequest failed: %v", err)
+	}
+	if cfg.LaunchCommand != "" {
+		t.Fatalf("expected structured launch to replace env launch command, got %q", cfg.LaunchCommand)
+	}
+	spec := cfg.Launch
+	if spec == nil {
+		t.Fatal("expected launch spec")
+	}
+	if spec.Executable != "/opt/mdyalog/19.0/64/unicode/dyalog" || spec.Dir != cwd {
+		t.Fatalf("unexpected executable/dir: %#v", spec)
+	}
+	wantArgs := []string{"+s", "-q", "DEBUG=1", "it's fine"}
+	if strings.Join(spec.Args, "|") != strings.Join(wantArgs, "|") {
+		t.Fatalf("unexpected args: %#v", spec.Args)
+	}
+	wantEnv := map[string]string{
+		"RIDE_INIT":  "SERVE:*:4502",
+		"LOAD":       "/work/My App.dws",
+		"CONFIGFILE": "dyalog.dcfg",
+		"MAXWS":      "4G",
+		"WSPATH":     "/work",
+	}
+	for key, want := range wantEnv {
+		if spec.Env[key] != want {
+			t.Fatalf("env %s: got %q, want %q", key, spec.Env[key], want)
+		}
+	}
+}
+
+func TestFromRequest_RejectsInvalidLaunchFields(t *testing.T) {
+	t.Setenv("DYALOG_RIDE_LAUNCH", "")
+	file := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	cases := map[string]map[string]any{
+		"args not array":     {"args": "-x"},
+		"args non-string":    {"args": []any{"a", 1}},
+		"env not object":     {"env": []any{"A=1"}},
+		"env non-string":     {"env": map[string]any{"A": 1}},
+		"env bad name":       {"env": map[string]any{"A=B": "1"}},
+		"cwd missing":        {"cwd": filepath.Join(file, "missing")},
+		"cwd not dir":        {"cwd": file},
+		"configFile missing": {"configFile": filepath.Join(t.TempDir(), "none.dcfg")},
+		"maxws bad unit":     {"maxws": "4X"},
+		"maxws negative":     {"maxws": -1},
+		"combined launch":    {"rideLaunchCommand": "dyalog", "workspace": "app"},
+	}
+	for name, args := range cases {
+		args["rideAddr"] = "127.0.0.1:4502"
+		if _, err := FromRequest("launch", args); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	if _, err := FromRequest("attach", map[string]any{
+		"rideAddr":  "127.0.0.1:4502",
+		"workspace": "app",
+	}); err == nil {
+		t.Fatal("expected attach with workspace to fail")
+	}
+}
+
+func TestFromRequest_AutoRideAddrForAdapterOwnedLaunch(t *testing.T) {
+	t.Setenv("DYALOG_RIDE_ADDR", "")
+	t.Setenv("DYALOG_RIDE_LAUNCH", "")
+
+	for name, args := range map[string]map[string]any{
+		"omitted":  {},
+		"explicit": {"rideAddr": "auto", "dyalogBin": "/opt/dyalog"},
+	} {
+		cfg, err := FromRequest("launch", args)
+		if err != nil {
+			t.Fatalf("%s: FromRequest failed: %v", name, err)
+		}
+		if cfg.RideAddr != harness.AutoRideAddr {
+			t.Fatalf("%s: expected auto rideAddr, got %q", name, cfg.RideAddr)
+		}
+		if cfg.Launch == nil || cfg.Launch.Executable == "" {
+			t.Fatalf("%s: expected adapter-owned launch spec, got %#v", name, cfg.Launch)
+		}
+		if _, ok := cfg.Launch.Env["RIDE_INIT"]; ok {
+			t.Fatalf("%s: expected RIDE_INIT to be left for the harness, got %#v", name, cfg.Launch.Env)
+		}
+	}
+
+	if _, err := FromRequest("attach", map[string]any{"rideAddr": "auto"}); err == nil {
+		t.Fatal("expected attach with rideAddr auto to fail")
+	}
+	if _, err := FromRequest("launch", map[string]any{
+		"rideAddr":          "auto",
+		"rideLaunchCommand": "dyalog",
+	}); err == nil {
+		t.Fatal("expected rideAddr auto with rideLaunchCommand to fail")
+	}
+}
+
+func TestFromRequest_AutoRideAddrDoesNotReplaceEnvLaunchCommand(t *testing.T) {
+	t.Setenv("DYALOG_RIDE_ADDR", "")
+	t.Setenv("DYALOG_RIDE_LAUNCH", "RIDE_INIT=SERVE:*:4502 dyalog +s -q")
+
+	for name, args := range map[string]map[string]any{
+		"omitted":  {},
+		"explicit": {"rideAddr": "auto"},
+	} {
+		_, err := FromRequest("launch", args)
+		if err == nil {
+			t.Fatalf("%s: expected DYALOG_RIDE_LAUNCH without rideAddr to fail", name)
+		}
+		if !strings.Contains(err.Error(), "DYALOG_RIDE_LAUNCH") {
+			t.Fatalf("%s: expected error to name DYALOG_RIDE_LAUNCH, got %v", name, err)
+		}
+	}
+
+	cfg, err := FromRequest("launch", map[string]any{"rideAddr": "127.0.0.1:4502"})
+	if err != nil {
+		t.Fatalf("FromRequest failed: %v", err)
+	}
+	if cfg.LaunchCommand != "RIDE_INIT=SERVE:*:4502 dyalog +s -q" || cfg.Launch != nil {
+		t.Fatalf("expected env launch command to be kept, got %q / %#v", cfg.LaunchCommand, cfg.Launch)
+	}
+
+	// Explicit launch fields still take precedence over the environment command.
+	cfg, err = FromRequest("launch", map[string]any{"dyalogBin": "/opt/dyalog"})
+	if err != nil {
+		t.Fatalf("FromRequest with dyalogBin failed: %v", err)
+	}
+	if cfg.RideAddr != harness.AutoRideAddr || cfg.Launch == nil || cfg.LaunchCommand != "" {
+		t.Fatalf("expected dyalogBin to launch on an auto port, got %#v", cfg)
+	}
+}
+
+func TestLimitsFromRequest_ParsesTimeoutsAndSizeLimits(t *testing.T) {
+	limits, err := LimitsFromRequest(map[string]any{
+		"evaluateTimeout":           "5s",
+		"localsFetchTimeout":        float64(750),
+		"maxLocalValuePreviewRunes": float64(120),
+		"maxLocalValueChildren":     "48",
+		"maxLocalSymbolsPerFrame":   float64(256),
+	})
+	if err != nil {
+		t.Fatalf("LimitsFromRequest failed: %v", err)
+	}
+	want := Limits{
+		EvaluateTimeout:           5 * time.Second,
+		LocalsFetchTimeout:        750 * time.Millisecond,
+		MaxLocalValuePreviewRunes: 120,
+		MaxLocalValueChildren:     48,
+		MaxLocalSymbolsPerFrame:   256,
+	}
+	if limits != want {
+		t.Fatalf("unexpected limits: %#v", limits)
+	}
+
+	defaults, err := LimitsFromRequest(map[string]any{"rideAddr": "127.0.0.1:4502"})
+	if err != nil {
+		t.Fatalf("LimitsFromRequest failed: %v", err)
+	}
+	if defaults != (Limits{}) {
+		t.Fatalf("expected unset limits left zero for the adapter defaults, got %#v", defaults)
+	}
+
+	for _, args := range []map[string]any{
+		{"evaluateTimeout": "soon"},
+		{"localsFetchTimeout": "0s"},
+		{"maxLocalSymbolsPerFrame": float64(0)},
+		{"maxLocalValueChildren": "many"},
+	} {
+		if _, err := LimitsFromRequest(args); err == nil {
+			t.Fatalf("expected %v to be rejected", args)
+		}
+	}
+}
+
+func TestHoverAllowlistFromRequest_ReadsStringArray(t *testing.T) {
+	allowlist, err := HoverAllowlistFromRequest(map[string]any{
+		"hoverAllowlist": []any{"⎕NNUMS", " cfg.Name "},
+	})
+	if err != nil {
+		t.Fatalf("HoverAllowlistFromRequest failed: %v", err)
+	}
+	if len(allowlist) != 2 || allowlist[0] != "⎕NNUMS" || allowlist[1] != "cfg.Name" {
+		t.Fatalf("unexpected allowlist: %#v", allowlist)
+	}
+
+	for _, value := range []any{"⎕NNUMS", []any{"ok", float64(3)}, []any{" "}} {
+		if _, err := HoverAllowlistFromRequest(map[string]any{"hoverAllowlist": value}); err == nil {
+			t.Fatalf("expected hoverAllowlist %v to be rejected", value)
+		}
+	}
+}
+
+func TestReplDisplayFromRequest_ValidatesMode(t *testing.T) {
+	if mode, err := ReplDisplayFromRequest(map[string]any{}); err != nil || mode != "plain" {
+		t.Fatalf("expected plain default, got %q (%v)", mode, err)
+	}
+	if mode, err := ReplDisplayFromRequest(map[string]any{"replDisplay": "json"}); err != nil || mode != "json" {
+		t.Fatalf("expected json mode, got %q (%v)", mode, err)
+	}
+	if _, err := ReplDisplayFromRequest(map[string]any{"replDisplay": "fancy"}); err == nil {
+		t.Fatal("expected unknown replDisplay to be rejected")
+	}
+}
+
+func TestDialogPolicyFromRequest_ValidatesPolicy(t *testing.T) {
+	if policy, err := DialogPolicyFromRequest(map[string]any{}); err != nil || policy != "prompt" {
+		t.Fatalf("expected prompt default, got %q (%v)", policy, err)
+	}
+	if policy, err := DialogPolicyFromRequest(map[string]any{"dialogPolicy": "cancel"}); err != nil || policy != "cancel" {
+		t.Fatalf("expected cancel policy, got %q (%v)", policy, err)
+	}
+	if _, err := DialogPolicyFromRequest(map[string]any{"dialogPolicy": "ask"}); err == nil {
+		t.Fatal("expected unknown dialogPolicy to be rejected")
+	}
+}
+
+func TestPathMappingsFromRequest_ReadsAndValidatesEntries(t *testing.T) {
+	mappings, err := PathMappingsFromRequest(map[string]any{
+		"pathMappings": []any{
+			map[string]any{"localRoot": "/home/me/app", "remoteRoot": "C:\\apps\\app"},
+			map[string]any{"localRoot": "/home/me/lib", "remoteRoot": "/opt/lib"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []PathMapping{
+		{LocalRoot: "/home/me/app", RemoteRoot: "C:\\apps\\app"},
+		{LocalRoot: "/home/me/lib", RemoteRoot: "/opt/lib"},
+	}
+	if len(mappings) != len(want) || mappings[0] != want[0] || mappings[1] != want[1] {
+		t.Fatalf("unexpected mappings: %#v", mappings)
+	}
+	if _, err := PathMappingsFromRequest(map[string]any{"pathMappings": []any{map[string]any{"localRoot": "/x"}}}); err == nil {
+		t.Fatal("expected entry without remoteRoot to be rejected")
+	}
+	if _, err := PathMappingsFromRequest(map[string]any{"pathMappings": "/x:/y"}); err == nil {
+		t.Fatal("expected non-array pathMappings to be rejected")
+	}
+}
@@ -40,6 +40,9 @@ const contracts_1 = require("./contracts");
 const supportCommands_1 = require("./commands/supportCommands");
 const setupCommands_1 = require("./commands/setupCommands");
 const descriptorFactory_1 = require("./debug/descriptorFactory");
+const dialogs_1 = require("./debug/dialogs");
+const virtualDocuments_1 = require("./debug/virtualDocuments");
+const trackerFactory_1 = require("./debug/trackerFactory");
 const logger_1 = require("./diagnostics/logger");
 function activate(context) {
     const output = vscode.window.createOutputChannel("Dyalog DAP");
@@ -73,6 +76,9 @@ function activate(context) {
         }
     });
     const descriptorFactory = vscode.debug.registerDebugAdapterDescriptorFactory("dyalog-dap", (0, descriptorFactory_1.createAdapterDescriptorFactory)(output, diagnostics));
-    context.subscriptions.push(setupLaunchCommand, validateAdapterPathCommand, validateRideAddrCommand, toggleDiagnosticsVerboseCommand, generateDiagnosticBundleCommand, installAdapterCommand, configProvider, descriptorFactory);
+    const trackerFactory = vscode.debug.registerDebugAdapterTrackerFactory("dyalog-dap", (0, trackerFactory_1.createSessionTrackerFactory)(output, diagnostics));
+    const dialogHandler = (0, dialogs_1.registerDialogHandler)(output, diagnostics);
+    const virtualDocuments = (0, virtualDocuments_1.registerVirtualDocumentProvider)();
+    context.subscriptions.push(setupLaunchCommand, validateAdapterPathCommand, validateRideAddrCommand, toggleDiagnosticsVerboseCommand, generateDiagnosticBundleCommand, installAdapterCommand, configProvider, descriptorFactory, trackerFactory, dialogHandler, virtualDocuments);
 }
 function deactivate() { }
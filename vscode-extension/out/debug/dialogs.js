@@ -0,0 +1,75 @@
+"use strict";
+var __createBinding = (this && this.__createBinding) || (Object.create ? (function(o, m, k, k2) {
+    if (k2 === undefined) k2 = k;
+    var desc = Object.getOwnPropertyDescriptor(m, k);
+    if (!desc || ("get" in desc ? !m.__esModule : desc.writable || desc.configurable)) {
+      desc = { enumerable: true, get: function() { return m[k]; } };
+    }
+    Object.defineProperty(o, k2, desc);
+}) : (function(o, m, k, k2) {
+    if (k2 === undefined) k2 = k;
+    o[k2] = m[k];
+}));
+var __setModuleDefault = (this && this.__setModuleDefault) || (Object.create ? (function(o, v) {
+    Object.defineProperty(o, "default", { enumerable: true, value: v });
+}) : function(o, v) {
+    o["default"] = v;
+});
+var __importStar = (this && this.__importStar) || (function () {
+    var ownKeys = function(o) {
+        ownKeys = Object.getOwnPropertyNames || function (o) {
+            var ar = [];
+            for (var k in o) if (Object.prototype.hasOwnProperty.call(o, k)) ar[ar.length] = k;
+            return ar;
+        };
+        return ownKeys(o);
+    };
+    return function (mod) {
+        if (mod && mod.__esModule) return mod;
+        var result = {};
+        if (mod != null) for (var k = ownKeys(mod), i = 0; i < k.length; i++) if (k[i] !== "default") __createBinding(result, mod, k[i]);
+        __setModuleDefault(result, mod);
+        return result;
+    };
+})();
+Object.defineProperty(exports, "__esModule", { value: true });
+exports.registerDialogHandler = registerDialogHandler;
+const vscode = __importStar(require("vscode"));
+const logger_1 = require("../diagnostics/logger");
+const dialogChoices_1 = require("../dialogChoices");
+// registerDialogHandler answers the adapter's dyalog/dialog events, which the interpreter blocks on.
+function registerDialogHandler(output, diagnostics) {
+    return vscode.debug.onDidReceiveDebugSessionCustomEvent(async (event) => {
+        if (event.session.type !== "dyalog-dap" || event.event !== "dyalog/dialog") {
+            return;
+        }
+        const dialog = event.body;
+        const reply = await promptDialog(dialog);
+        try {
+            await event.session.customRequest("dyalog/replyDialog", reply);
+        }
+        catch (err) {
+            (0, logger_1.logDiagnostic)(output, diagnostics, "error", "session.dialog.replyFailed", {
+                token: dialog.token,
+                error: err instanceof Error ? err.message : String(err)
+            });
+        }
+    });
+}
+async function promptDialog(dialog) {
+    if (dialog.kind === "string") {
+        const value = await vscode.window.showInputBox({
+            title: dialog.title,
+            prompt: dialog.text,
+            value: dialog.initialValue ?? "",
+            ignoreFocusOut: true
+        });
+        return (0, dialogChoices_1.valueReply)(dialog, value);
+    }
+    const picked = await vscode.window.showQuickPick((0, dialogChoices_1.dialogChoices)(dialog), {
+        title: dialog.title,
+        placeHolder: (0, dialogChoices_1.dialogPlaceholder)(dialog),
+        ignoreFocusOut: true
+    });
+    return (0, dialogChoices_1.choiceReply)(dialog, picked);
+}
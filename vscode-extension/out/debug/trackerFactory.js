@@ -0,0 +1,34 @@
+"use strict";
+Object.defineProperty(exports, "__esModule", { value: true });
+exports.createSessionTrackerFactory = createSessionTrackerFactory;
+exports.resolvedRideAddr = resolvedRideAddr;
+const logger_1 = require("../diagnostics/logger");
+function createSessionTrackerFactory(output, diagnostics) {
+    return {
+        createDebugAdapterTracker() {
+            return {
+                onDidSendMessage(message) {
+                    const rideAddr = resolvedRideAddr(message);
+                    if (rideAddr !== "") {
+                        (0, logger_1.logDiagnostic)(output, diagnostics, "info", "session.rideAddr", { rideAddr });
+                    }
+                }
+            };
+        }
+    };
+}
+// resolvedRideAddr extracts the endpoint the adapter reports after picking a port for rideAddr "auto".
+function resolvedRideAddr(message) {
+    if (!isRecord(message) || message.type !== "event" || message.event !== "output") {
+        return "";
+    }
+    const body = message.body;
+    if (!isRecord(body) || !isRecord(body.data)) {
+        return "";
+    }
+    const rideAddr = body.data.rideAddr;
+    return typeof rideAddr === "string" ? rideAddr : "";
+}
+function isRecord(value) {
+    return !!value && typeof value === "object" && !Array.isArray(value);
+}
@@ -0,0 +1,29 @@
+"use strict";
+// Dialog events and replies exchanged with the adapter's dyalog/dialog and
+// dyalog/replyDialog, kept free of the vscode API so the mapping can be unit tested.
+Object.defineProperty(exports, "__esModule", { value: true });
+exports.dialogChoices = dialogChoices;
+exports.dialogPlaceholder = dialogPlaceholder;
+exports.choiceReply = choiceReply;
+exports.valueReply = valueReply;
+// dialogChoices lists task dialog buttons (answered as 100, 101, ...) before plain options.
+function dialogChoices(dialog) {
+    const choices = [];
+    if (dialog.kind === "task") {
+        (dialog.buttonText ?? []).forEach((label, i) => choices.push({ label, index: 100 + i }));
+    }
+    (dialog.options ?? []).forEach((label, i) => choices.push({ label, index: i }));
+    return choices;
+}
+// dialogPlaceholder joins the dialog's text, subtext and footer for the quick pick.
+function dialogPlaceholder(dialog) {
+    return [dialog.text, dialog.subtext, dialog.footer].filter((part) => !!part).join(" — ");
+}
+// choiceReply answers an options or task dialog; no choice (the pick was dismissed) cancels it.
+function choiceReply(dialog, picked) {
+    return picked === undefined ? { token: dialog.token, cancel: true } : { token: dialog.token, index: picked.index };
+}
+// valueReply answers a string dialog; no value (the input box was dismissed) cancels it.
+function valueReply(dialog, value) {
+    return value === undefined ? { token: dialog.token, cancel: true } : { token: dialog.token, value };
+}
@@ -8,6 +8,9 @@ import {
   runValidateRideAddr
 } from "./commands/setupCommands";
 import { createAdapterDescriptorFactory } from "./debug/descriptorFactory";
+import { registerDialogHandler } from "./debug/dialogs";
+import { registerVirtualDocumentProvider } from "./debug/virtualDocuments";
+import { createSessionTrackerFactory } from "./debug/trackerFactory";
 import { createDiagnosticHistory, logDiagnostic } from "./diagnostics/logger";
 
 export function activate(context: vscode.ExtensionContext): void {
@@ -54,6 +57,12 @@ export function activate(context: vscode.ExtensionContext): void {
     "dyalog-dap",
     createAdapterDescriptorFactory(output, diagnostics)
   );
+  const trackerFactory = vscode.debug.registerDebugAdapterTrackerFactory(
+    "dyalog-dap",
+    createSessionTrackerFactory(output, diagnostics)
+  );
+  const dialogHandler = registerDialogHandler(output, diagnostics);
+  const virtualDocuments = registerVirtualDocumentProvider();
 
   context.subscriptions.push(
     setupLaunchCommand,
@@ -63,7 +72,10 @@ export function activate(context: vscode.ExtensionContext): void {
     generateDiagnosticBundleCommand,
     installAdapterCommand,
     configProvider,
-    descriptorFactory
+    descriptorFactory,
+    trackerFactory,
+    dialogHandler,
+    virtualDocuments
   );
 }
 
@@ -0,0 +1,40 @@
+import * as vscode from "vscode";
+import { logDiagnostic, type DiagnosticHistory } from "../diagnostics/logger";
+import { choiceReply, dialogChoices, dialogPlaceholder, valueReply, type DialogEvent, type DialogReply } from "../dialogChoices";
+
+// registerDialogHandler answers the adapter's dyalog/dialog events, which the interpreter blocks on.
+export function registerDialogHandler(output: vscode.OutputChannel, diagnostics: DiagnosticHistory): vscode.Disposable {
+  return vscode.debug.onDidReceiveDebugSessionCustomEvent(async (event) => {
+    if (event.session.type !== "dyalog-dap" || event.event !== "dyalog/dialog") {
+      return;
+    }
+    const dialog = event.body as DialogEvent;
+    const reply = await promptDialog(dialog);
+    try {
+      await event.session.customRequest("dyalog/replyDialog", reply);
+    } catch (err) {
+      logDiagnostic(output, diagnostics, "error", "session.dialog.replyFailed", {
+        token: dialog.token,
+        error: err instanceof Error ? err.message : String(err)
+      });
+    }
+  });
+}
+
+async function promptDialog(dialog: DialogEvent): Promise<DialogReply> {
+  if (dialog.kind === "string") {
+    const value = await vscode.window.showInputBox({
+      title: dialog.title,
+      prompt: dialog.text,
+      value: dialog.initialValue ?? "",
+      ignoreFocusOut: true
+    });
+    return valueReply(dialog, value);
+  }
+  const picked = await vscode.window.showQuickPick(dialogChoices(dialog), {
+    title: dialog.title,
+    placeHolder: dialogPlaceholder(dialog),
+    ignoreFocusOut: true
+  });
+  return choiceReply(dialog, picked);
+}
@@ -0,0 +1,37 @@
+import * as vscode from "vscode";
+import { logDiagnostic, type DiagnosticHistory } from "../diagnostics/logger";
+
+export function createSessionTrackerFactory(
+  output: vscode.OutputChannel,
+  diagnostics: DiagnosticHistory
+): vscode.DebugAdapterTrackerFactory {
+  return {
+    createDebugAdapterTracker() {
+      return {
+        onDidSendMessage(message: unknown) {
+          const rideAddr = resolvedRideAddr(message);
+          if (rideAddr !== "") {
+            logDiagnostic(output, diagnostics, "info", "session.rideAddr", { rideAddr });
+          }
+        }
+      };
+    }
+  };
+}
+
+// resolvedRideAddr extracts the endpoint the adapter reports after picking a port for rideAddr "auto".
+export function resolvedRideAddr(message: unknown): string {
+  if (!isRecord(message) || message.type !== "event" || message.event !== "output") {
+    return "";
+  }
+  const body = message.body;
+  if (!isRecord(body) || !isRecord(body.data)) {
+    return "";
+  }
+  const rideAddr = body.data.rideAddr;
+  return typeof rideAddr === "string" ? rideAddr : "";
+}
+
+function isRecord(value: unknown): value is Record<string, unknown> {
+  return !!value && typeof value === "object" && !Array.isArray(value);
+}
@@ -0,0 +1,12 @@
+import * as vscode from "vscode";
+import { readVirtualSource } from "../virtualSource";
+
+// registerVirtualDocumentProvider serves dyalog: sources (workspace-only functions such as
+// dyalog:/#/Ns/Fn.aplf) through the active debug session's source request.
+export function registerVirtualDocumentProvider(): vscode.Disposable {
+  return vscode.workspace.registerTextDocumentContentProvider("dyalog", {
+    provideTextDocumentContent(uri: vscode.Uri): Promise<string> {
+      return readVirtualSource(vscode.debug.activeDebugSession, uri);
+    }
+  });
+}
@@ -0,0 +1,43 @@
+// Dialog events and replies exchanged with the adapter's dyalog/dialog and
+// dyalog/replyDialog, kept free of the vscode API so the mapping can be unit tested.
+
+export type DialogEvent = {
+  kind: "options" | "string" | "task";
+  token: number;
+  title?: string;
+  text?: string;
+  subtext?: string;
+  footer?: string;
+  options?: string[];
+  buttonText?: string[];
+  initialValue?: string;
+};
+
+export type DialogChoice = { label: string; index: number };
+
+export type DialogReply = { token: number; index?: number; value?: string; cancel?: boolean };
+
+// dialogChoices lists task dialog buttons (answered as 100, 101, ...) before plain options.
+export function dialogChoices(dialog: DialogEvent): DialogChoice[] {
+  const choices: DialogChoice[] = [];
+  if (dialog.kind === "task") {
+    (dialog.buttonText ?? []).forEach((label, i) => choices.push({ label, index: 100 + i }));
+  }
+  (dialog.options ?? []).forEach((label, i) => choices.push({ label, index: i }));
+  return choices;
+}
+
+// dialogPlaceholder joins the dialog's text, subtext and footer for the quick pick.
+export function dialogPlaceholder(dialog: DialogEvent): string {
+  return [dialog.text, dialog.subtext, dialog.footer].filter((part) => !!part).join(" — ");
+}
+
+// choiceReply answers an options or task dialog; no choice (the pick was dismissed) cancels it.
+export function choiceReply(dialog: DialogEvent, picked: DialogChoice | undefined): DialogReply {
+  return picked === undefined ? { token: dialog.token, cancel: true } : { token: dialog.token, index: picked.index };
+}
+
+// valueReply answers a string dialog; no value (the input box was dismissed) cancels it.
+export function valueReply(dialog: DialogEvent, value: string | undefined): DialogReply {
+  return value === undefined ? { token: dialog.token, cancel: true } : { token: dialog.token, value };
+}
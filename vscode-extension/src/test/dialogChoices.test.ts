@@ -0,0 +1,43 @@
+import test from "node:test";
+import assert from "node:assert/strict";
+import { choiceReply, dialogChoices, dialogPlaceholder, valueReply, type DialogEvent } from "../dialogChoices";
+
+test("dialogChoices maps options to their zero-based index", () => {
+  const dialog: DialogEvent = { kind: "options", token: 7, options: ["Yes", "No"] };
+  assert.deepEqual(dialogChoices(dialog), [
+    { label: "Yes", index: 0 },
+    { label: "No", index: 1 }
+  ]);
+});
+
+test("dialogChoices lists task buttons from 100 before options", () => {
+  const dialog: DialogEvent = { kind: "task", token: 3, buttonText: ["Save", "Discard"], options: ["Details"] };
+  assert.deepEqual(dialogChoices(dialog), [
+    { label: "Save", index: 100 },
+    { label: "Discard", index: 101 },
+    { label: "Details", index: 0 }
+  ]);
+});
+
+test("dialogChoices ignores button text outside task dialogs", () => {
+  const dialog: DialogEvent = { kind: "options", token: 1, buttonText: ["Stray"], options: ["Ok"] };
+  assert.deepEqual(dialogChoices(dialog), [{ label: "Ok", index: 0 }]);
+});
+
+test("dialogPlaceholder joins the non-empty text parts", () => {
+  assert.equal(dialogPlaceholder({ kind: "task", token: 1, text: "Save?", footer: "unsaved" }), "Save? — unsaved");
+  assert.equal(dialogPlaceholder({ kind: "options", token: 1 }), "");
+});
+
+test("choiceReply sends the picked index or cancels when dismissed", () => {
+  const dialog: DialogEvent = { kind: "task", token: 9, buttonText: ["Save"] };
+  const [save] = dialogChoices(dialog);
+  assert.deepEqual(choiceReply(dialog, save), { token: 9, index: 100 });
+  assert.deepEqual(choiceReply(dialog, undefined), { token: 9, cancel: true });
+});
+
+test("valueReply sends the entered value or cancels when dismissed", () => {
+  const dialog: DialogEvent = { kind: "string", token: 4, initialValue: "x" };
+  assert.deepEqual(valueReply(dialog, ""), { token: 4, value: "" });
+  assert.deepEqual(valueReply(dialog, undefined), { token: 4, cancel: true });
+});
@@ -0,0 +1,38 @@
+import test from "node:test";
+import assert from "node:assert/strict";
+import { readVirtualSource, type SourceSession } from "../virtualSource";
+
+const uri = {
+  toString(skipEncoding?: boolean): string {
+    return skipEncoding ? "dyalog:/#/Ns/Fn.aplf" : "dyalog:/%23/Ns/Fn.aplf";
+  }
+};
+
+test("readVirtualSource requests the encoded URI as the source path", async () => {
+  const seen: Array<{ command: string; args: unknown }> = [];
+  const session: SourceSession = {
+    type: "dyalog-dap",
+    async customRequest(command, args) {
+      seen.push({ command, args });
+      return { content: "r←Fn\nr←1" };
+    }
+  };
+  assert.equal(await readVirtualSource(session, uri), "r←Fn\nr←1");
+  assert.deepEqual(seen, [{ command: "source", args: { source: { path: "dyalog:/%23/Ns/Fn.aplf" } } }]);
+});
+
+test("readVirtualSource returns empty text when the body has no content", async () => {
+  const session: SourceSession = { type: "dyalog-dap", customRequest: async () => undefined };
+  assert.equal(await readVirtualSource(session, uri), "");
+});
+
+test("readVirtualSource rejects without a dyalog-dap session", async () => {
+  await assert.rejects(readVirtualSource(undefined, uri), /No active Dyalog debug session to read dyalog:\/#\/Ns\/Fn\.aplf/);
+  const other: SourceSession = {
+    type: "node",
+    customRequest: async () => {
+      throw new Error("should not be called");
+    }
+  };
+  await assert.rejects(readVirtualSource(other, uri), /No active Dyalog debug session/);
+});
@@ -0,0 +1,21 @@
+// Reading dyalog: virtual sources through a debug session, kept free of the vscode API
+// so it can be unit tested against a fake session.
+
+export type SourceSession = {
+  type: string;
+  customRequest(command: string, args?: unknown): PromiseLike<any>;
+};
+
+export type SourceUri = {
+  toString(skipEncoding?: boolean): string;
+};
+
+// readVirtualSource asks a dyalog-dap session for the text behind a dyalog: URI. The
+// adapter reads workspace-only entities from the interpreter when no window is open.
+export async function readVirtualSource(session: SourceSession | undefined, uri: SourceUri): Promise<string> {
+  if (!session || session.type !== "dyalog-dap") {
+    throw new Error(`No active Dyalog debug session to read ${uri.toString(true)}`);
+  }
+  const body = await session.customRequest("source", { source: { path: uri.toString() } });
+  return typeof body?.content === "string" ? body.content : "";
+}